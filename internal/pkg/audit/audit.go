@@ -0,0 +1,253 @@
+// Package audit records the tool calls changing the system, so that it can
+// be traced which MCP client installed, removed or re-configured what.
+//
+// Every call is appended as one JSON line to the audit log. The log is
+// rotated once it exceeds its maximum size, keeping the given number of old
+// logs as <path>.1, <path>.2 and so on, the oldest having the highest number.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/jobs"
+)
+
+const (
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	// Started is the status of calls which started a background job, the
+	// job is recorded again with its state once it has finished.
+	Started = "started"
+	// Planned is the status of calls which only returned the plan of a
+	// transaction which has to be confirmed.
+	Planned = "planned"
+)
+
+// Record is the entry of a tool call or finished background job.
+type Record struct {
+	Time     time.Time      `json:"time"`
+	Session  string         `json:"session,omitempty" jsonschema:"The id of the MCP session of the call."`
+	Client   string         `json:"client,omitempty" jsonschema:"The name and version the MCP client reported."`
+	Tool     string         `json:"tool"`
+	Params   map[string]any `json:"params,omitempty" jsonschema:"The parameters of the tool call."`
+	Result   map[string]any `json:"result,omitempty" jsonschema:"The package or repository changes, without the raw output of the package manager."`
+	Status   string         `json:"status" jsonschema:"One of succeeded, failed, started or planned for the calls, or the state of a finished background job."`
+	Error    string         `json:"error,omitempty"`
+	Duration int64          `json:"duration_ms" jsonschema:"The duration of the call or job in milliseconds."`
+	Job      string         `json:"job,omitempty" jsonschema:"The id of the background job started by the call."`
+}
+
+// Log is an audit log. It is safe for concurrent use.
+type Log struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu sync.Mutex
+}
+
+// New returns the audit log at path, which is rotated once it is larger
+// than maxSize bytes, keeping keep old logs. A maxSize of 0 disables the
+// rotation.
+func New(path string, maxSize int64, keep int) *Log {
+	return &Log{path: path, maxSize: maxSize, keep: keep}
+}
+
+func (l *Log) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// rotate moves the log to <path>.1 if adding size bytes would exceed the
+// maximum size.
+func (l *Log) rotate(size int) error {
+	info, err := os.Stat(l.path)
+	if errors.Is(err, os.ErrNotExist) || l.maxSize <= 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Size() == 0 || info.Size()+int64(size) <= l.maxSize {
+		return nil
+	}
+	if l.keep <= 0 {
+		return os.Remove(l.path)
+	}
+	os.Remove(l.rotatedPath(l.keep))
+	for n := l.keep - 1; n > 0; n-- {
+		if err := os.Rename(l.rotatedPath(n), l.rotatedPath(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(l.path, l.rotatedPath(1))
+}
+
+// Append writes the record to the log.
+func (l *Log) Append(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	if err := l.rotate(len(line)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Read returns the records of the log and the kept old logs, the oldest
+// first. Lines which can't be decoded are skipped.
+func (l *Log) Read() ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var records []Record
+	for n := l.keep; n >= 0; n-- {
+		path := l.path
+		if n > 0 {
+			path = l.rotatedPath(n)
+		}
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			var rec Record
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				slog.Debug("skipping invalid audit record", "path", path, "error", err)
+				continue
+			}
+			records = append(records, rec)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+	return records, nil
+}
+
+func (l *Log) append(rec Record) {
+	if err := l.Append(rec); err != nil {
+		slog.Warn("failed to record tool call", "tool", rec.Tool, "error", err)
+	}
+}
+
+// changes returns the structured result of a tool without the raw output
+// and the confirmation token, along with the status of the call and the id
+// of the job it started, if any.
+func changes(result any) (map[string]any, string, string) {
+	if result == nil {
+		return nil, Succeeded, ""
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		return nil, Succeeded, ""
+	}
+	var changes map[string]any
+	if err := json.Unmarshal(content, &changes); err != nil {
+		return nil, Succeeded, ""
+	}
+	delete(changes, "raw_output")
+	if _, ok := changes["confirmation"]; ok {
+		delete(changes, "confirmation")
+		return changes, Planned, ""
+	}
+	if job, ok := changes["job"].(map[string]any); ok {
+		delete(changes, "job")
+		id, _ := job["id"].(string)
+		return changes, Started, id
+	}
+	return changes, Succeeded, ""
+}
+
+// Middleware records the calls of the tools for which audited returns true,
+// whether they succeed or not.
+func (l *Log) Middleware(audited func(tool string) bool) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			call, ok := req.(*mcp.CallToolRequest)
+			if method != "tools/call" || !ok || !audited(call.Params.Name) {
+				return next(ctx, method, req)
+			}
+			start := time.Now()
+			res, err := next(ctx, method, req)
+
+			rec := Record{
+				Time:     start,
+				Tool:     call.Params.Name,
+				Duration: time.Since(start).Milliseconds(),
+			}
+			rec.Session, rec.Client = jobs.Caller(call)
+			if len(call.Params.Arguments) > 0 {
+				json.Unmarshal(call.Params.Arguments, &rec.Params)
+			}
+			result, _ := res.(*mcp.CallToolResult)
+			switch {
+			case err != nil:
+				rec.Status = Failed
+				rec.Error = err.Error()
+			case result == nil:
+				rec.Status = Succeeded
+			case result.IsError:
+				rec.Status = Failed
+				var msgs []string
+				for _, content := range result.Content {
+					if text, ok := content.(*mcp.TextContent); ok {
+						msgs = append(msgs, text.Text)
+					}
+				}
+				rec.Error = strings.Join(msgs, "\n")
+			default:
+				rec.Result, rec.Status, rec.Job = changes(result.StructuredContent)
+			}
+			l.append(rec)
+			return res, err
+		}
+	}
+}
+
+// JobFinished records a finished background job with the session and client
+// of the call which started it, use it as jobs.Manager.OnFinish.
+func (l *Log) JobFinished(job jobs.Job) {
+	rec := Record{
+		Time:     job.Finished,
+		Session:  job.Session,
+		Client:   job.Client,
+		Tool:     job.Tool,
+		Status:   string(job.State),
+		Error:    job.Error,
+		Duration: job.Finished.Sub(job.Started).Milliseconds(),
+		Job:      job.ID,
+	}
+	rec.Result, _, _ = changes(job.Result)
+	l.append(rec)
+}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/jobs"
+)
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	log := New(path, 300, 2)
+	for i := range 10 {
+		require.NoError(t, log.Append(Record{Tool: fmt.Sprintf("tool%d", i), Status: Succeeded}))
+	}
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(300))
+	}
+	assert.NoFileExists(t, path+".3")
+
+	records, err := log.Read()
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	assert.Less(t, len(records), 10, "the oldest records are dropped")
+	assert.Equal(t, "tool9", records[len(records)-1].Tool)
+	for i := 1; i < len(records); i++ {
+		assert.Less(t, records[i-1].Tool, records[i].Tool, "the records are read in order")
+	}
+}
+
+type installParams struct {
+	Name       string `json:"name"`
+	Background bool   `json:"background,omitempty"`
+}
+
+type installResult struct {
+	Installed []string  `json:"installed"`
+	RawOutput string    `json:"raw_output"`
+	Job       *jobs.Job `json:"job,omitempty"`
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	log := New(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	jobManager, err := jobs.NewManager(t.TempDir())
+	require.NoError(t, err)
+	jobManager.OnFinish = log.JobFinished
+
+	install := func(ctx context.Context, request *mcp.CallToolRequest, params installParams) (*mcp.CallToolResult, installResult, error) {
+		if params.Name == "emacs" {
+			return nil, installResult{}, errors.New("denied by policy: package emacs matches the denied packages 'emacs*'")
+		}
+		if params.Background {
+			job, err := jobManager.Start(request, "install_package", params, func(ctx context.Context) (any, error) {
+				return installResult{Installed: []string{params.Name}, RawOutput: "installing"}, nil
+			})
+			return nil, installResult{Installed: []string{}, Job: &job}, err
+		}
+		return nil, installResult{Installed: []string{params.Name}, RawOutput: "installing"}, nil
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "install_package"}, install)
+	mcp.AddTool(server, &mcp.Tool{Name: "audit_log"}, log.AuditLog)
+	server.AddReceivingMiddleware(log.Middleware(func(tool string) bool { return tool == "install_package" }))
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(&mcp.Implementation{Name: "client", Version: "1.0"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	for _, name := range []string{"vim", "emacs"} {
+		_, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "install_package", Arguments: map[string]any{"name": name}})
+		require.NoError(t, err)
+	}
+	_, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "install_package", Arguments: map[string]any{"name": "htop", "background": true}})
+	require.NoError(t, err)
+	jobManager.Wait()
+
+	_, result, err := log.AuditLog(ctx, nil, AuditLogParams{})
+	require.NoError(t, err)
+	require.Len(t, result.Records, 4, "the calls of audit_log aren't recorded")
+	finished, started, failed, succeeded := result.Records[0], result.Records[1], result.Records[2], result.Records[3]
+
+	assert.Equal(t, "install_package", succeeded.Tool)
+	assert.Equal(t, Succeeded, succeeded.Status)
+	assert.Equal(t, "client 1.0", succeeded.Client)
+	assert.Equal(t, map[string]any{"name": "vim"}, succeeded.Params)
+	assert.Equal(t, map[string]any{"installed": []any{"vim"}}, succeeded.Result, "the raw output isn't recorded")
+	assert.WithinDuration(t, time.Now(), succeeded.Time, time.Minute)
+
+	assert.Equal(t, Failed, failed.Status)
+	assert.Contains(t, failed.Error, "denied by policy")
+
+	assert.Equal(t, Started, started.Status)
+	require.NotEmpty(t, started.Job)
+	assert.Equal(t, started.Job, finished.Job)
+	assert.Equal(t, string(jobs.Succeeded), finished.Status)
+	assert.Equal(t, started.Session, finished.Session, "the job is recorded with the session which started it")
+	assert.Equal(t, "client 1.0", finished.Client)
+	assert.Equal(t, map[string]any{"installed": []any{"htop"}}, finished.Result)
+
+	_, result, err = log.AuditLog(ctx, nil, AuditLogParams{Failed: true})
+	require.NoError(t, err)
+	assert.Equal(t, []Record{failed}, result.Records)
+	_, result, err = log.AuditLog(ctx, nil, AuditLogParams{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []Record{finished}, result.Records)
+	_, result, err = log.AuditLog(ctx, nil, AuditLogParams{Since: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, result.Records)
+}
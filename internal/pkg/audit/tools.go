@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultLimit is the number of records audit_log returns by default.
+const defaultLimit = 50
+
+type AuditLogParams struct {
+	Tool    string    `json:"tool,omitempty" jsonschema:"Only return the calls of this tool."`
+	Session string    `json:"session,omitempty" jsonschema:"Only return the calls of this MCP session."`
+	Since   time.Time `json:"since,omitzero" jsonschema:"Only return the calls made at or after this time, in RFC 3339 format."`
+	Failed  bool      `json:"failed,omitempty" jsonschema:"Only return the calls and jobs which failed."`
+	Limit   int       `json:"limit,omitempty" jsonschema:"The maximal number of records to return, defaults to 50."`
+}
+
+type AuditLogResult struct {
+	Records []Record `json:"records" jsonschema:"The matching records, the most recent first."`
+}
+
+func (l *Log) AuditLog(ctx context.Context, request *mcp.CallToolRequest, params AuditLogParams) (*mcp.CallToolResult, AuditLogResult, error) {
+	records, err := l.Read()
+	if err != nil {
+		return nil, AuditLogResult{}, err
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	result := []Record{}
+	for _, rec := range slices.Backward(records) {
+		if len(result) >= limit {
+			break
+		}
+		if params.Tool != "" && rec.Tool != params.Tool {
+			continue
+		}
+		if params.Session != "" && rec.Session != params.Session {
+			continue
+		}
+		if !params.Since.IsZero() && rec.Time.Before(params.Since) {
+			continue
+		}
+		if params.Failed && slices.Contains([]string{Succeeded, Started, Planned}, rec.Status) {
+			continue
+		}
+		result = append(result, rec)
+	}
+	return nil, AuditLogResult{Records: result}, nil
+}
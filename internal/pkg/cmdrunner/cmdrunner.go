@@ -0,0 +1,136 @@
+// Package cmdrunner runs the commands of the package manager backends.
+//
+// The backends get a Runner instead of calling exec.Command themselves, so
+// that the invocations can be recorded into fixture files with a Recorder and
+// served from them with a Replayer in tests, without the package managers
+// being installed.
+package cmdrunner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Cmd is a command to run.
+type Cmd struct {
+	Name string
+	Args []string
+	// Env is added to the environment of the server process.
+	Env []string
+	// Stdin is the input of the command, like the answers to the prompts of
+	// zypper. Without input the command reads from /dev/null.
+	Stdin string
+}
+
+// New returns the command for name with args.
+func New(name string, args ...string) Cmd {
+	return Cmd{Name: name, Args: args}
+}
+
+func (cmd Cmd) String() string {
+	return strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")
+}
+
+// Runner runs commands. The output is the combined stdout and stderr, and a
+// non-zero exit status is returned as an error whose code can be read with
+// ExitCode.
+type Runner interface {
+	Run(ctx context.Context, cmd Cmd) ([]byte, error)
+	// Stream runs cmd like Run and calls line for every line of the output
+	// as soon as it is available.
+	Stream(ctx context.Context, cmd Cmd, line func(string)) ([]byte, error)
+}
+
+// ExitError is the error of a command which exited with a non-zero status.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// ExitCode returns the exit status of a command which failed with err, which
+// is false if the command couldn't be run at all.
+func ExitCode(err error) (int, bool) {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
+// InterruptGrace is how long a cancelled command may take to exit after
+// SIGINT before it is killed, so that zypper and friends can release their
+// lock and leave the package database consistent.
+var InterruptGrace = 10 * time.Second
+
+// maxLineSize is the length of the longest output line Stream passes on,
+// longer lines fail the command.
+const maxLineSize = 16 * 1024 * 1024
+
+// Exec runs the commands on the system.
+type Exec struct{}
+
+func (Exec) command(ctx context.Context, cmd Cmd) *exec.Cmd {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Cancel = func() error {
+		return c.Process.Signal(os.Interrupt)
+	}
+	c.WaitDelay = InterruptGrace
+	if len(cmd.Env) > 0 {
+		c.Env = append(c.Environ(), cmd.Env...)
+	}
+	if cmd.Stdin != "" {
+		c.Stdin = strings.NewReader(cmd.Stdin)
+	}
+	return c
+}
+
+func (e Exec) Run(ctx context.Context, cmd Cmd) ([]byte, error) {
+	return e.command(ctx, cmd).CombinedOutput()
+}
+
+func (e Exec) Stream(ctx context.Context, cmd Cmd, line func(string)) ([]byte, error) {
+	c := e.command(ctx, cmd)
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	c.Stderr = c.Stdout
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		out.WriteString(scanner.Text())
+		out.WriteString("\n")
+		if line != nil {
+			line(scanner.Text())
+		}
+	}
+	// the command must not block on a full pipe if the scanner gave up
+	_, _ = io.Copy(io.Discard, stdout)
+	err = c.Wait()
+	if scanErr := scanner.Err(); scanErr != nil {
+		return out.Bytes(), fmt.Errorf("reading the output of %s failed: %w", cmd.Name, scanErr)
+	}
+	return out.Bytes(), err
+}
@@ -0,0 +1,129 @@
+package cmdrunner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExec(t *testing.T) {
+	out, err := Exec{}.Run(context.Background(), Cmd{Name: "/bin/sh", Args: []string{"-c", "echo $FOO; echo err >&2; exit 3"}, Env: []string{"FOO=bar"}})
+	assert.Equal(t, "bar\nerr\n", string(out))
+	code, ok := ExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, code)
+
+	var lines []string
+	out, err = Exec{}.Stream(context.Background(), New("/bin/sh", "-c", "echo one; echo two"), func(line string) {
+		lines = append(lines, line)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", string(out))
+	assert.Equal(t, []string{"one", "two"}, lines)
+
+	// lines longer than the default buffer of bufio.Scanner are passed on
+	lines = nil
+	out, err = Exec{}.Stream(context.Background(), New("/bin/sh", "-c", "head -c 100000 /dev/zero | tr '\\0' x; echo; echo done"), func(line string) {
+		lines = append(lines, line)
+	})
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Len(t, lines[0], 100000)
+	assert.Equal(t, "done", lines[1])
+	assert.Len(t, out, 100000+len("\ndone\n"))
+
+	out, err = Exec{}.Run(context.Background(), Cmd{Name: "/bin/sh", Args: []string{"-c", "read a; echo got $a"}, Stdin: "1\ny\n"})
+	require.NoError(t, err)
+	assert.Equal(t, "got 1\n", string(out))
+
+	_, err = Exec{}.Run(context.Background(), New("/nonexistent/zypper"))
+	_, ok = ExitCode(err)
+	assert.False(t, ok)
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "fixtures", "zypper.json")
+	root := filepath.Join(dir, "root")
+	vars := Vars{"ROOT": root}
+
+	recorder, err := NewRecorder(Exec{}, fixture, vars)
+	require.NoError(t, err)
+	out, err := recorder.Run(context.Background(), New("/bin/echo", "--root", root, "search", "vim"))
+	require.NoError(t, err)
+	assert.Equal(t, "--root "+root+" search vim\n", string(out))
+	_, err = recorder.Run(context.Background(), New("/bin/sh", "-c", "echo locked; exit 7"))
+	code, _ := ExitCode(err)
+	assert.Equal(t, 7, code)
+
+	records, err := LoadFixture(fixture)
+	require.NoError(t, err)
+	assert.Equal(t, []Record{
+		{Name: "echo", Args: []string{"--root", "${ROOT}", "search", "vim"}, Output: "--root " + root + " search vim\n"},
+		{Name: "sh", Args: []string{"-c", "echo locked; exit 7"}, Output: "locked\n", ExitCode: 7},
+	}, records)
+
+	// the replayer expands the variables of the test which replays the
+	// fixture, independent of where the binaries are installed
+	otherRoot := filepath.Join(dir, "other")
+	replayer, err := LoadReplayer(fixture, Vars{"ROOT": otherRoot})
+	require.NoError(t, err)
+	var lines []string
+	out, err = replayer.Stream(context.Background(), New("/usr/bin/echo", "--root", otherRoot, "search", "vim"), func(line string) {
+		lines = append(lines, line)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "--root "+root+" search vim\n", string(out))
+	assert.Equal(t, []string{"--root " + root + " search vim"}, lines)
+
+	out, err = replayer.Run(context.Background(), New("sh", "-c", "echo locked; exit 7"))
+	assert.Equal(t, "locked\n", string(out))
+	code, ok := ExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 7, code)
+
+	_, err = replayer.Run(context.Background(), New("/bin/echo", "--root", root, "search", "vim"))
+	assert.ErrorContains(t, err, "no recorded invocation")
+}
+
+func TestReplayOrder(t *testing.T) {
+	replayer := NewReplayer([]Record{
+		{Name: "zypper", Args: []string{"refresh"}, Output: "locked\n", ExitCode: 7},
+		{Name: "zypper", Args: []string{"refresh"}, Output: "done\n"},
+	}, nil)
+	_, err := replayer.Run(context.Background(), New("zypper", "refresh"))
+	assert.Error(t, err)
+	for range 2 {
+		out, err := replayer.Run(context.Background(), New("zypper", "refresh"))
+		require.NoError(t, err)
+		assert.Equal(t, "done\n", string(out))
+	}
+}
+
+func TestReplayStdin(t *testing.T) {
+	replayer := NewReplayer([]Record{
+		{Name: "zypper", Args: []string{"install", "apache2"}, Output: "Problem: 1: conflict\n", ExitCode: 4},
+		{Name: "zypper", Args: []string{"install", "apache2"}, Stdin: "1\n", Output: "done\n"},
+	}, nil)
+	out, err := replayer.Run(context.Background(), Cmd{Name: "zypper", Args: []string{"install", "apache2"}, Stdin: "1\n"})
+	require.NoError(t, err)
+	assert.Equal(t, "done\n", string(out))
+	_, err = replayer.Run(context.Background(), Cmd{Name: "zypper", Args: []string{"install", "apache2"}, Stdin: "2\n"})
+	assert.ErrorContains(t, err, "no recorded invocation")
+}
+
+func TestRecorderKeepsRecords(t *testing.T) {
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(fixture, []byte(`[{"name": "rpm", "args": ["-qa"], "output": "vim\n"}]`), 0644))
+	recorder, err := NewRecorder(NewReplayer([]Record{{Name: "rpm", Args: []string{"-q", "vim"}, Output: "vim-9.1\n"}}, nil), fixture, nil)
+	require.NoError(t, err)
+	_, err = recorder.Run(context.Background(), New("rpm", "-q", "vim"))
+	require.NoError(t, err)
+	records, err := LoadFixture(fixture)
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+}
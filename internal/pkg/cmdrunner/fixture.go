@@ -0,0 +1,214 @@
+package cmdrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Record is a recorded command invocation. Only the base name of the binary
+// is kept, so that fixtures don't depend on where it is installed.
+type Record struct {
+	Name     string   `json:"name"`
+	Args     []string `json:"args"`
+	Stdin    string   `json:"stdin,omitempty"`
+	Output   string   `json:"output"`
+	ExitCode int      `json:"exit_code,omitempty"`
+	// Error is set if the command couldn't be run at all.
+	Error string `json:"error,omitempty"`
+}
+
+// Vars are replaced in the arguments of recorded commands by ${KEY}, e.g.
+// the root directory of a test environment, and expanded again on replay.
+type Vars map[string]string
+
+func (vars Vars) substitute(args []string) []string {
+	subst := make([]string, len(args))
+	for i, arg := range args {
+		for key, value := range vars {
+			if value != "" {
+				arg = strings.ReplaceAll(arg, value, "${"+key+"}")
+			}
+		}
+		subst[i] = arg
+	}
+	return subst
+}
+
+func (vars Vars) expand(args []string) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = os.Expand(arg, func(key string) string {
+			if value, ok := vars[key]; ok {
+				return value
+			}
+			return "${" + key + "}"
+		})
+	}
+	return expanded
+}
+
+// LoadFixture reads the records of a fixture file.
+func LoadFixture(path string) ([]Record, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// Recorder runs commands with another runner and writes every invocation
+// with its output to a fixture file.
+type Recorder struct {
+	runner  Runner
+	path    string
+	vars    Vars
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewRecorder records the commands run with runner to the fixture file at
+// path. Records already in the file are kept.
+func NewRecorder(runner Runner, path string, vars Vars) (*Recorder, error) {
+	records, err := LoadFixture(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &Recorder{runner: runner, path: path, vars: vars, records: records}, nil
+}
+
+func (r *Recorder) Run(ctx context.Context, cmd Cmd) ([]byte, error) {
+	out, err := r.runner.Run(ctx, cmd)
+	return out, r.record(cmd, out, err)
+}
+
+func (r *Recorder) Stream(ctx context.Context, cmd Cmd, line func(string)) ([]byte, error) {
+	out, err := r.runner.Stream(ctx, cmd, line)
+	return out, r.record(cmd, out, err)
+}
+
+// record adds the invocation to the fixture and returns err, the error of
+// the command. A failure to write the fixture is only returned if the
+// command succeeded.
+func (r *Recorder) record(cmd Cmd, out []byte, err error) error {
+	rec := Record{
+		Name:   filepath.Base(cmd.Name),
+		Args:   r.vars.substitute(cmd.Args),
+		Stdin:  cmd.Stdin,
+		Output: string(out),
+	}
+	if code, ok := ExitCode(err); ok {
+		rec.ExitCode = code
+	} else if err != nil {
+		rec.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+	if saveErr := r.save(); saveErr != nil && err == nil {
+		return fmt.Errorf("failed to record %s: %w", cmd, saveErr)
+	}
+	return err
+}
+
+// save writes the fixture without escaping HTML, which keeps the XML
+// output of zypper readable.
+func (r *Recorder) save() error {
+	var content bytes.Buffer
+	enc := json.NewEncoder(&content)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.records); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// Replayer serves commands from recorded invocations. Records are matched by
+// the base name of the binary, the arguments and the input and are used in
+// the order of the fixture, the last matching record is reused once all are
+// used.
+type Replayer struct {
+	vars    Vars
+	mu      sync.Mutex
+	records []Record
+	used    []bool
+}
+
+// NewReplayer serves the given records.
+func NewReplayer(records []Record, vars Vars) *Replayer {
+	return &Replayer{vars: vars, records: records, used: make([]bool, len(records))}
+}
+
+// LoadReplayer serves the records of the fixture file at path.
+func LoadReplayer(path string, vars Vars) (*Replayer, error) {
+	records, err := LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(records, vars), nil
+}
+
+func (r *Replayer) Run(ctx context.Context, cmd Cmd) ([]byte, error) {
+	return r.Stream(ctx, cmd, nil)
+}
+
+func (r *Replayer) Stream(ctx context.Context, cmd Cmd, line func(string)) ([]byte, error) {
+	if ctx != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	rec, err := r.find(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if line != nil {
+		for l := range strings.Lines(rec.Output) {
+			line(strings.TrimSuffix(l, "\n"))
+		}
+	}
+	switch {
+	case rec.Error != "":
+		return []byte(rec.Output), fmt.Errorf("%s", rec.Error)
+	case rec.ExitCode != 0:
+		return []byte(rec.Output), &ExitError{Code: rec.ExitCode}
+	}
+	return []byte(rec.Output), nil
+}
+
+func (r *Replayer) find(cmd Cmd) (Record, error) {
+	name := filepath.Base(cmd.Name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i, rec := range r.records {
+		if rec.Name != name || rec.Stdin != cmd.Stdin || !slices.Equal(r.vars.expand(rec.Args), cmd.Args) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return rec, nil
+		}
+		last = i
+	}
+	if last < 0 {
+		return Record{}, fmt.Errorf("no recorded invocation of %s", cmd)
+	}
+	return r.records[last], nil
+}
@@ -0,0 +1,140 @@
+// Package confirm implements the plan-then-commit protocol of the mutating
+// tools: a call without token only returns the plan of the transaction
+// along with a short-lived token, and only a second call with the same
+// parameters and the token executes it, provided the plan is still the same.
+package confirm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a token can be used by default.
+const DefaultTTL = 5 * time.Minute
+
+// Confirmation is returned along with a plan.
+type Confirmation struct {
+	Token   string    `json:"token" jsonschema:"Nothing was changed yet. Call the tool again with the same parameters and this token as confirm_token to execute the plan."`
+	Expires time.Time `json:"expires" jsonschema:"The time after which the token can't be used anymore."`
+}
+
+var (
+	// ErrInvalidToken is returned for unknown, expired or already used
+	// tokens, and for tokens of other calls.
+	ErrInvalidToken = errors.New("invalid confirmation token")
+	// ErrPlanChanged is returned if the system has changed since the plan
+	// was made, so that the transaction would differ from it.
+	ErrPlanChanged = errors.New("the transaction differs from the confirmed plan")
+)
+
+type pending struct {
+	tool    string
+	params  string
+	plan    []string
+	expires time.Time
+}
+
+// Store keeps the issued tokens. It is safe for concurrent use.
+type Store struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	pending map[string]pending
+}
+
+// NewStore returns a store issuing tokens which are valid for ttl.
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, pending: map[string]pending{}}
+}
+
+func encode(params any) (string, error) {
+	content, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode parameters: %w", err)
+	}
+	return string(content), nil
+}
+
+// Issue returns the token for executing the plan with a call of tool with
+// params. The params must not contain the token itself.
+func (s *Store) Issue(tool string, params any, plan []string) (*Confirmation, error) {
+	encoded, err := encode(params)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to create confirmation token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, p := range s.pending {
+		if now.After(p.expires) {
+			delete(s.pending, t)
+		}
+	}
+	p := pending{tool: tool, params: encoded, plan: slices.Clone(plan), expires: now.Add(s.ttl)}
+	s.pending[token] = p
+	return &Confirmation{Token: token, Expires: p.expires}, nil
+}
+
+// Redeem returns the plan the token was issued for, if the call of tool
+// with params is the planned one. A token can only be redeemed once, a call
+// with other parameters leaves it to the planned one.
+func (s *Store) Redeem(token string, tool string, params any) ([]string, error) {
+	encoded, err := encode(params)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[token]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown or already used, call %s without token for a new plan", ErrInvalidToken, tool)
+	}
+	switch {
+	case time.Now().After(p.expires):
+		delete(s.pending, token)
+		return nil, fmt.Errorf("%w: expired at %s, call %s without token for a new plan", ErrInvalidToken, p.expires.Format(time.RFC3339), tool)
+	case p.tool != tool || p.params != encoded:
+		return nil, fmt.Errorf("%w: issued for %s with the parameters %s", ErrInvalidToken, p.tool, p.params)
+	}
+	delete(s.pending, token)
+	return p.plan, nil
+}
+
+// CheckPlan checks that the current plan is still the confirmed one. The
+// order of the plans doesn't matter.
+func CheckPlan(confirmed []string, current []string) error {
+	var missing, added []string
+	for _, step := range confirmed {
+		if !slices.Contains(current, step) {
+			missing = append(missing, step)
+		}
+	}
+	for _, step := range current {
+		if !slices.Contains(confirmed, step) {
+			added = append(added, step)
+		}
+	}
+	if len(missing) == 0 && len(added) == 0 {
+		return nil
+	}
+	var diffs []string
+	if len(missing) > 0 {
+		diffs = append(diffs, "no longer planned: "+strings.Join(missing, ", "))
+	}
+	if len(added) > 0 {
+		diffs = append(diffs, "newly planned: "+strings.Join(added, ", "))
+	}
+	return fmt.Errorf("%w, %s; call again without token for a new plan", ErrPlanChanged, strings.Join(diffs, "; "))
+}
@@ -0,0 +1,61 @@
+package confirm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type params struct {
+	Name string `json:"name"`
+}
+
+func TestRedeem(t *testing.T) {
+	store := NewStore(time.Minute)
+	plan := []string{"install vim 9.1", "install vim-data 9.1"}
+	conf, err := store.Issue("install_package", params{Name: "vim"}, plan)
+	require.NoError(t, err)
+	assert.Len(t, conf.Token, 32)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), conf.Expires, time.Second)
+
+	confirmed, err := store.Redeem(conf.Token, "install_package", params{Name: "vim"})
+	require.NoError(t, err)
+	assert.Equal(t, plan, confirmed)
+	_, err = store.Redeem(conf.Token, "install_package", params{Name: "vim"})
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens can only be used once")
+
+	conf, err = store.Issue("install_package", params{Name: "vim"}, plan)
+	require.NoError(t, err)
+	_, err = store.Redeem(conf.Token, "install_package", params{Name: "emacs"})
+	assert.ErrorContains(t, err, `issued for install_package with the parameters {"name":"vim"}`)
+	confirmed, err = store.Redeem(conf.Token, "install_package", params{Name: "vim"})
+	require.NoError(t, err, "tokens are kept for the planned call")
+	assert.Equal(t, plan, confirmed)
+
+	conf, err = store.Issue("remove_package", params{Name: "vim"}, plan)
+	require.NoError(t, err)
+	_, err = store.Redeem(conf.Token, "install_package", params{Name: "vim"})
+	assert.ErrorContains(t, err, "issued for remove_package")
+	_, err = store.Redeem(conf.Token, "remove_package", params{Name: "vim"})
+	assert.NoError(t, err)
+
+	store = NewStore(0)
+	conf, err = store.Issue("install_package", params{Name: "vim"}, plan)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	_, err = store.Redeem(conf.Token, "install_package", params{Name: "vim"})
+	assert.ErrorContains(t, err, "expired at")
+	_, err = store.Redeem(conf.Token, "install_package", params{Name: "vim"})
+	assert.ErrorContains(t, err, "unknown or already used", "expired tokens are removed")
+}
+
+func TestCheckPlan(t *testing.T) {
+	assert.NoError(t, CheckPlan(nil, []string{}))
+	assert.NoError(t, CheckPlan([]string{"remove bash 5.2", "remove libreadline8 8.2"}, []string{"remove libreadline8 8.2", "remove bash 5.2"}))
+
+	err := CheckPlan([]string{"remove bash 5.2", "remove libreadline8 8.2"}, []string{"remove libreadline8 8.2", "remove zsh 5.9"})
+	assert.ErrorIs(t, err, ErrPlanChanged)
+	assert.EqualError(t, err, "the transaction differs from the confirmed plan, no longer planned: remove bash 5.2; newly planned: remove zsh 5.9; call again without token for a new plan")
+}
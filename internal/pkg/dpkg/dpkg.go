@@ -8,10 +8,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 )
 
@@ -19,7 +22,9 @@ type DPKG struct {
 	dpkgbin   string
 	dpkgquery string
 	aptcache  string
+	aptget    string
 	root      string
+	runner    cmdrunner.Runner
 }
 
 func New(dpkgbin string, dpkgquery string, aptcache string, root string) DPKG {
@@ -28,21 +33,133 @@ func New(dpkgbin string, dpkgquery string, aptcache string, root string) DPKG {
 		dpkgquery: dpkgquery,
 		aptcache:  aptcache,
 		root:      root,
+		runner:    cmdrunner.Exec{},
 	}
 }
 
-func (dpkg DPKG) ListInstalledPackagesSysCall(params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+// WithRunner returns the backend running its commands with runner.
+func (dpkg DPKG) WithRunner(runner cmdrunner.Runner) DPKG {
+	dpkg.runner = runner
+	return dpkg
+}
+
+// WithAptGet returns the backend calling the apt-get at path instead of the
+// one found in PATH.
+func (dpkg DPKG) WithAptGet(path string) DPKG {
+	dpkg.aptget = path
+	return dpkg
+}
+
+// run runs an apt or dpkg command and returns its combined output. The
+// command is interrupted when ctx is cancelled.
+func (dpkg DPKG) run(ctx context.Context, cmd cmdrunner.Cmd) ([]byte, error) {
+	return dpkg.runner.Run(ctx, cmd)
+}
+
+// dpkgQuery creates the command for a dpkg-query invocation on the database of
+// the root of the backend.
+func (dpkg DPKG) dpkgQuery(args ...string) cmdrunner.Cmd {
+	return cmdrunner.New(dpkg.dpkgquery, append(dpkg.admindirArgs(), args...)...)
+}
+
+// dpkgCmd creates the command for a dpkg invocation on the database of the
+// root of the backend.
+func (dpkg DPKG) dpkgCmd(args ...string) cmdrunner.Cmd {
+	return cmdrunner.New(dpkg.dpkgbin, append(dpkg.admindirArgs(), args...)...)
+}
+
+func (dpkg DPKG) admindirArgs() []string {
+	if dpkg.root == "" {
+		return nil
+	}
+	return []string{"--admindir=" + filepath.Join(dpkg.root, "var/lib/dpkg")}
+}
+
+// aptRootArgs returns the options for apt to use the configuration, lists
+// and dpkg database of the root of the backend.
+func (dpkg DPKG) aptRootArgs() []string {
+	if dpkg.root == "" {
+		return nil
+	}
+	return []string{"-o", "RootDir=" + dpkg.root}
+}
+
+// dpkgConfOptions keep modified configuration files on upgrades instead of
+// asking about them.
+var dpkgConfOptions = []string{"-o", "Dpkg::Options::=--force-confdef", "-o", "Dpkg::Options::=--force-confold"}
+
+// aptGet creates the command for an apt-get invocation on the root of the
+// backend. There is no terminal to answer questions on, so debconf must not
+// ask any.
+func (dpkg DPKG) aptGet(args ...string) (cmdrunner.Cmd, error) {
+	aptget := dpkg.aptget
+	if aptget == "" {
+		var err error
+		aptget, err = exec.LookPath("apt-get")
+		if err != nil {
+			return cmdrunner.Cmd{}, fmt.Errorf("apt-get binary not found: %w", err)
+		}
+	}
+	cmdArgs := dpkg.aptRootArgs()
+	if dpkg.root != "" {
+		// dpkg is called by apt-get and must install to the root as well
+		cmdArgs = append(cmdArgs, "-o", "DPkg::Options::=--root="+dpkg.root)
+	}
+	cmdArgs = append(cmdArgs, args...)
+	cmd := cmdrunner.New(aptget, cmdArgs...)
+	cmd.Env = []string{"DEBIAN_FRONTEND=noninteractive"}
+	return cmd, nil
+}
+
+// SystemInfoSysCall reports the versions of dpkg and apt.
+func (dpkg DPKG) SystemInfoSysCall(ctx context.Context, request *mcp.CallToolRequest) (syspackage.SystemInfo, error) {
+	info := syspackage.NewSystemInfo("apt", dpkg.root)
+	aptget := dpkg.aptget
+	if aptget == "" {
+		aptget, _ = exec.LookPath("apt-get")
+	}
+	for name, binary := range map[string]string{"dpkg": dpkg.dpkgbin, "apt": aptget} {
+		if version := syspackage.ToolVersion(ctx, dpkg.runner, binary); version != "" {
+			info.Versions[name] = version
+		}
+	}
+	return info, nil
+}
+
+// Capabilities supports all operations and the relations with a field in
+// the dpkg database.
+func (dpkg DPKG) Capabilities() syspackage.Capabilities {
+	caps := syspackage.AllCapabilities()
+	caps.Relations = slices.DeleteFunc(caps.Relations, func(rel string) bool {
+		_, ok := relationFields[rel]
+		return !ok
+	})
+	caps.Solutions = false
+	return caps
+}
+
+// ListInstalledPackagesSysCall reads the dpkg database of the root directly
+// and only falls back to dpkg-query if there is no status file.
+func (dpkg DPKG) ListInstalledPackagesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+	lst, err := dpkg.listStatusDatabase(params)
+	if !os.IsNotExist(err) {
+		return lst, err
+	}
+	return dpkg.listDpkgQuery(ctx, params)
+}
+
+func (dpkg DPKG) listDpkgQuery(ctx context.Context, params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
 	// The query format doesn't need shell quoting since exec.Command passes arguments directly.
-	format := "${binary:Package},${Version},${Installed-Size}\n"
+	format := "${binary:Package}\t${Package}\t${Version}\t${Architecture}\t${Installed-Size}\t${Origin}\t${source:Package}\n"
 	argsList := []string{"-W", "-f", format}
 	if params.Name != "" {
 		argsList = append(argsList, params.Name)
 	}
-	cmd := exec.Command(dpkg.dpkgquery, argsList...)
-	pkgList, err := cmd.CombinedOutput()
+	cmd := dpkg.dpkgQuery(argsList...)
+	pkgList, err := dpkg.run(ctx, cmd)
 
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
+		if code, ok := cmdrunner.ExitCode(err); ok && code == 1 {
 			// No packages found, return empty list
 			return []syspackage.SysPackageInfo{}, nil
 		}
@@ -50,32 +167,42 @@ func (dpkg DPKG) ListInstalledPackagesSysCall(params syspackage.ListPackageParam
 	}
 
 	var lst []syspackage.SysPackageInfo
+	// binary:Package includes the architecture for multiarch packages and is
+	// needed to query them individually
+	var queryNames []string
 	scanner := bufio.NewScanner(bytes.NewReader(pkgList))
 	for scanner.Scan() {
 		line := scanner.Text()
-		line = strings.Trim(line, "'")
-		splitLine := strings.Split(line, ",")
-		if len(splitLine) != 3 {
+		splitLine := strings.Split(line, "\t")
+		if len(splitLine) != 7 {
 			continue
 		}
-		size, err := strconv.ParseUint(strings.TrimSpace(splitLine[2]), 10, 64)
+		size, err := strconv.ParseUint(strings.TrimSpace(splitLine[4]), 10, 64)
 		if err != nil {
 			// If size is not a valid number, we can either skip the package or set size to 0.
 			// Setting to 0 seems like a reasonable default.
 			size = 0
 		}
+		epoch, version, release := splitDebianVersion(splitLine[2])
 		lst = append(lst, syspackage.SysPackageInfo{
-			Name:    splitLine[0],
-			Version: splitLine[1],
-			Size:    size,
+			Name:          splitLine[1],
+			Epoch:         epoch,
+			Version:       version,
+			Release:       release,
+			Arch:          splitLine[3],
+			Size:          size,
+			Vendor:        splitLine[5],
+			SourcePackage: splitLine[6],
+			InstallTime:   dpkg.installTime(splitLine[0]),
 		})
+		queryNames = append(queryNames, splitLine[0])
 	}
 
 	// Fetch additional fields if requested
 	for i := range lst {
-		pkgName := lst[i].Name
+		pkgName := queryNames[i]
 		if params.Filelist {
-			fileOut, err := exec.Command(dpkg.dpkgbin, "-L", pkgName).CombinedOutput()
+			fileOut, err := dpkg.run(ctx, dpkg.dpkgCmd("-L", pkgName))
 			if err == nil {
 				scannerFiles := bufio.NewScanner(bytes.NewReader(fileOut))
 				var files []string
@@ -90,7 +217,7 @@ func (dpkg DPKG) ListInstalledPackagesSysCall(params syspackage.ListPackageParam
 		}
 
 		if params.Description {
-			descOut, err := exec.Command(dpkg.dpkgquery, "-f", "${Description}", "-W", pkgName).CombinedOutput()
+			descOut, err := dpkg.run(ctx, dpkg.dpkgQuery("-f", "${Description}", "-W", pkgName))
 			if err == nil {
 				lst[i].Description = string(descOut)
 			}
@@ -103,29 +230,12 @@ func (dpkg DPKG) ListInstalledPackagesSysCall(params syspackage.ListPackageParam
 				if rel == "" {
 					continue
 				}
-				var field string
-				switch rel {
-				case "requires":
-					field = "${Depends}"
-				case "recommends":
-					field = "${Recommends}"
-				case "obsoletes":
-					field = "${Breaks}"
-				case "provides":
-					field = "${Provides}"
-				case "conflicts":
-					field = "${Conflicts}"
-				case "suggests":
-					field = "${Suggests}"
-				case "supplements":
-					field = "${Enhances}"
-				case "enhances":
-					field = "${Enhances}"
-				default:
+				field, ok := relationFields[rel]
+				if !ok {
 					continue
 				}
 
-				relOut, err := exec.Command(dpkg.dpkgquery, "-f", field, "-W", pkgName).CombinedOutput()
+				relOut, err := dpkg.run(ctx, dpkg.dpkgQuery("-f", "${"+field+"}", "-W", pkgName))
 				if err == nil {
 					// dpkg-query returns a single line of comma-separated packages for these fields
 					line := strings.TrimSpace(string(relOut))
@@ -156,7 +266,34 @@ func (dpkg DPKG) ListInstalledPackagesSysCall(params syspackage.ListPackageParam
 	return lst, nil
 }
 
-func (dpkg DPKG) QueryPackageSysCall(name string, mode syspackage.QueryMode, lines int) (map[string]any, error) {
+// splitDebianVersion splits a version of the form
+// '[epoch:]upstream_version[-debian_revision]'. The revision is everything
+// after the last hyphen and is returned as release.
+func splitDebianVersion(full string) (epoch int, version string, release string) {
+	version = full
+	if idx := strings.Index(version, ":"); idx != -1 {
+		epoch, _ = strconv.Atoi(version[:idx])
+		version = version[idx+1:]
+	}
+	if idx := strings.LastIndex(version, "-"); idx != -1 {
+		release = version[idx+1:]
+		version = version[:idx]
+	}
+	return epoch, version, release
+}
+
+// installTime returns the time a package was installed or last upgraded.
+// dpkg doesn't record it, but rewrites the file list of the package on every
+// installation.
+func (dpkg DPKG) installTime(binaryName string) time.Time {
+	info, err := os.Stat(filepath.Join("/", dpkg.root, "var/lib/dpkg/info", binaryName+".list"))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (dpkg DPKG) QueryPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, name string, mode syspackage.QueryMode, lines int) (map[string]any, error) {
 	var cmdArgs []string
 	var resultKey string
 	isInfo := false
@@ -179,9 +316,9 @@ func (dpkg DPKG) QueryPackageSysCall(name string, mode syspackage.QueryMode, lin
 		return nil, fmt.Errorf("unsupported query mode: %v", mode)
 	}
 
-	output, err := exec.Command(dpkg.dpkgquery, cmdArgs...).CombinedOutput()
+	output, err := dpkg.run(ctx, dpkg.dpkgQuery(cmdArgs...))
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
+		if code, ok := cmdrunner.ExitCode(err); ok && code == 1 {
 			// Package not found
 			return nil, fmt.Errorf("package not found: %s", name)
 		}
@@ -203,7 +340,7 @@ func (dpkg DPKG) QueryPackageSysCall(name string, mode syspackage.QueryMode, lin
 		}
 		if lines > 0 {
 			changeArgs := []string{"--changelog", name}
-			changeOut, err := exec.Command(dpkg.dpkgquery, changeArgs...).CombinedOutput()
+			changeOut, err := dpkg.run(ctx, dpkg.dpkgQuery(changeArgs...))
 			if err == nil {
 				splittedLines := strings.Split(strings.TrimSpace(string(changeOut)), "\n")
 				if len(splittedLines) > lines {
@@ -225,221 +362,32 @@ func (dpkg DPKG) QueryPackageSysCall(name string, mode syspackage.QueryMode, lin
 
 	return result, nil
 }
-func parseAptListFile(filePath string) (enabled bool, url string) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return false, ""
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		isComment := false
-		if strings.HasPrefix(line, "#") {
-			isComment = true
-			line = strings.TrimSpace(strings.TrimPrefix(line, "#"))
-		}
-
-		if !strings.HasPrefix(line, "deb") && !strings.HasPrefix(line, "deb-src") {
-			continue
-		}
-
-		if !isComment {
-			enabled = true
-		}
-
-		fields := strings.Fields(line)
-		if len(fields) >= 2 {
-			urlIdx := 1
-			if strings.HasPrefix(fields[1], "[") {
-				for i := 1; i < len(fields); i++ {
-					if !strings.HasPrefix(fields[i], "[") && !strings.Contains(fields[i], "=") {
-						urlIdx = i
-						break
-					}
-				}
-			}
-			if urlIdx < len(fields) {
-				if url == "" {
-					url = fields[urlIdx]
-				}
-			}
-		}
-	}
-	return enabled, url
-}
-
-func (dpkg DPKG) getRepos() ([]map[string]any, error) {
-	var repos []map[string]any
-
-	sourcesListPath := filepath.Join(dpkg.root, "etc/apt/sources.list")
-	if _, err := os.Stat(sourcesListPath); err == nil {
-		enabled, url := parseAptListFile(sourcesListPath)
-		enabledStr := "0"
-		if enabled {
-			enabledStr = "1"
-		}
-		repos = append(repos, map[string]any{
-			"alias":   "sources.list",
-			"name":    "sources.list",
-			"enabled": enabledStr,
-			"url":     url,
-		})
-	}
-
-	sourcesListDDir := filepath.Join(dpkg.root, "etc/apt/sources.list.d")
-	files, err := os.ReadDir(sourcesListDDir)
-	if err == nil {
-		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(file.Name(), ".list") {
-				alias := strings.TrimSuffix(file.Name(), ".list")
-				filePath := filepath.Join(sourcesListDDir, file.Name())
-				enabled, url := parseAptListFile(filePath)
-				enabledStr := "0"
-				if enabled {
-					enabledStr = "1"
-				}
-				repos = append(repos, map[string]any{
-					"alias":   alias,
-					"name":    alias,
-					"enabled": enabledStr,
-					"url":     url,
-				})
-			}
-		}
-	}
-
-	return repos, nil
-}
 
-func (dpkg DPKG) ListReposSysCall(name string) ([]map[string]any, error) {
-	allRepos, err := dpkg.getRepos()
-	if err != nil {
-		return nil, err
-	}
-	if name == "" {
-		return allRepos, nil
-	}
-	var filtered []map[string]any
-	for _, repo := range allRepos {
-		if repo["alias"].(string) == name {
-			filtered = append(filtered, repo)
-		}
-	}
-	return filtered, nil
-}
-
-func (dpkg DPKG) ModifyRepoSysCall(params syspackage.ModifyRepoParams) (map[string]any, error) {
-	if params.Name == "" {
-		return nil, fmt.Errorf("repository name is required")
-	}
-
-	var filePath string
-	if params.Name == "sources.list" {
-		filePath = filepath.Join(dpkg.root, "etc/apt/sources.list")
-	} else {
-		filePath = filepath.Join(dpkg.root, "etc/apt/sources.list.d", params.Name+".list")
-	}
-
-	if params.RemoveRepos {
-		_ = os.Remove(filePath)
-		return nil, nil
-	}
-
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
-	}
-
-	var line string
-	prefix := "deb"
-	if params.Disable {
-		prefix = "# deb"
-	}
-
-	options := ""
-	if params.NoGPGCheck {
-		options = "[trusted=yes] "
-	}
-
-	url := params.Url
-	if url == "" {
-		if _, err := os.Stat(filePath); err == nil {
-			_, existingUrl := parseAptListFile(filePath)
-			url = existingUrl
-		}
-	}
-
-	if url == "" {
-		return nil, fmt.Errorf("repository URL is required")
-	}
-
-	urlParts := strings.Fields(url)
-	if len(urlParts) == 1 && !strings.HasSuffix(urlParts[0], "./") {
-		line = fmt.Sprintf("%s %s%s ./", prefix, options, urlParts[0])
-	} else {
-		line = fmt.Sprintf("%s %s%s", prefix, options, url)
-	}
-
-	if err := os.WriteFile(filePath, []byte(line+"\n"), 0644); err != nil {
-		return nil, fmt.Errorf("failed to write repository file: %w", err)
-	}
-
-	repos, err := dpkg.ListReposSysCall(params.Name)
-	if err != nil {
-		return nil, err
-	}
-	if len(repos) == 0 {
-		return nil, fmt.Errorf("could not get repository %s after modification", params.Name)
-	}
-	return repos[0], nil
-}
-
-func (dpkg DPKG) ListPatchesSysCall(params syspackage.ListPatchesParams) ([]map[string]any, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (dpkg DPKG) InstallPatchesSysCall(params syspackage.InstallPatchesParams) ([]map[string]any, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (dpkg DPKG) RefreshReposSysCall(name string) error {
-	aptget, err := exec.LookPath("apt-get")
-	if err != nil {
-		return fmt.Errorf("apt-get binary not found: %w", err)
-	}
-
-	args := []string{}
-	if dpkg.root != "" {
-		args = append(args, "-o", "RootDir="+dpkg.root)
-	}
-	args = append(args, "update")
+func (dpkg DPKG) RefreshReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) error {
+	args := []string{"update"}
 
 	if name != "" {
-		var sourcelist string
-		if name == "sources.list" {
-			sourcelist = "sources.list"
-		} else {
-			sourcelist = filepath.Join("sources.list.d", name+".list")
+		alias, _ := splitRepoID(name)
+		sourcelist, err := filepath.Rel(filepath.Join("/", dpkg.root, "etc/apt"), dpkg.sourcesPath(alias))
+		if err != nil {
+			return err
 		}
 		args = append(args, "-o", "Dir::Etc::sourcelist="+sourcelist)
 		args = append(args, "-o", "Dir::Etc::sourceparts=none")
 	}
 
-	cmd := exec.Command(aptget, args...)
-	output, err := cmd.CombinedOutput()
+	cmd, err := dpkg.aptGet(args...)
+	if err != nil {
+		return err
+	}
+	output, err := syspackage.RunWithProgress(ctx, request, dpkg.runner, cmd)
 	if err != nil {
-		return fmt.Errorf("apt-get update failed: %w, output: %s", err, string(output))
+		return fmt.Errorf("apt-get update failed: %w, output: %s", err, output)
 	}
 	return nil
 }
 
-func (dpkg DPKG) SearchPackageSysCall(params syspackage.SearchPackageParams) (any, error) {
+func (dpkg DPKG) SearchPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.SearchPackageParams) (syspackage.SearchResult, error) {
 	aptcache := dpkg.aptcache
 	if aptcache == "" {
 		var err error
@@ -450,11 +398,11 @@ func (dpkg DPKG) SearchPackageSysCall(params syspackage.SearchPackageParams) (an
 	}
 
 	// First search for package names using apt-cache search
-	cmd := exec.Command(aptcache, "search", "--names-only", params.Name)
-	output, err := cmd.CombinedOutput()
-	result := make(map[string]map[string][]syspackage.SearchedPackage)
+	cmd := cmdrunner.New(aptcache, append(dpkg.aptRootArgs(), "search", "--names-only", params.Name)...)
+	output, err := dpkg.run(ctx, cmd)
+	result := make(syspackage.SearchResult)
 	if err != nil {
-		if _, ok := err.(*exec.ExitError); ok {
+		if _, ok := cmdrunner.ExitCode(err); ok {
 			return result, nil
 		}
 		return nil, fmt.Errorf("apt-cache search failed: %w, output: %s", err, string(output))
@@ -486,11 +434,12 @@ func (dpkg DPKG) SearchPackageSysCall(params syspackage.SearchPackageParams) (an
 	}
 
 	// Run apt-cache madison to get structured version and repository info
-	args := append([]string{"madison"}, pkgNames...)
-	cmdMadison := exec.Command(aptcache, args...)
-	madisonOutput, err := cmdMadison.CombinedOutput()
+	args := append(dpkg.aptRootArgs(), "madison")
+	args = append(args, pkgNames...)
+	cmdMadison := cmdrunner.New(aptcache, args...)
+	madisonOutput, err := dpkg.run(ctx, cmdMadison)
 	if err != nil {
-		if _, ok := err.(*exec.ExitError); ok {
+		if _, ok := cmdrunner.ExitCode(err); ok {
 			madisonOutput = []byte{}
 		} else {
 			return nil, fmt.Errorf("apt-cache madison failed: %w, output: %s", err, string(madisonOutput))
@@ -503,10 +452,10 @@ func (dpkg DPKG) SearchPackageSysCall(params syspackage.SearchPackageParams) (an
 	if !strings.Contains(queryName, "*") && !strings.Contains(queryName, "?") {
 		queryName = "*" + queryName + "*"
 	}
-	installedPkgs, err := dpkg.ListInstalledPackagesSysCall(syspackage.ListPackageParams{Name: queryName})
+	installedPkgs, err := dpkg.ListInstalledPackagesSysCall(ctx, request, syspackage.ListPackageParams{Name: queryName})
 	if err == nil {
 		for _, p := range installedPkgs {
-			installedMap[p.Name] = p.Version
+			installedMap[p.Name] = p.EVR()
 		}
 	}
 
@@ -594,41 +543,138 @@ func (dpkg DPKG) SearchPackageSysCall(params syspackage.SearchPackageParams) (an
 	return result, nil
 }
 
-func (dpkg DPKG) InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (string, error) {
-	return "", fmt.Errorf("not implemented")
+// targetRelease returns the release apt-get selects with -t for the
+// repository repo, which is the suite of its entries. Names which aren't the
+// ID or alias of a repository are taken as release, suite or codename.
+func (dpkg DPKG) targetRelease(ctx context.Context, repo string) (string, error) {
+	repos, err := dpkg.ListReposSysCall(ctx, nil, repo)
+	if err != nil {
+		return "", err
+	}
+	if len(repos) == 0 {
+		return repo, nil
+	}
+	var suites []string
+	for _, r := range repos {
+		for _, suite := range r.Suites {
+			if !slices.Contains(suites, suite) {
+				suites = append(suites, suite)
+			}
+		}
+	}
+	if len(suites) != 1 || strings.HasSuffix(suites[0], "/") {
+		return "", fmt.Errorf("repository %s has the suites '%s', apt-get can only select a single suite of a non-flat repository", repo, strings.Join(suites, " "))
+	}
+	return suites[0], nil
+}
+
+func (dpkg DPKG) InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (syspackage.InstallResult, error) {
+	if params.Name == "" {
+		return syspackage.InstallResult{}, fmt.Errorf("package name is required")
+	}
+	args := []string{"install", "-y", "-V"}
+	args = append(args, dpkgConfOptions...)
+	if params.ShowDetails {
+		args = append(args, "-s")
+	}
+	if params.FromRepo != "" {
+		release, err := dpkg.targetRelease(ctx, params.FromRepo)
+		if err != nil {
+			return syspackage.InstallResult{}, err
+		}
+		args = append(args, "-t", release)
+	}
+	if params.NoRecommends {
+		args = append(args, "--no-install-recommends")
+	} else {
+		args = append(args, "--install-recommends")
+	}
+	pkg := params.Name
+	if params.Version != "" {
+		pkg = fmt.Sprintf("%s=%s", params.Name, params.Version)
+	}
+	args = append(args, pkg)
+	cmd, err := dpkg.aptGet(args...)
+	if err != nil {
+		return syspackage.InstallResult{}, err
+	}
+	output, err := syspackage.RunWithProgress(ctx, request, dpkg.runner, cmd)
+	if err != nil {
+		return syspackage.InstallResult{RawOutput: output}, fmt.Errorf("apt-get install failed: %w, output: %s", err, output)
+	}
+	return syspackage.ParseAptInstallOutput(output, params.Name), nil
 }
 
-func (dpkg DPKG) RemovePackageSysCall(params syspackage.RemovePackageParams) (string, error) {
+func (dpkg DPKG) RemovePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.RemovePackageParams) (string, error) {
 	if params.Name == "" {
 		return "", fmt.Errorf("package name is required")
 	}
 
-	var cmdArgs []string
+	cmdArgs := []string{"remove", "-y", "-V"}
 	if params.Purge {
 		cmdArgs = append(cmdArgs, "--purge")
-	} else {
-		cmdArgs = append(cmdArgs, "--remove")
 	}
-
+	if params.RemoveDeps {
+		cmdArgs = append(cmdArgs, "--auto-remove")
+	}
 	if params.ShowDetails {
-		cmdArgs = append(cmdArgs, "--dry-run")
+		cmdArgs = append(cmdArgs, "-s")
 	}
-
 	cmdArgs = append(cmdArgs, params.Name)
 
-	cmd := exec.Command(dpkg.dpkgbin, cmdArgs...)
-	output, err := cmd.CombinedOutput()
+	cmd, err := dpkg.aptGet(cmdArgs...)
 	if err != nil {
-		return "", fmt.Errorf("failed to remove package '%s': %w. Output: %s", params.Name, err, string(output))
+		return "", err
+	}
+	output, err := syspackage.RunWithProgress(ctx, request, dpkg.runner, cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to remove package '%s': %w. Output: %s", params.Name, err, output)
 	}
 
-	return string(output), nil
+	return output, nil
 }
 
 func (dpkg DPKG) PkgType() string {
 	return "dpkg"
 }
 
-func (dpkg DPKG) UpdatePackageSysCall(params syspackage.UpdatePackageParams) (string, error) {
-	return "", fmt.Errorf("not implemented")
+func (dpkg DPKG) UpdatePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.UpdatePackageParams) (syspackage.UpdateResult, error) {
+	var args []string
+	switch {
+	case params.Name != "":
+		args = []string{"install", "--only-upgrade"}
+	case params.Upgrade:
+		args = []string{"dist-upgrade"}
+	default:
+		args = []string{"upgrade"}
+	}
+	args = append(args, "-y", "-V")
+	args = append(args, dpkgConfOptions...)
+	if params.ShowDetails {
+		args = append(args, "-s")
+	}
+	// apt selects the candidates by a single target release
+	switch len(params.Repos) {
+	case 0:
+	case 1:
+		release, err := dpkg.targetRelease(ctx, params.Repos[0])
+		if err != nil {
+			return syspackage.UpdateResult{}, err
+		}
+		args = append(args, "-t", release)
+	default:
+		return syspackage.UpdateResult{}, fmt.Errorf("apt-get can only update from a single repository")
+	}
+	if params.Name != "" {
+		args = append(args, params.Name)
+	}
+	cmd, err := dpkg.aptGet(args...)
+	if err != nil {
+		return syspackage.UpdateResult{}, err
+	}
+	output, err := syspackage.RunWithProgress(ctx, request, dpkg.runner, cmd)
+	if err != nil {
+		return syspackage.UpdateResult{RawOutput: output}, fmt.Errorf("apt-get %s failed: %w, output: %s", args[0], err, output)
+	}
+	return syspackage.ParseAptUpdateOutput(output), nil
 }
@@ -1,11 +1,14 @@
 package dpkg
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 	"github.com/suse/managesw-mcp/internal/pkg/testenv"
 )
@@ -23,10 +26,11 @@ func TestDpkgSearchPackage(t *testing.T) {
 
 	// Mock dpkg-query to simulate listing installed packages
 	dpkgQueryMock := `#!/bin/sh
+case "$1" in --admindir=*) shift ;; esac
 if [ "$1" = "-W" ] && [ "$2" = "-f" ]; then
     # We are querying installed packages.
     # Return one matching package: "test-pkg"
-    echo "test-pkg,1.2.3-1,1024"
+    printf 'test-pkg\ttest-pkg\t1.2.3-1\tamd64\t1024\t\ttest\n'
 fi
 `
 	env.WriteFile("bin/dpkg-query", dpkgQueryMock)
@@ -35,6 +39,9 @@ fi
 
 	// Mock apt-cache to simulate search and madison
 	aptCacheMock := `#!/bin/sh
+if [ "$1" = "-o" ] && [ "$2" = "RootDir=` + env.GetPath("") + `" ]; then
+    shift 2
+fi
 if [ "$1" = "search" ]; then
     # Return list of matching packages
     echo "test-pkg - A test package description"
@@ -53,12 +60,9 @@ fi
 	d := New("dpkg", env.GetPath("bin/dpkg-query"), env.GetPath("bin/apt-cache"), env.GetPath(""))
 
 	// Search for packages matching "test"
-	pkgsAny, err := d.SearchPackageSysCall(syspackage.SearchPackageParams{Name: "test"})
+	pkgs, err := d.SearchPackageSysCall(context.Background(), nil, syspackage.SearchPackageParams{Name: "test"})
 	require.NoError(t, err)
 
-	pkgs, ok := pkgsAny.(map[string]map[string][]syspackage.SearchedPackage)
-	require.True(t, ok, "Expected search output to be map[string]map[string][]syspackage.SearchedPackage")
-
 	// Verify available packages from repository
 	assert.Contains(t, pkgs, "http://deb.debian.org/debian")
 	assert.Contains(t, pkgs["http://deb.debian.org/debian"], "amd64")
@@ -112,7 +116,7 @@ echo "Mock apt-get update called with: $@"
 	d := New("dpkg", "dpkg", "apt-cache", env.GetPath(""))
 
 	// 1. List repos when none exist
-	repos, err := d.ListReposSysCall("")
+	repos, err := d.ListReposSysCall(context.Background(), nil, "")
 	require.NoError(t, err)
 	assert.Empty(t, repos)
 
@@ -121,38 +125,40 @@ echo "Mock apt-get update called with: $@"
 		Name: "test-repo",
 		Url:  "http://example.com/debian",
 	}
-	repo, err := d.ModifyRepoSysCall(addParams)
+	repo, err := d.ModifyRepoSysCall(context.Background(), nil, addParams)
 	require.NoError(t, err)
-	assert.Equal(t, "test-repo", repo["alias"])
-	assert.Equal(t, "1", repo["enabled"])
-	assert.Equal(t, "http://example.com/debian", repo["url"])
+	assert.Equal(t, "test-repo", repo.ID)
+	assert.True(t, repo.Enabled)
+	assert.Equal(t, []string{"http://example.com/debian"}, repo.URLs)
+	assert.True(t, repo.GPGCheck)
+	assert.Equal(t, env.GetPath("etc/apt/sources.list.d/test-repo.list"), repo.SourceFile)
 
 	// 3. Verify repo exists in list
-	repos, err = d.ListReposSysCall("")
+	repos, err = d.ListReposSysCall(context.Background(), nil, "")
 	require.NoError(t, err)
 	require.Len(t, repos, 1)
-	assert.Equal(t, "test-repo", repos[0]["alias"])
+	assert.Equal(t, "test-repo", repos[0].ID)
 
 	// 4. Disable repository
 	disableParams := syspackage.ModifyRepoParams{
 		Name:    "test-repo",
 		Disable: true,
 	}
-	repo, err = d.ModifyRepoSysCall(disableParams)
+	repo, err = d.ModifyRepoSysCall(context.Background(), nil, disableParams)
 	require.NoError(t, err)
-	assert.Equal(t, "0", repo["enabled"])
+	assert.False(t, repo.Enabled)
 
 	// 5. Enable repository
 	enableParams := syspackage.ModifyRepoParams{
 		Name:    "test-repo",
 		Disable: false,
 	}
-	repo, err = d.ModifyRepoSysCall(enableParams)
+	repo, err = d.ModifyRepoSysCall(context.Background(), nil, enableParams)
 	require.NoError(t, err)
-	assert.Equal(t, "1", repo["enabled"])
+	assert.True(t, repo.Enabled)
 
 	// 6. Refresh repositories
-	err = d.RefreshReposSysCall("test-repo")
+	err = d.RefreshReposSysCall(context.Background(), nil, "test-repo")
 	require.NoError(t, err)
 
 	// 7. Remove repository
@@ -160,11 +166,11 @@ echo "Mock apt-get update called with: $@"
 		Name:        "test-repo",
 		RemoveRepos: true,
 	}
-	_, err = d.ModifyRepoSysCall(removeParams)
+	_, err = d.ModifyRepoSysCall(context.Background(), nil, removeParams)
 	require.NoError(t, err)
 
 	// 8. Verify repository is removed
-	repos, err = d.ListReposSysCall("")
+	repos, err = d.ListReposSysCall(context.Background(), nil, "")
 	require.NoError(t, err)
 	assert.Empty(t, repos)
 }
@@ -182,6 +188,7 @@ func TestDpkgQueryPackage(t *testing.T) {
 
 	// Mock dpkg-query to simulate info and changelog querying
 	dpkgQueryMock := `#!/bin/sh
+case "$1" in --admindir=*) shift ;; esac
 if [ "$1" = "-s" ] && [ "$2" = "test-pkg" ]; then
     echo "Package: test-pkg"
     echo "Status: install ok installed"
@@ -201,14 +208,14 @@ fi
 	d := New("dpkg", env.GetPath("bin/dpkg-query"), "apt-cache", env.GetPath(""))
 
 	// 1. Query info without changelog (lines = 0)
-	res, err := d.QueryPackageSysCall("test-pkg", syspackage.Info, 0)
+	res, err := d.QueryPackageSysCall(context.Background(), nil, "test-pkg", syspackage.Info, 0)
 	require.NoError(t, err)
 	assert.Equal(t, "test-pkg", res["Package"])
 	assert.Equal(t, "install ok installed", res["Status"])
 	assert.Nil(t, res["changelog"])
 
 	// 2. Query info with changelog (lines = 2)
-	resWithChange, err := d.QueryPackageSysCall("test-pkg", syspackage.Info, 2)
+	resWithChange, err := d.QueryPackageSysCall(context.Background(), nil, "test-pkg", syspackage.Info, 2)
 	require.NoError(t, err)
 	assert.Equal(t, "test-pkg", resWithChange["Package"])
 
@@ -218,3 +225,207 @@ fi
 	assert.Equal(t, "test-pkg (1.2.3-1) unstable", changelog[0])
 	assert.Equal(t, "  * Fix some bug", changelog[1])
 }
+
+func TestDpkgListInstalledPackages(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	binDir := env.GetPath("bin")
+	env.MkdirAll("bin")
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", binDir)
+	defer os.Setenv("PATH", oldPath)
+
+	// Mock dpkg-query with a multiarch library installed for two architectures
+	dpkgQueryMock := `#!/bin/sh
+echo "$1" > "` + env.GetPath("admindir.log") + `"
+case "$1" in --admindir=*) shift ;; esac
+if [ "$1" = "-W" ] && [ "$2" = "-f" ]; then
+    printf 'libc6:amd64\tlibc6\t2.36-9+deb12u4\tamd64\t12000\tDebian\tglibc\n'
+    printf 'libc6:i386\tlibc6\t2.36-9+deb12u4\ti386\t11000\tDebian\tglibc\n'
+    printf 'vim\tvim\t2:9.0.1378-2\tamd64\t3000\t\tvim\n'
+fi
+`
+	env.WriteFile("bin/dpkg-query", dpkgQueryMock)
+	err := os.Chmod(env.GetPath("bin/dpkg-query"), 0755)
+	require.NoError(t, err)
+
+	env.WriteFile("var/lib/dpkg/info/libc6:amd64.list", "/.\n")
+	installed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = os.Chtimes(env.GetPath("var/lib/dpkg/info/libc6:amd64.list"), installed, installed)
+	require.NoError(t, err)
+
+	d := New("dpkg", env.GetPath("bin/dpkg-query"), "apt-cache", env.GetPath(""))
+	pkgs, err := d.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 3)
+	admindir, err := os.ReadFile(env.GetPath("admindir.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "--admindir="+env.GetPath("var/lib/dpkg")+"\n", string(admindir))
+
+	assert.Equal(t, "libc6", pkgs[0].Name)
+	assert.Equal(t, "amd64", pkgs[0].Arch)
+	assert.Equal(t, "2.36", pkgs[0].Version)
+	assert.Equal(t, "9+deb12u4", pkgs[0].Release)
+	assert.Equal(t, "Debian", pkgs[0].Vendor)
+	assert.Equal(t, "glibc", pkgs[0].SourcePackage)
+	assert.True(t, installed.Equal(pkgs[0].InstallTime))
+
+	assert.Equal(t, "libc6", pkgs[1].Name)
+	assert.Equal(t, "i386", pkgs[1].Arch)
+	assert.True(t, pkgs[1].InstallTime.IsZero())
+
+	assert.Equal(t, 2, pkgs[2].Epoch)
+	assert.Equal(t, "9.0.1378", pkgs[2].Version)
+	assert.Equal(t, "2:9.0.1378-2", pkgs[2].EVR())
+}
+
+const aptUpgradeSimulation = `Reading package lists...
+Building dependency tree...
+Calculating upgrade...
+The following packages will be upgraded:
+   libc6 libc6:i386 libssl3 tzdata
+Inst libssl3 [3.0.11-1~deb12u1] (3.0.11-1~deb12u2 Debian-Security:12/stable-security [amd64])
+Inst libc6 [2.36-9+deb12u3] (2.36-9+deb12u4 Debian:12.5/stable, Debian-Security:12/stable-security [amd64])
+Inst libc6:i386 [2.36-9+deb12u3] (2.36-9+deb12u4 Debian:12.5/stable, Debian-Security:12/stable-security [i386])
+Inst tzdata [2023c-5] (2024a-0+deb12u1 Debian:12.5/stable-updates [all])
+Conf libssl3 (3.0.11-1~deb12u2 Debian-Security:12/stable-security [amd64])
+Conf tzdata (2024a-0+deb12u1 Debian:12.5/stable-updates [all])
+`
+
+// TestInstallTimeWithoutRoot reads the install time from the database of
+// the host, which is used if no root is set.
+func TestInstallTimeWithoutRoot(t *testing.T) {
+	if _, err := os.Stat("/var/lib/dpkg/info/dpkg.list"); err != nil {
+		t.Skip("dpkg is not installed on the host")
+	}
+	// the database must not be looked up relative to the working directory
+	t.Chdir(t.TempDir())
+	d := New("dpkg", "dpkg-query", "apt-cache", "")
+	assert.False(t, d.installTime("dpkg").IsZero())
+}
+
+func TestParseAptSimulation(t *testing.T) {
+	upgrades := parseAptSimulation(aptUpgradeSimulation)
+	require.Len(t, upgrades, 4)
+	assert.Equal(t, aptUpgrade{
+		Name:       "libssl3",
+		OldVersion: "3.0.11-1~deb12u1",
+		Version:    "3.0.11-1~deb12u2",
+		Arch:       "amd64",
+		Origin:     "Debian-Security",
+		Suite:      "stable-security",
+	}, upgrades[0])
+	// the security archive is preferred over the release
+	assert.Equal(t, "stable-security", upgrades[1].Suite)
+	assert.Equal(t, "libc6:i386", upgrades[2].Name)
+	assert.Equal(t, "i386", upgrades[2].Arch)
+	assert.Equal(t, "stable-updates", upgrades[3].Suite)
+
+	patches := groupAptUpgrades(upgrades)
+	require.Len(t, patches, 2)
+	assert.Equal(t, "Debian-Security/stable-security", patches[0].Name)
+	assert.Equal(t, "security", patches[0].Category)
+	assert.Equal(t, "important", patches[0].Severity)
+	assert.Len(t, patches[0].Upgrades, 3)
+	assert.Equal(t, "Debian/stable-updates", patches[1].Name)
+	assert.Equal(t, "recommended", patches[1].Category)
+	assert.Equal(t, "moderate", patches[1].Severity)
+}
+
+// newAptGetFixture returns a backend on root replaying the recorded apt-get
+// transactions.
+func newAptGetFixture(t *testing.T, env *testenv.TestEnv, root string) DPKG {
+	replayer, err := cmdrunner.LoadReplayer("testdata/apt-get.json", cmdrunner.Vars{"ROOT": env.GetPath("root")})
+	require.NoError(t, err)
+	return New("dpkg", "dpkg-query", "apt-cache", root).WithAptGet("/usr/bin/apt-get").WithRunner(replayer)
+}
+
+func TestDpkgInstallPatches(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	d := newAptGetFixture(t, env, "")
+
+	patches, err := d.ListPatchesSysCall(context.Background(), nil, syspackage.ListPatchesParams{})
+	require.NoError(t, err)
+	require.Len(t, patches, 2)
+	assert.Equal(t, "needed", patches[0]["status"])
+	assert.Equal(t, []string{"libssl3_3.0.11-1~deb12u2_amd64", "libc6_2.36-9+deb12u4_amd64", "libc6:i386_2.36-9+deb12u4_i386"}, patches[0]["packages"])
+
+	patches, err = d.ListPatchesSysCall(context.Background(), nil, syspackage.ListPatchesParams{Severity: "moderate"})
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+	assert.Equal(t, "Debian/stable-updates", patches[0]["name"])
+
+	// the fixture only holds the upgrade of the versions of the security patch
+	result, err := d.InstallPatchesSysCall(context.Background(), nil, syspackage.InstallPatchesParams{Category: "security", ShowDetails: true})
+	require.NoError(t, err)
+	require.Len(t, result.Patches, 1)
+	assert.Equal(t, "needed", result.Patches[0]["status"])
+	require.NotNil(t, result.Changes)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "libc6", Version: "2.36-9+deb12u4", OldVersion: "2.36-9+deb12u3"},
+		{Name: "libc6", Version: "2.36-9+deb12u4", OldVersion: "2.36-9+deb12u3", Arch: "i386"},
+		{Name: "libssl3", Version: "3.0.11-1~deb12u2", OldVersion: "3.0.11-1~deb12u1"},
+	}, result.Changes.Upgraded)
+
+	result, err = d.InstallPatchesSysCall(context.Background(), nil, syspackage.InstallPatchesParams{Category: "security"})
+	require.NoError(t, err)
+	require.Len(t, result.Patches, 1)
+	assert.Equal(t, "applied", result.Patches[0]["status"])
+	assert.Nil(t, result.Changes)
+}
+
+func TestDpkgInstallAndUpdatePackage(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	d := newAptGetFixture(t, env, "")
+
+	// debconf has no terminal to ask on
+	cmd, err := d.aptGet("install")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DEBIAN_FRONTEND=noninteractive"}, cmd.Env)
+
+	install, err := d.InstallPackageSysCall(context.Background(), nil, syspackage.InstallPackageParams{
+		Name:         "foo",
+		Version:      "1.0-1",
+		FromRepo:     "bookworm-backports",
+		NoRecommends: true,
+		ShowDetails:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "foo", Version: "1.0-1"}}, install.Installed)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "libfoo1", Version: "1.2-3"}}, install.Dependencies)
+
+	update, err := d.UpdatePackageSysCall(context.Background(), nil, syspackage.UpdatePackageParams{Upgrade: true})
+	require.NoError(t, err)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "bash", Version: "5.2.15-2+b2", OldVersion: "5.2.15-2"}}, update.Upgraded)
+
+	_, err = d.UpdatePackageSysCall(context.Background(), nil, syspackage.UpdatePackageParams{Name: "bash"})
+	require.NoError(t, err)
+
+	_, err = d.UpdatePackageSysCall(context.Background(), nil, syspackage.UpdatePackageParams{Repos: []string{"a", "b"}})
+	assert.Error(t, err)
+
+	output, err := d.RemovePackageSysCall(context.Background(), nil, syspackage.RemovePackageParams{Name: "foo", Purge: true, RemoveDeps: true})
+	require.NoError(t, err)
+	assert.Contains(t, output, "foo* (1.0-1)")
+
+	// apt-get and the dpkg called by it operate on the root
+	root := newAptGetFixture(t, env, env.GetPath("root"))
+	_, err = root.RemovePackageSysCall(context.Background(), nil, syspackage.RemovePackageParams{Name: "foo"})
+	require.NoError(t, err)
+
+	// repositories are selected by their suite
+	env.WriteFile("root/etc/apt/sources.list.d/backports.list", "deb http://deb.debian.org/debian bookworm-backports main\n")
+	env.WriteFile("root/etc/apt/sources.list.d/debian.sources", "Types: deb\nURIs: http://deb.debian.org/debian\nSuites: bookworm bookworm-updates\nComponents: main\n")
+	_, err = root.InstallPackageSysCall(context.Background(), nil, syspackage.InstallPackageParams{Name: "foo", FromRepo: "backports"})
+	require.NoError(t, err)
+	_, err = root.UpdatePackageSysCall(context.Background(), nil, syspackage.UpdatePackageParams{Repos: []string{"backports"}})
+	require.NoError(t, err)
+	_, err = root.InstallPackageSysCall(context.Background(), nil, syspackage.InstallPackageParams{Name: "foo", FromRepo: "debian"})
+	assert.EqualError(t, err, "repository debian has the suites 'bookworm bookworm-updates', apt-get can only select a single suite of a non-flat repository")
+}
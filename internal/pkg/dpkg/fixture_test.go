@@ -0,0 +1,43 @@
+package dpkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+	"github.com/suse/managesw-mcp/internal/pkg/testenv"
+)
+
+// TestAptFixture parses recorded apt-cache output, so it runs without apt
+// being installed.
+func TestAptFixture(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("var/lib/dpkg/status", dpkgStatus)
+
+	replayer, err := cmdrunner.LoadReplayer("testdata/apt.json", cmdrunner.Vars{"ROOT": env.GetPath("")})
+	require.NoError(t, err)
+	dpkg := New("/usr/bin/dpkg", "/usr/bin/dpkg-query", "/usr/bin/apt-cache", env.GetPath("")).WithRunner(replayer)
+	ctx := context.Background()
+
+	pkgs, err := dpkg.SearchPackageSysCall(ctx, nil, syspackage.SearchPackageParams{Name: "vim"})
+	require.NoError(t, err)
+	assert.Equal(t, syspackage.SearchResult{
+		"System": {"unknown": {{Name: "vim", Version: "2:9.0.1378-2", Status: "i"}}},
+		"http://deb.debian.org/debian": {"amd64": {
+			{Name: "vim", Version: "2:9.0.1378-2", Status: "v"},
+			{Name: "vim-tiny", Version: "2:9.0.1378-2", Status: "v"},
+		}},
+		"http://deb.debian.org/debian-security": {"amd64": {
+			{Name: "vim", Version: "2:9.0.1378-2+deb12u2", Status: "v"},
+			{Name: "vim-tiny", Version: "2:9.0.1378-2+deb12u2", Status: "v"},
+		}},
+	}, pkgs)
+
+	pkgs, err = dpkg.SearchPackageSysCall(ctx, nil, syspackage.SearchPackageParams{Name: "nonexistent"})
+	require.NoError(t, err)
+	assert.Empty(t, pkgs)
+}
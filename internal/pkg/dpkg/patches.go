@@ -0,0 +1,217 @@
+package dpkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+// aptUpgrade is a pending upgrade as printed by 'apt-get -s upgrade'.
+type aptUpgrade struct {
+	Name       string
+	OldVersion string
+	Version    string
+	Arch       string
+	Origin     string
+	Suite      string
+}
+
+// aptPatch is a synthesized patch, which are the pending upgrades coming
+// from the same origin and suite, e.g. all upgrades from
+// Debian-Security/bookworm-security.
+type aptPatch struct {
+	Name     string
+	Category string
+	Severity string
+	Upgrades []aptUpgrade
+}
+
+// parseAptSimulation parses the 'Inst' lines of a simulated apt-get run,
+// which look like
+//
+//	Inst libssl3 [3.0.11-1~deb12u1] (3.0.11-1~deb12u2 Debian-Security:12/stable-security [amd64])
+//
+// A package can be available from several archives, in which case a
+// security archive is preferred as it is the reason for the upgrade.
+func parseAptSimulation(output string) []aptUpgrade {
+	var upgrades []aptUpgrade
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		upgrade := aptUpgrade{Name: fields[1]}
+		if strings.HasPrefix(fields[2], "[") {
+			upgrade.OldVersion = strings.Trim(fields[2], "[]")
+		}
+		open := strings.Index(line, "(")
+		end := strings.LastIndex(line, ")")
+		if open == -1 || end < open {
+			continue
+		}
+		candidate := line[open+1 : end]
+		if idx := strings.LastIndex(candidate, " ["); idx != -1 {
+			upgrade.Arch = strings.Trim(candidate[idx+1:], "[]")
+			candidate = candidate[:idx]
+		}
+		version, archives, _ := strings.Cut(candidate, " ")
+		upgrade.Version = version
+		for _, archive := range strings.Split(archives, ",") {
+			archive = strings.TrimSpace(archive)
+			origin, rest, _ := strings.Cut(archive, ":")
+			suite := rest
+			if idx := strings.Index(rest, "/"); idx != -1 {
+				suite = rest[idx+1:]
+			}
+			if upgrade.Origin == "" || isSecurityArchive(origin, suite) {
+				upgrade.Origin = origin
+				upgrade.Suite = suite
+			}
+		}
+		upgrades = append(upgrades, upgrade)
+	}
+	return upgrades
+}
+
+func isSecurityArchive(origin string, suite string) bool {
+	return strings.HasSuffix(suite, "-security") || strings.Contains(strings.ToLower(origin), "security")
+}
+
+// archiveClassification derives the zypper like category and severity of the
+// upgrades of an archive from its suite.
+func archiveClassification(origin string, suite string) (category string, severity string) {
+	switch {
+	case isSecurityArchive(origin, suite):
+		return "security", "important"
+	case strings.HasSuffix(suite, "-backports"):
+		return "optional", "low"
+	case strings.HasSuffix(suite, "-proposed"):
+		return "optional", "low"
+	default:
+		return "recommended", "moderate"
+	}
+}
+
+// groupAptUpgrades groups the upgrades by their archive to patches, in the
+// order of their first appearance.
+func groupAptUpgrades(upgrades []aptUpgrade) []aptPatch {
+	var patches []aptPatch
+	index := make(map[string]int)
+	for _, upgrade := range upgrades {
+		name := upgrade.Origin + "/" + upgrade.Suite
+		i, exists := index[name]
+		if !exists {
+			i = len(patches)
+			index[name] = i
+			category, severity := archiveClassification(upgrade.Origin, upgrade.Suite)
+			patches = append(patches, aptPatch{Name: name, Category: category, Severity: severity})
+		}
+		patches[i].Upgrades = append(patches[i].Upgrades, upgrade)
+	}
+	return patches
+}
+
+// toMap converts the patch to the representation of a patch, using the
+// keys zypper uses for its patches where possible.
+func (patch aptPatch) toMap(status string) map[string]any {
+	var packages []string
+	for _, upgrade := range patch.Upgrades {
+		packages = append(packages, fmt.Sprintf("%s_%s_%s", upgrade.Name, upgrade.Version, upgrade.Arch))
+	}
+	return map[string]any{
+		"name":     patch.Name,
+		"status":   status,
+		"category": patch.Category,
+		"severity": patch.Severity,
+		"summary":  fmt.Sprintf("%d upgrades from %s", len(patch.Upgrades), patch.Name),
+		"packages": packages,
+	}
+}
+
+func (patch aptPatch) matches(category string, severity string) bool {
+	return (category == "" || strings.EqualFold(category, patch.Category)) &&
+		(severity == "" || strings.EqualFold(severity, patch.Severity))
+}
+
+// pendingPatches synthesizes the patches from a simulated upgrade, as apt has
+// no notion of patches, and returns the ones matching category and severity.
+func (dpkg DPKG) pendingPatches(ctx context.Context, category string, severity string) ([]aptPatch, error) {
+	cmd, err := dpkg.aptGet("-s", "upgrade")
+	if err != nil {
+		return nil, err
+	}
+	output, err := dpkg.run(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("apt-get upgrade simulation failed: %w, output: %s", err, string(output))
+	}
+	var patches []aptPatch
+	for _, patch := range groupAptUpgrades(parseAptSimulation(string(output))) {
+		if patch.matches(category, severity) {
+			patches = append(patches, patch)
+		}
+	}
+	return patches, nil
+}
+
+func (dpkg DPKG) ListPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPatchesParams) ([]map[string]any, error) {
+	patches, err := dpkg.pendingPatches(ctx, params.Category, params.Severity)
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]any
+	for _, patch := range patches {
+		result = append(result, patch.toMap("needed"))
+	}
+	return result, nil
+}
+
+// InstallPatchesSysCall upgrades the packages of the matching patches only,
+// so that e.g. just the security upgrades are installed.
+func (dpkg DPKG) InstallPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPatchesParams) (syspackage.InstallPatchesResult, error) {
+	patches, err := dpkg.pendingPatches(ctx, params.Category, params.Severity)
+	if err != nil {
+		return syspackage.InstallPatchesResult{}, err
+	}
+	if len(patches) == 0 {
+		return syspackage.InstallPatchesResult{}, nil
+	}
+
+	args := append([]string{"install", "-y", "--only-upgrade"}, dpkgConfOptions...)
+	status := "applied"
+	if params.ShowDetails {
+		args = append(args, "-V", "-s")
+		status = "needed"
+	}
+	for _, patch := range patches {
+		for _, upgrade := range patch.Upgrades {
+			args = append(args, upgrade.Name+"="+upgrade.Version)
+		}
+	}
+	cmd, err := dpkg.aptGet(args...)
+	if err != nil {
+		return syspackage.InstallPatchesResult{}, err
+	}
+	output, err := syspackage.RunWithProgress(ctx, request, dpkg.runner, cmd)
+	if err != nil {
+		return syspackage.InstallPatchesResult{}, fmt.Errorf("apt-get install failed: %w, output: %s", err, output)
+	}
+
+	var result syspackage.InstallPatchesResult
+	for _, patch := range patches {
+		result.Patches = append(result.Patches, patch.toMap(status))
+	}
+	if params.ShowDetails {
+		changes := syspackage.ParseAptUpdateOutput(output)
+		result.Changes = &changes
+	}
+	return result, nil
+}
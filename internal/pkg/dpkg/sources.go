@@ -0,0 +1,526 @@
+package dpkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+// aptEntry is a single source entry, which is a line of a one-line style
+// .list file or a stanza of a deb822 style .sources file.
+type aptEntry struct {
+	types      []string
+	uris       []string
+	suites     []string
+	components []string
+	signedBy   []string
+	// options of a one-line entry like 'arch=amd64', which are kept when
+	// the line is rewritten
+	options []string
+	name    string
+	enabled bool
+	trusted bool
+	// first and last line of the entry in the file
+	first int
+	last  int
+}
+
+// aptSourcesFile is a sources file with its entries. All lines are kept, so
+// that a single entry can be modified without touching the rest of the file.
+type aptSourcesFile struct {
+	path    string
+	deb822  bool
+	lines   []string
+	entries []aptEntry
+}
+
+func newAptSourcesFile(path string) *aptSourcesFile {
+	return &aptSourcesFile{path: path, deb822: strings.HasSuffix(path, ".sources")}
+}
+
+func readAptSources(path string) (*aptSourcesFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := newAptSourcesFile(path)
+	if text := strings.TrimSuffix(string(content), "\n"); text != "" {
+		file.lines = strings.Split(text, "\n")
+	}
+	file.parse()
+	return file, nil
+}
+
+func (file *aptSourcesFile) write() error {
+	content := strings.Join(file.lines, "\n") + "\n"
+	if err := os.WriteFile(file.path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write repository file: %w", err)
+	}
+	return nil
+}
+
+// parse (re)creates the entries from the lines, which must be called after
+// every modification of the lines.
+func (file *aptSourcesFile) parse() {
+	file.entries = nil
+	if file.deb822 {
+		file.parseDeb822()
+		return
+	}
+	for i, line := range file.lines {
+		if entry, ok := parseOneLineEntry(line); ok {
+			entry.first, entry.last = i, i
+			file.entries = append(file.entries, entry)
+		}
+	}
+}
+
+// parseOneLineEntry parses a line like
+//
+//	deb [arch=amd64 signed-by=/usr/share/keyrings/foo.gpg] http://deb.example.com stable main
+//
+// Commented out entries are returned as disabled.
+func parseOneLineEntry(line string) (aptEntry, bool) {
+	entry := aptEntry{enabled: true}
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "#") {
+		entry.enabled = false
+		trimmed = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+	}
+	fields := strings.Fields(trimmed)
+	if len(fields) < 3 || (fields[0] != "deb" && fields[0] != "deb-src") {
+		return entry, false
+	}
+	entry.types = []string{fields[0]}
+	rest := fields[1:]
+	if strings.HasPrefix(rest[0], "[") {
+		for len(rest) > 0 {
+			option := rest[0]
+			rest = rest[1:]
+			closing := strings.HasSuffix(option, "]")
+			if option = strings.Trim(option, "[]"); option != "" {
+				entry.options = append(entry.options, option)
+			}
+			if closing {
+				break
+			}
+		}
+	}
+	if len(rest) < 2 {
+		return entry, false
+	}
+	entry.uris = []string{rest[0]}
+	entry.suites = []string{rest[1]}
+	entry.components = rest[2:]
+	for _, option := range entry.options {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "trusted":
+			entry.trusted = value == "yes"
+		case "signed-by":
+			entry.signedBy = append(entry.signedBy, strings.Split(value, ",")...)
+		}
+	}
+	return entry, true
+}
+
+// oneLine formats the entry as line of a .list file
+func (entry aptEntry) oneLine() string {
+	fields := []string{entry.types[0]}
+	if len(entry.options) > 0 {
+		fields = append(fields, "["+strings.Join(entry.options, " ")+"]")
+	}
+	fields = append(fields, entry.uris[0])
+	fields = append(fields, entry.suites...)
+	fields = append(fields, entry.components...)
+	line := strings.Join(fields, " ")
+	if !entry.enabled {
+		line = "# " + line
+	}
+	return line
+}
+
+// setOption sets or, for an empty value, removes an option of a one-line entry
+func (entry *aptEntry) setOption(key string, value string) {
+	var options []string
+	for _, option := range entry.options {
+		if optKey, _, _ := strings.Cut(option, "="); optKey != key {
+			options = append(options, option)
+		}
+	}
+	if value != "" {
+		options = append(options, key+"="+value)
+	}
+	entry.options = options
+}
+
+// parseDeb822 parses the stanzas of a .sources file, which are separated by
+// empty lines. Values can be continued on lines starting with whitespace,
+// which is used for embedded keys in Signed-By.
+func (file *aptSourcesFile) parseDeb822() {
+	var values map[string]string
+	first, last := -1, -1
+	lastKey := ""
+	flush := func() {
+		if first != -1 {
+			file.entries = append(file.entries, deb822Entry(values, first, last))
+		}
+		first, last, lastKey = -1, -1, ""
+	}
+	for i, line := range file.lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if first == -1 {
+			first = i
+			values = make(map[string]string)
+		}
+		last = i
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if lastKey != "" {
+				values[lastKey] += "\n" + trimmed
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		lastKey = strings.ToLower(strings.TrimSpace(key))
+		values[lastKey] = strings.TrimSpace(value)
+	}
+	flush()
+}
+
+func deb822Entry(values map[string]string, first int, last int) aptEntry {
+	entry := aptEntry{
+		types:      strings.Fields(values["types"]),
+		uris:       strings.Fields(values["uris"]),
+		suites:     strings.Fields(values["suites"]),
+		components: strings.Fields(values["components"]),
+		name:       values["x-repolib-name"],
+		enabled:    values["enabled"] == "" || values["enabled"] == "yes",
+		trusted:    values["trusted"] == "yes",
+		first:      first,
+		last:       last,
+	}
+	if signedBy := values["signed-by"]; strings.Contains(signedBy, "BEGIN PGP PUBLIC KEY BLOCK") {
+		entry.signedBy = []string{"inline"}
+	} else {
+		entry.signedBy = strings.Fields(signedBy)
+	}
+	return entry
+}
+
+// setField sets or, for an empty value, removes the field of a deb822 entry.
+// Continuation lines of the old value are removed.
+func (file *aptSourcesFile) setField(index int, key string, value string) {
+	entry := file.entries[index]
+	var lines []string
+	lines = append(lines, file.lines[:entry.first]...)
+	replaced := false
+	inField := false
+	for _, line := range file.lines[entry.first : entry.last+1] {
+		if inField && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			continue
+		}
+		inField = false
+		lineKey, _, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(lineKey), key) {
+			inField = true
+			if value != "" && !replaced {
+				lines = append(lines, key+": "+value)
+				replaced = true
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if value != "" && !replaced {
+		lines = append(lines, key+": "+value)
+	}
+	lines = append(lines, file.lines[entry.last+1:]...)
+	file.lines = lines
+	file.parse()
+}
+
+func (file *aptSourcesFile) hasField(index int, key string) bool {
+	entry := file.entries[index]
+	for _, line := range file.lines[entry.first : entry.last+1] {
+		if lineKey, _, found := strings.Cut(line, ":"); found && strings.EqualFold(strings.TrimSpace(lineKey), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// addEntry appends an entry for url, which is either just the URI of a flat
+// repository or 'uri suite [component...]'.
+func (file *aptSourcesFile) addEntry(url string) {
+	fields := strings.Fields(url)
+	if len(fields) == 1 && !strings.HasSuffix(fields[0], "./") {
+		fields = append(fields, "./")
+	}
+	if file.deb822 {
+		if len(file.lines) > 0 {
+			file.lines = append(file.lines, "")
+		}
+		file.lines = append(file.lines, "Types: deb", "URIs: "+fields[0])
+		if len(fields) > 1 {
+			file.lines = append(file.lines, "Suites: "+fields[1])
+		}
+		if len(fields) > 2 {
+			file.lines = append(file.lines, "Components: "+strings.Join(fields[2:], " "))
+		}
+	} else {
+		file.lines = append(file.lines, "deb "+strings.Join(fields, " "))
+	}
+	file.parse()
+}
+
+// modifyEntry enables or disables an entry, sets whether it is trusted and
+// replaces its URI, suite and components if url is given.
+func (file *aptSourcesFile) modifyEntry(index int, enabled bool, trusted bool, url string) {
+	fields := strings.Fields(url)
+	if !file.deb822 {
+		entry := file.entries[index]
+		entry.enabled = enabled
+		if trusted {
+			entry.setOption("trusted", "yes")
+		} else {
+			entry.setOption("trusted", "")
+		}
+		if len(fields) > 0 {
+			entry.uris = fields[:1]
+		}
+		if len(fields) > 1 {
+			entry.suites = fields[1:2]
+			entry.components = fields[2:]
+		}
+		file.lines[entry.first] = entry.oneLine()
+		file.parse()
+		return
+	}
+	if !enabled {
+		file.setField(index, "Enabled", "no")
+	} else if file.hasField(index, "Enabled") {
+		file.setField(index, "Enabled", "yes")
+	}
+	if trusted {
+		file.setField(index, "Trusted", "yes")
+	} else {
+		file.setField(index, "Trusted", "")
+	}
+	if len(fields) > 0 {
+		file.setField(index, "URIs", fields[0])
+	}
+	if len(fields) > 1 {
+		file.setField(index, "Suites", fields[1])
+		file.setField(index, "Components", strings.Join(fields[2:], " "))
+	}
+}
+
+// removeEntry removes the lines of an entry, for deb822 together with the
+// empty line separating it from the next stanza.
+func (file *aptSourcesFile) removeEntry(index int) {
+	entry := file.entries[index]
+	last := entry.last
+	if file.deb822 && last+1 < len(file.lines) && strings.TrimSpace(file.lines[last+1]) == "" {
+		last++
+	}
+	file.lines = append(file.lines[:entry.first], file.lines[last+1:]...)
+	file.parse()
+}
+
+// repoID returns the ID of the entry with index in a file with count entries.
+// Files with a single entry are identified by their alias, the entries of
+// other files by 'alias:N' starting at 1.
+func repoID(alias string, index int, count int) string {
+	if count == 1 {
+		return alias
+	}
+	return fmt.Sprintf("%s:%d", alias, index+1)
+}
+
+// splitRepoID splits an ID into the alias and the index of the entry, which
+// is -1 if the ID refers to the whole file.
+func splitRepoID(id string) (alias string, index int) {
+	if idx := strings.LastIndex(id, ":"); idx != -1 {
+		if n, err := strconv.Atoi(id[idx+1:]); err == nil && n > 0 {
+			return id[:idx], n - 1
+		}
+	}
+	return id, -1
+}
+
+func (entry aptEntry) repository(id string, alias string, path string) syspackage.Repository {
+	name := alias
+	if entry.name != "" {
+		name = entry.name
+	}
+	return syspackage.Repository{
+		ID:         id,
+		Name:       name,
+		URLs:       entry.uris,
+		Enabled:    entry.enabled,
+		GPGCheck:   !entry.trusted,
+		Type:       strings.Join(entry.types, " "),
+		Keys:       entry.signedBy,
+		SourceFile: path,
+		Suites:     entry.suites,
+		Components: entry.components,
+	}
+}
+
+func (dpkg DPKG) RepoConfigPaths() []string {
+	return []string{
+		filepath.Join("/", dpkg.root, "etc/apt/sources.list"),
+		filepath.Join("/", dpkg.root, "etc/apt/sources.list.d"),
+	}
+}
+
+// sourcesPath returns the sources file of alias. New files are created in the
+// one-line format.
+func (dpkg DPKG) sourcesPath(alias string) string {
+	if alias == "sources.list" {
+		return filepath.Join("/", dpkg.root, "etc/apt/sources.list")
+	}
+	base := filepath.Join("/", dpkg.root, "etc/apt/sources.list.d", alias)
+	if _, err := os.Stat(base + ".sources"); err == nil {
+		if _, err := os.Stat(base + ".list"); err != nil {
+			return base + ".sources"
+		}
+	}
+	return base + ".list"
+}
+
+func (dpkg DPKG) getRepos() ([]syspackage.Repository, error) {
+	var repos []syspackage.Repository
+	addFile := func(alias string, path string) {
+		file, err := readAptSources(path)
+		if err != nil {
+			return
+		}
+		for i, entry := range file.entries {
+			repos = append(repos, entry.repository(repoID(alias, i, len(file.entries)), alias, path))
+		}
+	}
+
+	addFile("sources.list", filepath.Join("/", dpkg.root, "etc/apt/sources.list"))
+
+	sourcesListDDir := filepath.Join("/", dpkg.root, "etc/apt/sources.list.d")
+	files, err := os.ReadDir(sourcesListDDir)
+	if err == nil {
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			ext := filepath.Ext(file.Name())
+			if ext == ".list" || ext == ".sources" {
+				addFile(strings.TrimSuffix(file.Name(), ext), filepath.Join(sourcesListDDir, file.Name()))
+			}
+		}
+	}
+
+	return repos, nil
+}
+
+// ListReposSysCall lists the repositories with the given ID or all entries of
+// the sources file with the given alias.
+func (dpkg DPKG) ListReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) ([]syspackage.Repository, error) {
+	allRepos, err := dpkg.getRepos()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return allRepos, nil
+	}
+	var filtered []syspackage.Repository
+	for _, repo := range allRepos {
+		if alias, _ := splitRepoID(repo.ID); repo.ID == name || alias == name {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered, nil
+}
+
+// ModifyRepoSysCall modifies a single entry if the name is 'alias:N' and all
+// entries of the sources file otherwise. The other lines of the file are
+// kept as they are. A new entry is appended if the entry doesn't exist.
+func (dpkg DPKG) ModifyRepoSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ModifyRepoParams) (*syspackage.Repository, error) {
+	if params.Name == "" {
+		return nil, fmt.Errorf("repository name is required")
+	}
+	alias, index := splitRepoID(params.Name)
+	filePath := dpkg.sourcesPath(alias)
+
+	file, err := readAptSources(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read repository file: %w", err)
+	}
+
+	if params.RemoveRepos {
+		if index == -1 || file == nil {
+			_ = os.Remove(filePath)
+			return nil, nil
+		}
+		if index >= len(file.entries) {
+			return nil, fmt.Errorf("repository %s not found", params.Name)
+		}
+		file.removeEntry(index)
+		return nil, file.write()
+	}
+
+	if file == nil {
+		dir := filepath.Dir(filePath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+		file = newAptSourcesFile(filePath)
+	}
+
+	var indices []int
+	switch {
+	case index == -1 && len(file.entries) > 0:
+		if params.Url != "" && len(file.entries) > 1 {
+			return nil, fmt.Errorf("repository %s has %d entries, use %s:N to change the URL of one", params.Name, len(file.entries), alias)
+		}
+		for i := range file.entries {
+			indices = append(indices, i)
+		}
+	case index >= 0 && index < len(file.entries):
+		indices = []int{index}
+	default:
+		if params.Url == "" {
+			return nil, fmt.Errorf("repository URL is required")
+		}
+		file.addEntry(params.Url)
+		indices = []int{len(file.entries) - 1}
+	}
+	for _, i := range indices {
+		file.modifyEntry(i, !params.Disable, params.NoGPGCheck, params.Url)
+	}
+	if err := file.write(); err != nil {
+		return nil, err
+	}
+
+	repos, err := dpkg.ListReposSysCall(ctx, request, repoID(alias, indices[0], len(file.entries)))
+	if err != nil {
+		return nil, err
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("could not get repository %s after modification", params.Name)
+	}
+	return &repos[0], nil
+}
@@ -0,0 +1,161 @@
+package dpkg
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+	"github.com/suse/managesw-mcp/internal/pkg/testenv"
+)
+
+const ubuntuSources = `# Ubuntu sources have moved to /etc/apt/sources.list.d/ubuntu.sources
+Types: deb deb-src
+URIs: http://archive.ubuntu.com/ubuntu/
+Suites: noble noble-updates noble-backports
+Components: main restricted universe multiverse
+Signed-By: /usr/share/keyrings/ubuntu-archive-keyring.gpg
+
+Types: deb
+URIs: http://security.ubuntu.com/ubuntu/
+Suites: noble-security
+Components: main restricted universe multiverse
+Signed-By:
+ -----BEGIN PGP PUBLIC KEY BLOCK-----
+ .
+ mQINBFufwdoBEADv/Gxytx/LcSXYuM0MwKojbBye81s0G1nEx+lz6VAUpIUZnbkq
+ -----END PGP PUBLIC KEY BLOCK-----
+`
+
+const debianSourcesList = `deb http://deb.debian.org/debian bookworm main contrib
+deb-src http://deb.debian.org/debian bookworm main contrib
+# deb [arch=amd64 signed-by=/usr/share/keyrings/debian.gpg] http://deb.debian.org/debian bookworm-backports main
+# This is a comment, not a repository
+`
+
+func TestAptSourcesList(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	env.WriteFile("etc/apt/sources.list", debianSourcesList)
+	env.WriteFile("etc/apt/sources.list.d/ubuntu.sources", ubuntuSources)
+	env.WriteFile("etc/apt/sources.list.d/single.list", "deb [trusted=yes] http://example.com/debian ./\n")
+
+	d := New("dpkg", "dpkg", "apt-cache", env.GetPath(""))
+	repos, err := d.ListReposSysCall(context.Background(), nil, "")
+	require.NoError(t, err)
+	require.Len(t, repos, 6)
+
+	assert.Equal(t, "sources.list:1", repos[0].ID)
+	assert.Equal(t, "deb", repos[0].Type)
+	assert.Equal(t, []string{"bookworm"}, repos[0].Suites)
+	assert.Equal(t, []string{"main", "contrib"}, repos[0].Components)
+	assert.Equal(t, "deb-src", repos[1].Type)
+	assert.Equal(t, "sources.list:3", repos[2].ID)
+	assert.False(t, repos[2].Enabled)
+	assert.Equal(t, []string{"/usr/share/keyrings/debian.gpg"}, repos[2].Keys)
+
+	assert.Equal(t, "single", repos[3].ID)
+	assert.False(t, repos[3].GPGCheck)
+
+	assert.Equal(t, "ubuntu:1", repos[4].ID)
+	assert.Equal(t, "deb deb-src", repos[4].Type)
+	assert.Equal(t, []string{"http://archive.ubuntu.com/ubuntu/"}, repos[4].URLs)
+	assert.Equal(t, []string{"noble", "noble-updates", "noble-backports"}, repos[4].Suites)
+	assert.Equal(t, []string{"/usr/share/keyrings/ubuntu-archive-keyring.gpg"}, repos[4].Keys)
+	assert.True(t, repos[4].Enabled)
+	assert.Equal(t, env.GetPath("etc/apt/sources.list.d/ubuntu.sources"), repos[4].SourceFile)
+	assert.Equal(t, "ubuntu:2", repos[5].ID)
+	assert.Equal(t, []string{"inline"}, repos[5].Keys)
+
+	repos, err = d.ListReposSysCall(context.Background(), nil, "ubuntu")
+	require.NoError(t, err)
+	assert.Len(t, repos, 2)
+}
+
+func TestAptSourcesModifyEntry(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	env.WriteFile("etc/apt/sources.list", debianSourcesList)
+	env.WriteFile("etc/apt/sources.list.d/ubuntu.sources", ubuntuSources)
+	d := New("dpkg", "dpkg", "apt-cache", env.GetPath(""))
+
+	// disable a single deb822 stanza, the embedded key must be kept
+	repo, err := d.ModifyRepoSysCall(context.Background(), nil, syspackage.ModifyRepoParams{Name: "ubuntu:2", Disable: true})
+	require.NoError(t, err)
+	assert.Equal(t, "ubuntu:2", repo.ID)
+	assert.False(t, repo.Enabled)
+	content, err := os.ReadFile(env.GetPath("etc/apt/sources.list.d/ubuntu.sources"))
+	require.NoError(t, err)
+	assert.Equal(t, ubuntuSources+"Enabled: no\n", string(content))
+
+	// enabling it again keeps the field
+	repo, err = d.ModifyRepoSysCall(context.Background(), nil, syspackage.ModifyRepoParams{Name: "ubuntu:2", NoGPGCheck: true})
+	require.NoError(t, err)
+	assert.True(t, repo.Enabled)
+	assert.False(t, repo.GPGCheck)
+	content, err = os.ReadFile(env.GetPath("etc/apt/sources.list.d/ubuntu.sources"))
+	require.NoError(t, err)
+	assert.Equal(t, ubuntuSources+"Enabled: yes\nTrusted: yes\n", string(content))
+
+	// enable the commented out line and change its suite, options are kept
+	repo, err = d.ModifyRepoSysCall(context.Background(), nil, syspackage.ModifyRepoParams{Name: "sources.list:3", Url: "http://deb.debian.org/debian bookworm-backports main non-free"})
+	require.NoError(t, err)
+	assert.True(t, repo.Enabled)
+	content, err = os.ReadFile(env.GetPath("etc/apt/sources.list"))
+	require.NoError(t, err)
+	assert.Equal(t, `deb http://deb.debian.org/debian bookworm main contrib
+deb-src http://deb.debian.org/debian bookworm main contrib
+deb [arch=amd64 signed-by=/usr/share/keyrings/debian.gpg] http://deb.debian.org/debian bookworm-backports main non-free
+# This is a comment, not a repository
+`, string(content))
+
+	// the URL of a file with several entries is ambiguous
+	_, err = d.ModifyRepoSysCall(context.Background(), nil, syspackage.ModifyRepoParams{Name: "ubuntu", Url: "http://mirror.example.com/ubuntu/"})
+	assert.Error(t, err)
+
+	// add a new stanza
+	repo, err = d.ModifyRepoSysCall(context.Background(), nil, syspackage.ModifyRepoParams{Name: "ubuntu:3", Url: "http://ppa.example.com/ubuntu noble main"})
+	require.NoError(t, err)
+	assert.Equal(t, "ubuntu:3", repo.ID)
+	assert.Equal(t, []string{"noble"}, repo.Suites)
+
+	// remove the first stanza
+	_, err = d.ModifyRepoSysCall(context.Background(), nil, syspackage.ModifyRepoParams{Name: "ubuntu:1", RemoveRepos: true})
+	require.NoError(t, err)
+	repos, err := d.ListReposSysCall(context.Background(), nil, "ubuntu")
+	require.NoError(t, err)
+	require.Len(t, repos, 2)
+	assert.Equal(t, []string{"http://security.ubuntu.com/ubuntu/"}, repos[0].URLs)
+	assert.Equal(t, []string{"http://ppa.example.com/ubuntu"}, repos[1].URLs)
+}
+
+// TestAptSourcesWithoutRoot reads the sources of the host if no root is set,
+// not the ones relative to the working directory.
+func TestAptSourcesWithoutRoot(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll("etc/apt/sources.list.d", 0755))
+	require.NoError(t, os.WriteFile("etc/apt/sources.list.d/relative.list", []byte("deb http://example.com/relative stable main\n"), 0644))
+
+	d := New("dpkg", "dpkg-query", "apt-cache", "")
+	assert.Equal(t, "/etc/apt/sources.list.d/relative.list", d.sourcesPath("relative"))
+	repos, err := d.ListReposSysCall(context.Background(), nil, "relative")
+	require.NoError(t, err)
+	assert.Empty(t, repos)
+}
+
+func TestSplitRepoID(t *testing.T) {
+	alias, index := splitRepoID("ubuntu:2")
+	assert.Equal(t, "ubuntu", alias)
+	assert.Equal(t, 1, index)
+	alias, index = splitRepoID("sources.list")
+	assert.Equal(t, "sources.list", alias)
+	assert.Equal(t, -1, index)
+	alias, index = splitRepoID("ubuntu:0")
+	assert.Equal(t, "ubuntu:0", alias)
+	assert.Equal(t, -1, index)
+}
@@ -0,0 +1,185 @@
+package dpkg
+
+import (
+	"bufio"
+	"cmp"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+// relationFields maps the relations of list_packages to the fields of the
+// dpkg database.
+var relationFields = map[string]string{
+	"requires":    "Depends",
+	"recommends":  "Recommends",
+	"obsoletes":   "Breaks",
+	"provides":    "Provides",
+	"conflicts":   "Conflicts",
+	"suggests":    "Suggests",
+	"supplements": "Enhances",
+	"enhances":    "Enhances",
+}
+
+// readControlFile reads the stanzas of a file in the control file format,
+// like the dpkg status file. Continuation lines are appended to the value
+// with their leading whitespace, as dpkg-query prints them.
+func readControlFile(filePath string) ([]map[string]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var stanzas []map[string]string
+	current := make(map[string]string)
+	lastKey := ""
+	scanner := bufio.NewScanner(file)
+	// descriptions and conffile lists can be long
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				stanzas = append(stanzas, current)
+				current = make(map[string]string)
+			}
+			lastKey = ""
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if lastKey != "" {
+				current[lastKey] += "\n" + line
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		lastKey = key
+		current[key] = strings.TrimSpace(value)
+	}
+	if len(current) > 0 {
+		stanzas = append(stanzas, current)
+	}
+	return stanzas, scanner.Err()
+}
+
+// isInstalled reports whether the 'Status' of a package, which is
+// 'want flag status', means that its files are on the system.
+func isInstalled(status string) bool {
+	fields := strings.Fields(status)
+	if len(fields) != 3 {
+		return false
+	}
+	return fields[2] != "not-installed" && fields[2] != "config-files"
+}
+
+// binaryPackage returns the name dpkg uses for the files of a package in
+// info/, which carries the architecture for 'Multi-Arch: same' packages.
+func binaryPackage(stanza map[string]string) string {
+	if stanza["Multi-Arch"] == "same" {
+		return stanza["Package"] + ":" + stanza["Architecture"]
+	}
+	return stanza["Package"]
+}
+
+// splitRelations splits a relation field like 'libc6 (>= 2.34), libfoo | libbar'
+// into its comma separated parts.
+func splitRelations(value string) []string {
+	var rels []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			rels = append(rels, part)
+		}
+	}
+	return rels
+}
+
+// readFileList returns the files of a package from its .list file in info/.
+func (dpkg DPKG) readFileList(binaryName string) []string {
+	content, err := os.ReadFile(filepath.Join("/", dpkg.root, "var/lib/dpkg/info", binaryName+".list"))
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files
+}
+
+// listStatusDatabase lists the installed packages by reading the dpkg
+// database under the root directly, which needs a single pass even if
+// files and relations are requested. The name is a glob pattern as for
+// dpkg-query.
+func (dpkg DPKG) listStatusDatabase(params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+	stanzas, err := readControlFile(filepath.Join("/", dpkg.root, "var/lib/dpkg/status"))
+	if err != nil {
+		return nil, err
+	}
+
+	lst := []syspackage.SysPackageInfo{}
+	for _, stanza := range stanzas {
+		if !isInstalled(stanza["Status"]) {
+			continue
+		}
+		binaryName := binaryPackage(stanza)
+		if params.Name != "" {
+			matchName, _ := path.Match(params.Name, stanza["Package"])
+			matchBinary, _ := path.Match(params.Name, binaryName)
+			if !matchName && !matchBinary {
+				continue
+			}
+		}
+		size, err := strconv.ParseUint(stanza["Installed-Size"], 10, 64)
+		if err != nil {
+			size = 0
+		}
+		source, _, _ := strings.Cut(stanza["Source"], " ")
+		if source == "" {
+			source = stanza["Package"]
+		}
+		epoch, version, release := splitDebianVersion(stanza["Version"])
+		pkg := syspackage.SysPackageInfo{
+			Name:          stanza["Package"],
+			Epoch:         epoch,
+			Version:       version,
+			Release:       release,
+			Arch:          stanza["Architecture"],
+			Size:          size,
+			Vendor:        stanza["Origin"],
+			SourcePackage: source,
+			InstallTime:   dpkg.installTime(binaryName),
+		}
+		if params.Filelist {
+			pkg.FileList = dpkg.readFileList(binaryName)
+		}
+		if params.Description {
+			pkg.Description = stanza["Description"]
+		}
+		if len(params.Relations) > 0 {
+			pkg.Relations = make(map[string][]string)
+			for _, rel := range params.Relations {
+				rel = strings.ToLower(strings.TrimSpace(rel))
+				if field, ok := relationFields[rel]; ok {
+					pkg.Relations[rel] = splitRelations(stanza[field])
+				}
+			}
+		}
+		lst = append(lst, pkg)
+	}
+	// sorted like the output of dpkg-query
+	slices.SortStableFunc(lst, func(a, b syspackage.SysPackageInfo) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Arch, b.Arch))
+	})
+	return lst, nil
+}
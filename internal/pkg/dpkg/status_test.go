@@ -0,0 +1,128 @@
+package dpkg
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+	"github.com/suse/managesw-mcp/internal/pkg/testenv"
+)
+
+const dpkgStatus = `Package: vim
+Status: install ok installed
+Priority: optional
+Section: editors
+Installed-Size: 3900
+Maintainer: Debian Vim Maintainers <team+vim@tracker.debian.org>
+Architecture: amd64
+Source: vim (2:9.0.1378-2)
+Version: 2:9.0.1378-2
+Provides: editor
+Depends: vim-common (= 2:9.0.1378-2), vim-runtime (= 2:9.0.1378-2), libc6 (>= 2.34),
+ libtinfo6 (>= 6)
+Suggests: ctags, vim-doc
+Description: Vi IMproved - enhanced vi editor
+ Vim is an almost compatible version of the UNIX editor Vi.
+ .
+ Many new features have been added.
+
+Package: libc6
+Status: install ok installed
+Installed-Size: 12000
+Architecture: i386
+Multi-Arch: same
+Source: glibc
+Version: 2.36-9+deb12u4
+Description: GNU C Library: Shared libraries
+
+Package: libc6
+Status: install ok installed
+Installed-Size: 12500
+Architecture: amd64
+Multi-Arch: same
+Source: glibc
+Version: 2.36-9+deb12u4
+Description: GNU C Library: Shared libraries
+
+Package: nano
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 7.2-1
+Description: small, friendly text editor inspired by Pico
+`
+
+func TestDpkgStatusDatabase(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	env.WriteFile("var/lib/dpkg/status", dpkgStatus)
+	env.WriteFile("var/lib/dpkg/info/vim.list", "/.\n/usr\n/usr/bin\n/usr/bin/vim.basic\n")
+	env.WriteFile("var/lib/dpkg/info/libc6:amd64.list", "/.\n/usr/lib/x86_64-linux-gnu/libc.so.6\n")
+
+	// the dpkg binaries don't exist, so the database must be read directly
+	d := New(env.GetPath("bin/dpkg"), env.GetPath("bin/dpkg-query"), "apt-cache", env.GetPath(""))
+	pkgs, err := d.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{
+		Filelist:    true,
+		Description: true,
+		Relations:   []string{"requires", "provides", "recommends"},
+	})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 3)
+
+	assert.Equal(t, "libc6", pkgs[0].Name)
+	assert.Equal(t, "amd64", pkgs[0].Arch)
+	assert.Equal(t, uint64(12500), pkgs[0].Size)
+	assert.Equal(t, "glibc", pkgs[0].SourcePackage)
+	assert.Equal(t, []string{"/.", "/usr/lib/x86_64-linux-gnu/libc.so.6"}, pkgs[0].FileList)
+	assert.False(t, pkgs[0].InstallTime.IsZero())
+	assert.Equal(t, "i386", pkgs[1].Arch)
+	assert.Nil(t, pkgs[1].FileList)
+
+	vim := pkgs[2]
+	assert.Equal(t, "vim", vim.Name)
+	assert.Equal(t, 2, vim.Epoch)
+	assert.Equal(t, "9.0.1378", vim.Version)
+	assert.Equal(t, "2", vim.Release)
+	assert.Equal(t, "vim", vim.SourcePackage)
+	assert.Equal(t, []string{"/.", "/usr", "/usr/bin", "/usr/bin/vim.basic"}, vim.FileList)
+	assert.Equal(t, "Vi IMproved - enhanced vi editor\n Vim is an almost compatible version of the UNIX editor Vi.\n .\n Many new features have been added.", vim.Description)
+	assert.Equal(t, []string{
+		"vim-common (= 2:9.0.1378-2)",
+		"vim-runtime (= 2:9.0.1378-2)",
+		"libc6 (>= 2.34)",
+		"libtinfo6 (>= 6)",
+	}, vim.Relations["requires"])
+	assert.Equal(t, []string{"editor"}, vim.Relations["provides"])
+	assert.Nil(t, vim.Relations["recommends"])
+
+	// patterns match the name with and without architecture
+	pkgs, err = d.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{Name: "libc6:i386"})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	assert.Equal(t, "i386", pkgs[0].Arch)
+	pkgs, err = d.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{Name: "*vi*"})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	pkgs, err = d.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{Name: "nano"})
+	require.NoError(t, err)
+	assert.Empty(t, pkgs)
+}
+
+// TestDpkgStatusDatabaseWithoutRoot reads the database of the host if no
+// root is set.
+func TestDpkgStatusDatabaseWithoutRoot(t *testing.T) {
+	if _, err := os.Stat("/var/lib/dpkg/status"); err != nil {
+		t.Skip("dpkg is not installed on the host")
+	}
+	// the database must not be looked up relative to the working directory
+	t.Chdir(t.TempDir())
+	// the dpkg binaries don't exist, so the database must be read directly
+	d := New("/nonexistent/dpkg", "/nonexistent/dpkg-query", "apt-cache", "")
+	pkgs, err := d.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{Name: "dpkg", Filelist: true})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	assert.Contains(t, pkgs[0].FileList, "/usr/bin/dpkg")
+}
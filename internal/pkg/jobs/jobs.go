@@ -0,0 +1,369 @@
+// Package jobs runs long package transactions in the background, so that
+// their results don't depend on the tool call staying within the timeout of
+// the client.
+//
+// Every job is stored as <id>.json in the state directory together with its
+// output in <id>.log, so that the result is still available when the client
+// reconnects to a new server process.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type State string
+
+const (
+	Running   State = "running"
+	Succeeded State = "succeeded"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+	// Interrupted jobs were running when their server process stopped.
+	Interrupted State = "interrupted"
+)
+
+// Job is the state of a background job as stored on disk.
+type Job struct {
+	ID       string    `json:"id"`
+	Tool     string    `json:"tool" jsonschema:"The tool which started the job."`
+	Params   any       `json:"params,omitempty" jsonschema:"The parameters of the tool call."`
+	Session  string    `json:"session,omitempty" jsonschema:"The id of the MCP session which started the job."`
+	Client   string    `json:"client,omitempty" jsonschema:"The name and version the MCP client which started the job reported."`
+	State    State     `json:"state" jsonschema:"One of running, succeeded, failed, cancelled or interrupted."`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitzero"`
+	Result   any       `json:"result,omitempty" jsonschema:"The result of the tool, once the job has succeeded."`
+	Error    string    `json:"error,omitempty"`
+	Pid      int       `json:"pid" jsonschema:"The server process running the job."`
+}
+
+// Func is the work of a job. Output written to the writer returned by Log
+// for its context is kept in the log of the job.
+type Func func(ctx context.Context) (any, error)
+
+type job struct {
+	Job
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Manager starts jobs and keeps track of them.
+type Manager struct {
+	// OnFinish is called with every job once it has finished, if set.
+	OnFinish func(Job)
+
+	dir  string
+	mu   sync.Mutex
+	jobs map[string]*job
+	wg   sync.WaitGroup
+}
+
+// maxOutput is the maximal number of bytes returned by one Output call.
+const maxOutput = 64 * 1024
+
+// cancelWait is how long Cancel waits for the job to stop.
+var cancelWait = 10 * time.Second
+
+var ErrNotFound = errors.New("job not found")
+
+// NewManager creates a manager storing the jobs in dir, which is created
+// with the first job.
+func NewManager(dir string) (*Manager, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no directory for the jobs given")
+	}
+	return &Manager{dir: dir, jobs: make(map[string]*job)}, nil
+}
+
+func (m *Manager) statePath(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+func (m *Manager) logPath(id string) string {
+	return filepath.Join(m.dir, id+".log")
+}
+
+// save writes the state of the job atomically.
+func (m *Manager) save(j Job) error {
+	content, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.statePath(j.ID) + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.statePath(j.ID))
+}
+
+// load reads the state of a job of another server process. Running jobs
+// whose process is gone are reported as interrupted.
+func (m *Manager) load(id string) (Job, error) {
+	var j Job
+	content, err := os.ReadFile(m.statePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return j, fmt.Errorf("%w: %s", ErrNotFound, id)
+	} else if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal(content, &j); err != nil {
+		return j, fmt.Errorf("invalid state of job %s: %w", id, err)
+	}
+	if j.State == Running && !processAlive(j.Pid) {
+		j.State = Interrupted
+		j.Error = "the server process stopped while the job was running"
+		if info, err := os.Stat(m.logPath(id)); err == nil {
+			j.Finished = info.ModTime()
+		}
+		if err := m.save(j); err != nil {
+			slog.Warn("failed to save job state", "job", id, "error", err)
+		}
+	}
+	return j, nil
+}
+
+// processAlive reports whether a process other than this one exists with
+// the pid. A job with the pid of this process which this manager doesn't
+// know was started by an earlier process which got the same pid.
+func processAlive(pid int) bool {
+	if pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func newID() string {
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
+
+// validID reports whether id can be a job id, which protects against paths
+// given as id.
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+// Start runs fn in the background for the tool call of request and returns
+// the job right away. The job isn't bound to the context of the tool call,
+// as it has to survive it.
+func (m *Manager) Start(request *mcp.CallToolRequest, tool string, params any, fn Func) (Job, error) {
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return Job{}, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	id := newID()
+	logFile, err := os.OpenFile(m.logPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to create job log: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	session, client := Caller(request)
+	j := &job{
+		Job: Job{
+			ID:      id,
+			Tool:    tool,
+			Params:  params,
+			Session: session,
+			Client:  client,
+			State:   Running,
+			Started: time.Now(),
+			Pid:     os.Getpid(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if err := m.save(j.Job); err != nil {
+		cancel()
+		logFile.Close()
+		return Job{}, fmt.Errorf("failed to save job state: %w", err)
+	}
+	// the job may finish before it is returned
+	started := j.Job
+	m.mu.Lock()
+	m.jobs[id] = j
+	m.mu.Unlock()
+	slog.Info("started job", "job", id, "tool", tool)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(j.done)
+		defer logFile.Close()
+		result, err := fn(WithLog(ctx, logFile))
+
+		var finished Job
+		defer func() {
+			if m.OnFinish != nil {
+				m.OnFinish(finished)
+			}
+		}()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		j.Finished = time.Now()
+		switch {
+		case ctx.Err() != nil:
+			j.State = Cancelled
+			if err != nil {
+				j.Error = err.Error()
+			}
+		case err != nil:
+			j.State = Failed
+			j.Error = err.Error()
+		default:
+			j.State = Succeeded
+			j.Result = result
+		}
+		cancel()
+		finished = j.Job
+		if err := m.save(j.Job); err != nil {
+			slog.Warn("failed to save job state", "job", id, "error", err)
+		}
+		slog.Info("finished job", "job", id, "state", j.State)
+	}()
+	return started, nil
+}
+
+// Get returns the job with the id, which may have been started by another
+// server process.
+func (m *Manager) Get(id string) (Job, error) {
+	if !validID(id) {
+		return Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	m.mu.Lock()
+	var current Job
+	j, ok := m.jobs[id]
+	if ok {
+		current = j.Job
+	}
+	m.mu.Unlock()
+	if ok {
+		return current, nil
+	}
+	return m.load(id)
+}
+
+// List returns all jobs, the most recently started first.
+func (m *Manager) List() ([]Job, error) {
+	lst := []Job{}
+	entries, err := os.ReadDir(m.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return lst, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		j, err := m.Get(id)
+		if err != nil {
+			slog.Warn("skipping job", "job", id, "error", err)
+			continue
+		}
+		lst = append(lst, j)
+	}
+	slices.SortStableFunc(lst, func(a, b Job) int {
+		return b.Started.Compare(a.Started)
+	})
+	return lst, nil
+}
+
+// Output returns the output of the job starting at offset, together with
+// the offset of the following output. Output is returned in chunks of at
+// most maxOutput bytes.
+func (m *Manager) Output(id string, offset int64) (string, int64, error) {
+	if _, err := m.Get(id); err != nil {
+		return "", offset, err
+	}
+	file, err := os.Open(m.logPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", offset, nil
+	} else if err != nil {
+		return "", offset, err
+	}
+	defer file.Close()
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, maxOutput)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return "", offset, err
+	}
+	return string(buf[:n]), offset + int64(n), nil
+}
+
+// Cancel stops a running job and waits a bit for it to finish. Only the jobs
+// of this server process can be cancelled.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		existing, err := m.Get(id)
+		if err != nil {
+			return existing, err
+		}
+		if existing.State == Running {
+			return existing, fmt.Errorf("job %s is run by the server process %d and can't be cancelled from here", id, existing.Pid)
+		}
+		return existing, nil
+	}
+	j.cancel()
+	select {
+	case <-j.done:
+	case <-time.After(cancelWait):
+	}
+	return m.Get(id)
+}
+
+// Wait blocks until all jobs of this server process are finished.
+func (m *Manager) Wait() {
+	m.mu.Lock()
+	running := 0
+	for _, j := range m.jobs {
+		if j.State == Running {
+			running++
+		}
+	}
+	m.mu.Unlock()
+	if running > 0 {
+		slog.Info("waiting for background jobs to finish", "jobs", running)
+	}
+	m.wg.Wait()
+}
+
+type logKey struct{}
+
+// WithLog returns a context carrying the writer for the output of a job.
+func WithLog(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, logKey{}, w)
+}
+
+// Log returns the writer for the output of the job running with the
+// context, or nil outside of jobs.
+func Log(ctx context.Context) io.Writer {
+	if ctx == nil {
+		return nil
+	}
+	w, _ := ctx.Value(logKey{}).(io.Writer)
+	return w
+}
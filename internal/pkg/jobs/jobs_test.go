@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitFor(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	for range 500 {
+		job, err := m.Get(id)
+		require.NoError(t, err)
+		if job.State != Running {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't finish", id)
+	return Job{}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(filepath.Join(dir, "jobs"))
+	require.NoError(t, err)
+
+	jobs, err := m.List()
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	job, err := m.Start(nil, "update_package", map[string]any{"name": "vim"}, func(ctx context.Context) (any, error) {
+		fmt.Fprintln(Log(ctx), "Retrieving: vim")
+		close(started)
+		<-release
+		fmt.Fprintln(Log(ctx), "Installing: vim")
+		return map[string]string{"installed": "vim"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Running, job.State)
+	assert.Equal(t, os.Getpid(), job.Pid)
+
+	<-started
+	_, result, err := m.JobOutput(context.Background(), nil, JobOutputParams{ID: job.ID})
+	require.NoError(t, err)
+	assert.False(t, result.Complete)
+	assert.Equal(t, "Retrieving: vim\n", result.Output)
+	offset := result.Offset
+
+	close(release)
+	finished := waitFor(t, m, job.ID)
+	assert.Equal(t, Succeeded, finished.State)
+	assert.Equal(t, map[string]string{"installed": "vim"}, finished.Result)
+	assert.False(t, finished.Finished.IsZero())
+
+	_, result, err = m.JobOutput(context.Background(), nil, JobOutputParams{ID: job.ID, Offset: offset})
+	require.NoError(t, err)
+	assert.True(t, result.Complete)
+	assert.Equal(t, "Installing: vim\n", result.Output)
+	assert.Equal(t, Succeeded, result.State)
+
+	_, err = m.Start(nil, "install_package", nil, func(ctx context.Context) (any, error) {
+		return nil, errors.New("package not found")
+	})
+	require.NoError(t, err)
+
+	// a new server process sees the jobs from the disk
+	m2, err := NewManager(filepath.Join(dir, "jobs"))
+	require.NoError(t, err)
+	loaded, err := m2.Get(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, Succeeded, loaded.State)
+	assert.Equal(t, map[string]any{"installed": "vim"}, loaded.Result)
+	assert.Equal(t, map[string]any{"name": "vim"}, loaded.Params)
+
+	output, _, err := m2.Output(job.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Retrieving: vim\nInstalling: vim\n", output)
+
+	m.Wait()
+	_, list, err := m2.ListJobs(context.Background(), nil, ListJobsParams{State: Failed})
+	require.NoError(t, err)
+	require.Len(t, list.Jobs, 1)
+	assert.Equal(t, "package not found", list.Jobs[0].Error)
+
+	_, err = m2.Get("../jobs")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = m2.Get("20240101-000000-00000000")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestJobCancel(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	job, err := m.Start(nil, "update_package", nil, func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, err)
+	_, cancelled, err := m.CancelJob(context.Background(), nil, JobParams{ID: job.ID})
+	require.NoError(t, err)
+	assert.Equal(t, Cancelled, cancelled.State)
+	assert.Equal(t, "context canceled", cancelled.Error)
+}
+
+func TestJobInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(dir)
+	require.NoError(t, err)
+
+	// a job of a server process which doesn't exist anymore
+	content, err := json.Marshal(Job{ID: "20240101-000000-00000000", Tool: "update_package", State: Running, Pid: 0x7fffffff})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20240101-000000-00000000.json"), content, 0600))
+
+	job, err := m.Get("20240101-000000-00000000")
+	require.NoError(t, err)
+	assert.Equal(t, Interrupted, job.State)
+
+	_, err = m.Cancel(job.ID)
+	assert.NoError(t, err)
+
+	// a job of another running process can't be cancelled
+	content, err = json.Marshal(Job{ID: "20240101-000000-00000001", Tool: "update_package", State: Running, Pid: os.Getppid()})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20240101-000000-00000001.json"), content, 0600))
+	job, err = m.Get("20240101-000000-00000001")
+	require.NoError(t, err)
+	assert.Equal(t, Running, job.State)
+	_, err = m.Cancel(job.ID)
+	assert.Error(t, err)
+}
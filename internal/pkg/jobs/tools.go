@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Caller returns the id of the MCP session of the tool call and the name
+// and version the client reported, if known.
+func Caller(request *mcp.CallToolRequest) (session, client string) {
+	if request == nil || request.Session == nil {
+		return "", ""
+	}
+	session = request.Session.ID()
+	if init := request.Session.InitializeParams(); init != nil && init.ClientInfo != nil {
+		client = strings.TrimSpace(init.ClientInfo.Name + " " + init.ClientInfo.Version)
+	}
+	return session, client
+}
+
+type JobParams struct {
+	ID string `json:"id" jsonschema:"The id of the job as returned when it was started."`
+}
+
+func (m *Manager) Status(ctx context.Context, request *mcp.CallToolRequest, params JobParams) (*mcp.CallToolResult, Job, error) {
+	job, err := m.Get(params.ID)
+	if err != nil {
+		return nil, Job{}, err
+	}
+	return nil, job, nil
+}
+
+type JobOutputParams struct {
+	ID     string `json:"id" jsonschema:"The id of the job as returned when it was started."`
+	Offset int64  `json:"offset,omitempty" jsonschema:"Return the output from this offset on. Use the offset of the previous call to get only the new output."`
+}
+
+type JobOutputResult struct {
+	Output   string `json:"output"`
+	Offset   int64  `json:"offset" jsonschema:"The offset to continue reading the output from."`
+	State    State  `json:"state"`
+	Complete bool   `json:"complete" jsonschema:"Set once the job has finished and all of its output was returned."`
+}
+
+func (m *Manager) JobOutput(ctx context.Context, request *mcp.CallToolRequest, params JobOutputParams) (*mcp.CallToolResult, JobOutputResult, error) {
+	// the state is read first, so that all output of a finished job is read
+	job, err := m.Get(params.ID)
+	if err != nil {
+		return nil, JobOutputResult{}, err
+	}
+	output, offset, err := m.Output(params.ID, params.Offset)
+	if err != nil {
+		return nil, JobOutputResult{}, err
+	}
+	return nil, JobOutputResult{
+		Output:   output,
+		Offset:   offset,
+		State:    job.State,
+		Complete: job.State != Running && len(output) < maxOutput,
+	}, nil
+}
+
+func (m *Manager) CancelJob(ctx context.Context, request *mcp.CallToolRequest, params JobParams) (*mcp.CallToolResult, Job, error) {
+	job, err := m.Cancel(params.ID)
+	if err != nil {
+		return nil, Job{}, err
+	}
+	return nil, job, nil
+}
+
+type ListJobsParams struct {
+	State State `json:"state,omitempty" jsonschema:"Only list the jobs in this state."`
+}
+
+type ListJobsResult struct {
+	Jobs []Job `json:"jobs"`
+}
+
+func (m *Manager) ListJobs(ctx context.Context, request *mcp.CallToolRequest, params ListJobsParams) (*mcp.CallToolResult, ListJobsResult, error) {
+	jobs, err := m.List()
+	if err != nil {
+		return nil, ListJobsResult{}, err
+	}
+	filtered := []Job{}
+	for _, job := range jobs {
+		if params.State == "" || job.State == params.State {
+			filtered = append(filtered, job)
+		}
+	}
+	return nil, ListJobsResult{Jobs: filtered}, nil
+}
@@ -10,41 +10,41 @@ import (
 
 type NoPkg struct{}
 
-func (n NoPkg) ListInstalledPackagesSysCall(params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+func (n NoPkg) ListInstalledPackagesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
 	return []syspackage.SysPackageInfo{}, fmt.Errorf("No package manager found")
 }
-func (n NoPkg) QueryPackageSysCall(name string, mode syspackage.QueryMode, lines int) (ret map[string]any, err error) {
+func (n NoPkg) QueryPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, name string, mode syspackage.QueryMode, lines int) (ret map[string]any, err error) {
 	return ret, fmt.Errorf("No package manager found")
 }
-func (n NoPkg) ListReposSysCall(name string) ([]map[string]any, error) {
+func (n NoPkg) ListReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) ([]syspackage.Repository, error) {
 	return nil, fmt.Errorf("not implemented")
 }
 
-func (n NoPkg) ModifyRepoSysCall(params syspackage.ModifyRepoParams) (map[string]any, error) {
+func (n NoPkg) ModifyRepoSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ModifyRepoParams) (*syspackage.Repository, error) {
 	return nil, fmt.Errorf("not implemented")
 }
 
-func (n NoPkg) ListPatchesSysCall(params syspackage.ListPatchesParams) ([]map[string]any, error) {
+func (n NoPkg) ListPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPatchesParams) ([]map[string]any, error) {
 	return nil, fmt.Errorf("not implemented")
 }
 
-func (n NoPkg) InstallPatchesSysCall(params syspackage.InstallPatchesParams) ([]map[string]any, error) {
-	return nil, fmt.Errorf("not implemented")
+func (n NoPkg) InstallPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPatchesParams) (syspackage.InstallPatchesResult, error) {
+	return syspackage.InstallPatchesResult{}, fmt.Errorf("not implemented")
 }
 
-func (n NoPkg) RefreshReposSysCall(name string) error {
+func (n NoPkg) RefreshReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) error {
 	return fmt.Errorf("not implemented")
 }
 
-func (n NoPkg) SearchPackageSysCall(params syspackage.SearchPackageParams) (any, error) {
+func (n NoPkg) SearchPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.SearchPackageParams) (syspackage.SearchResult, error) {
 	return nil, fmt.Errorf("not implemented")
 }
 
-func (n NoPkg) InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (string, error) {
-	return "", fmt.Errorf("not implemented")
+func (n NoPkg) InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (syspackage.InstallResult, error) {
+	return syspackage.InstallResult{}, fmt.Errorf("not implemented")
 }
 
-func (n NoPkg) RemovePackageSysCall(params syspackage.RemovePackageParams) (string, error) {
+func (n NoPkg) RemovePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.RemovePackageParams) (string, error) {
 	return "", fmt.Errorf("not implemented")
 }
 
@@ -52,6 +52,21 @@ func (n NoPkg) PkgType() string {
 	return "nopkg"
 }
 
-func (n NoPkg) UpdatePackageSysCall(params syspackage.UpdatePackageParams) (string, error) {
-	return "", fmt.Errorf("not implemented")
+func (n NoPkg) UpdatePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.UpdatePackageParams) (syspackage.UpdateResult, error) {
+	return syspackage.UpdateResult{}, fmt.Errorf("not implemented")
+}
+
+func (n NoPkg) SystemInfoSysCall(ctx context.Context, request *mcp.CallToolRequest) (syspackage.SystemInfo, error) {
+	return syspackage.SystemInfo{
+		Backend:   "none",
+		OSRelease: syspackage.ReadOSRelease(""),
+	}, nil
+}
+
+func (n NoPkg) Capabilities() syspackage.Capabilities {
+	return syspackage.NoCapabilities("no supported package manager found")
+}
+
+func (n NoPkg) RepoConfigPaths() []string {
+	return nil
 }
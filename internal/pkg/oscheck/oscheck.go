@@ -1,50 +1,130 @@
 package oscheck
 
 import (
+	"fmt"
 	"os/exec"
+	"strings"
 
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
 	"github.com/suse/managesw-mcp/internal/pkg/dpkg"
 	"github.com/suse/managesw-mcp/internal/pkg/nopkgs"
 	"github.com/suse/managesw-mcp/internal/pkg/rpm"
+	"github.com/suse/managesw-mcp/internal/pkg/simulated"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 )
 
-func NewPkg(root string) syspackage.SysPackage {
-	if rpmpath, err := exec.LookPath("rpm"); err == nil {
-		args := []string{}
-		if root != "" {
-			args = append(args, "--root", root)
+// Backends are the values of Options.Backend. Auto detects the package
+// manager of the system, none disables all package operations.
+var Backends = []string{"auto", "zypper", "dnf", "apt", "simulated", "none"}
+
+// Options select the backend returned by New.
+type Options struct {
+	// Backend is one of Backends, empty means auto.
+	Backend string
+	// Root is the root directory of the managed system.
+	Root string
+	// Fixture is the state of the simulated backend, empty means the demo
+	// system.
+	Fixture string
+	// Runner runs the commands of the backend, nil runs them on the system.
+	Runner cmdrunner.Runner
+}
+
+// New returns the backend selected by the options. Explicitly selected
+// backends fail if their tools are missing, while auto falls back to none.
+func New(opts Options) (syspackage.SysPackage, error) {
+	if opts.Runner == nil {
+		opts.Runner = cmdrunner.Exec{}
+	}
+	backend := opts.Backend
+	if backend == "" || backend == "auto" {
+		backend, _ = Detect(opts.Root)
+	}
+	var pkgs syspackage.SysPackageInterface
+	switch backend {
+	case "zypper", "dnf":
+		rpmpath, err := lookPath("rpm", backend)
+		if err != nil {
+			return syspackage.SysPackage{}, err
 		}
-		args = append(args, "-q", "rpm")
-		cmd := exec.Command(rpmpath, args...)
-		if err := cmd.Run(); err == nil {
-			if zypperPath, err := exec.LookPath("zypper"); err == nil {
-				return syspackage.SysPackage{rpm.NewRPM(rpmpath, rpm.Zypper, zypperPath, root)}
-			}
-			if dnfPath, err := exec.LookPath("dnf"); err == nil {
-				return syspackage.SysPackage{rpm.NewRPM(rpmpath, rpm.Dnf, dnfPath, root)}
-			}
+		mgrpath, err := lookPath(backend, backend)
+		if err != nil {
+			return syspackage.SysPackage{}, err
 		}
-	}
-	dpkgpath, err := exec.LookPath("dpkg")
-	if err == nil {
-		dpkgquery, err := exec.LookPath("dpkg-query")
+		var mgrtype rpm.RPMType = rpm.Zypper
+		if backend == "dnf" {
+			mgrtype = rpm.Dnf
+		}
+		pkgs = rpm.NewRPM(rpmpath, mgrtype, mgrpath, opts.Root).WithRunner(opts.Runner)
+	case "apt":
+		dpkgpath, err := lookPath("dpkg", backend)
 		if err != nil {
-			goto nodpkg
+			return syspackage.SysPackage{}, err
 		}
-		args := []string{}
-		if root != "" {
-			args = append(args, "--root", root)
+		dpkgquery, err := lookPath("dpkg-query", backend)
+		if err != nil {
+			return syspackage.SysPackage{}, err
 		}
-		args = append(args, "-s", "dpkg")
-		cmd := exec.Command(dpkgquery, args...)
-		dpkgCmdOut, err := cmd.Output()
-		if err == nil && len(dpkgCmdOut) > 0 {
-			aptcache, _ := exec.LookPath("apt-cache")
-			return syspackage.SysPackage{dpkg.New(dpkgpath, dpkgquery, aptcache, root)}
+		aptcache, _ := exec.LookPath("apt-cache")
+		pkgs = dpkg.New(dpkgpath, dpkgquery, aptcache, opts.Root).WithRunner(opts.Runner)
+	case "simulated":
+		sim, err := simulated.Load(opts.Fixture)
+		if err != nil {
+			return syspackage.SysPackage{}, err
 		}
+		pkgs = sim
+	case "none":
+		pkgs = nopkgs.NoPkg{}
+	default:
+		return syspackage.SysPackage{}, fmt.Errorf("unknown backend %q, valid backends are %s", opts.Backend, strings.Join(Backends, ", "))
 	}
-nodpkg:
-	return syspackage.SysPackage{nopkgs.NoPkg{}}
+	return syspackage.SysPackage{SysPackageInterface: pkgs}, nil
+}
+
+func lookPath(file string, backend string) (string, error) {
+	path, err := exec.LookPath(file)
+	if err != nil {
+		return "", fmt.Errorf("backend %s needs %s: %w", backend, file, err)
+	}
+	return path, nil
+}
+
+// NewPkg detects the package manager of root and returns its backend, which
+// runs its commands with runner. A nil runner runs them on the system.
+func NewPkg(root string, runner cmdrunner.Runner) syspackage.SysPackage {
+	pkg, err := New(Options{Root: root, Runner: runner})
+	if err != nil {
+		return syspackage.SysPackage{SysPackageInterface: nopkgs.NoPkg{}}
+	}
+	return pkg
+}
 
+// Detect returns the backend managing the packages of root, or none, along
+// with notes on how it was found.
+func Detect(root string) (backend string, notes []string) {
+	rootArgs := []string{}
+	if root != "" {
+		rootArgs = append(rootArgs, "--root", root)
+	}
+	if rpmpath, err := exec.LookPath("rpm"); err != nil {
+		notes = append(notes, "rpm not found")
+	} else if err := exec.Command(rpmpath, append(rootArgs, "-q", "rpm")...).Run(); err != nil {
+		notes = append(notes, fmt.Sprintf("%s is found, but rpm isn't installed in its database: %v", rpmpath, err))
+	} else {
+		for _, mgr := range []string{"zypper", "dnf"} {
+			if mgrpath, err := exec.LookPath(mgr); err == nil {
+				return mgr, append(notes, fmt.Sprintf("rpm database found, using %s", mgrpath))
+			}
+		}
+		notes = append(notes, "rpm database found, but neither zypper nor dnf")
+	}
+	dpkgquery, err := exec.LookPath("dpkg-query")
+	if _, dpkgErr := exec.LookPath("dpkg"); dpkgErr != nil || err != nil {
+		return "none", append(notes, "dpkg or dpkg-query not found")
+	}
+	out, err := exec.Command(dpkgquery, append(rootArgs, "-s", "dpkg")...).Output()
+	if err != nil || len(out) == 0 {
+		return "none", append(notes, fmt.Sprintf("%s is found, but dpkg isn't installed in its database", dpkgquery))
+	}
+	return "apt", append(notes, "dpkg database found, using apt")
 }
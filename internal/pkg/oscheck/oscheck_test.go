@@ -38,7 +38,7 @@ echo "zypper version 42"
 	err = os.Chmod(env.GetPath(zypperPath), 0755)
 	assert.NoError(t, err)
 
-	pkg := NewPkg(env.GetPath("/"))
+	pkg := NewPkg(env.GetPath("/"), nil)
 	assert.Equal(t, "rpm", pkg.SysPackageInterface.PkgType())
 }
 
@@ -61,7 +61,7 @@ echo "dnf version 42"
 	err = os.Chmod(env.GetPath(dnfPath), 0755)
 	assert.NoError(t, err)
 
-	pkg := NewPkg(env.GetPath("/"))
+	pkg := NewPkg(env.GetPath("/"), nil)
 	assert.Equal(t, "rpm", pkg.SysPackageInterface.PkgType())
 }
 
@@ -78,7 +78,7 @@ echo "rpm version 42"
 	err := os.Chmod(env.GetPath(rpmPath), 0755)
 	assert.NoError(t, err)
 
-	pkg := NewPkg(env.GetPath("/"))
+	pkg := NewPkg(env.GetPath("/"), nil)
 	assert.Equal(t, "nopkg", pkg.SysPackageInterface.PkgType())
 }
 
@@ -89,6 +89,32 @@ func TestNoPkg(t *testing.T) {
 	os.Setenv("PATH", path)
 	defer os.Setenv("PATH", oldPath)
 
-	pkg := NewPkg(env.GetPath("/"))
+	pkg := NewPkg(env.GetPath("/"), nil)
 	assert.Equal(t, "nopkg", pkg.SysPackageInterface.PkgType())
 }
+
+func TestExplicitBackend(t *testing.T) {
+	env, path := newTestEnv(t)
+	defer env.RemoveAll()
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", path)
+	defer os.Setenv("PATH", oldPath)
+
+	pkg, err := New(Options{Backend: "simulated"})
+	assert.NoError(t, err)
+	assert.Equal(t, "simulated", pkg.SysPackageInterface.PkgType())
+
+	pkg, err = New(Options{Backend: "none"})
+	assert.NoError(t, err)
+	assert.Equal(t, "nopkg", pkg.SysPackageInterface.PkgType())
+
+	_, err = New(Options{Backend: "zypper", Root: env.GetPath("/")})
+	assert.ErrorContains(t, err, "backend zypper needs rpm")
+
+	_, err = New(Options{Backend: "portage"})
+	assert.ErrorContains(t, err, `unknown backend "portage"`)
+
+	backend, notes := Detect(env.GetPath("/"))
+	assert.Equal(t, "none", backend)
+	assert.Contains(t, notes, "rpm not found")
+}
@@ -0,0 +1,187 @@
+// Package policy guards the system against unwanted changes by the agents,
+// like removing glibc or adding repositories from arbitrary URLs. The policy
+// is read from the 'policy' section of the configuration file and evaluated
+// before the package manager is called.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Policy are the rules for the package transactions. A nil or empty policy
+// allows everything.
+type Policy struct {
+	// AllowPackages are globs of the packages which may be installed,
+	// removed or updated, all are allowed if empty. Globs match the name or
+	// name-version of a package, like 'python3*' or 'openssl-3.*'.
+	AllowPackages []string `mapstructure:"allow_packages"`
+	// DenyPackages are globs of the packages which may not be installed,
+	// removed or updated, even if allowed.
+	DenyPackages []string `mapstructure:"deny_packages"`
+	// ProtectedPackages are globs of the packages which can never be
+	// removed, neither directly nor by a transaction.
+	ProtectedPackages []string `mapstructure:"protected_packages"`
+	// AllowedRepoURLs are the URLs below which the URLs modify_repo sets
+	// must be, all are allowed if empty. The scheme and host must be equal
+	// and the path must be the one of the allowed URL or below it.
+	AllowedRepoURLs []string `mapstructure:"allowed_repo_urls"`
+	// RequireGPGCheck denies disabling the GPG check of repositories.
+	RequireGPGCheck bool `mapstructure:"require_gpgcheck"`
+	// MaxTransactionSize is the maximum number of packages changed by a
+	// transaction of install_package or update_package, 0 means unlimited.
+	MaxTransactionSize int `mapstructure:"max_transaction_size"`
+}
+
+// Package is a package changed by a transaction.
+type Package struct {
+	Name    string
+	Version string
+}
+
+// Transaction are the changes a package transaction makes.
+type Transaction struct {
+	// Changed are the installed, upgraded and downgraded packages.
+	Changed []Package
+	Removed []Package
+}
+
+// ErrViolation is wrapped by all errors of the policy.
+var ErrViolation = errors.New("denied by policy")
+
+func violation(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrViolation, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the globs of the policy.
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, globs := range [][]string{p.AllowPackages, p.DenyPackages, p.ProtectedPackages} {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid package glob %q in policy: %w", glob, err)
+			}
+		}
+	}
+	if p.MaxTransactionSize < 0 {
+		return fmt.Errorf("invalid max_transaction_size %d in policy", p.MaxTransactionSize)
+	}
+	return nil
+}
+
+// HasPackageRules reports whether the packages of a transaction have to be
+// known to evaluate the policy, which needs a dry run.
+func (p *Policy) HasPackageRules() bool {
+	return p != nil && (len(p.AllowPackages) > 0 || len(p.DenyPackages) > 0 ||
+		len(p.ProtectedPackages) > 0 || p.MaxTransactionSize > 0)
+}
+
+func matchAny(globs []string, pkg Package) (string, bool) {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, pkg.Name); ok {
+			return glob, true
+		}
+		if pkg.Version == "" {
+			continue
+		}
+		if ok, _ := path.Match(glob, pkg.Name+"-"+pkg.Version); ok {
+			return glob, true
+		}
+	}
+	return "", false
+}
+
+// CheckPackage checks that the package may be changed.
+func (p *Policy) CheckPackage(pkg Package) error {
+	if p == nil {
+		return nil
+	}
+	if glob, ok := matchAny(p.DenyPackages, pkg); ok {
+		return violation("package %s matches the denied packages '%s'", pkg.Name, glob)
+	}
+	if len(p.AllowPackages) > 0 {
+		if _, ok := matchAny(p.AllowPackages, pkg); !ok {
+			return violation("package %s isn't in the allowed packages", pkg.Name)
+		}
+	}
+	return nil
+}
+
+// CheckRemove checks that the package may be removed.
+func (p *Policy) CheckRemove(pkg Package) error {
+	if p == nil {
+		return nil
+	}
+	if glob, ok := matchAny(p.ProtectedPackages, pkg); ok {
+		return violation("package %s is protected by '%s' and can't be removed", pkg.Name, glob)
+	}
+	return p.CheckPackage(pkg)
+}
+
+// CheckTransaction checks all changes of a transaction and its size.
+func (p *Policy) CheckTransaction(tx Transaction) error {
+	if p == nil {
+		return nil
+	}
+	if size := len(tx.Changed) + len(tx.Removed); p.MaxTransactionSize > 0 && size > p.MaxTransactionSize {
+		return violation("the transaction changes %d packages, more than the maximum of %d", size, p.MaxTransactionSize)
+	}
+	for _, pkg := range tx.Changed {
+		if err := p.CheckPackage(pkg); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range tx.Removed {
+		if err := p.CheckRemove(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckRepo checks the URL and GPG check a repository is configured with.
+// An empty URL keeps the URL of the repository.
+func (p *Policy) CheckRepo(repoURL string, gpgcheck bool) error {
+	if p == nil {
+		return nil
+	}
+	if p.RequireGPGCheck && !gpgcheck {
+		return violation("the GPG check of repositories can't be disabled")
+	}
+	if repoURL == "" || len(p.AllowedRepoURLs) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowedRepoURLs {
+		if isBelow(repoURL, allowed) {
+			return nil
+		}
+	}
+	return violation("repository URL %s isn't below one of the allowed URLs %s", repoURL, strings.Join(p.AllowedRepoURLs, ", "))
+}
+
+// isBelow reports whether repoURL has the scheme and host of allowed and its
+// path is the one of allowed or below it. Comparing the strings would allow
+// hosts like download.opensuse.org.example.com. Relative paths are never
+// below allowed, as they depend on the working directory of the package
+// manager.
+func isBelow(repoURL, allowed string) bool {
+	repo, err := url.Parse(repoURL)
+	if err != nil || repo.Opaque != "" || (repo.Path != "" && !strings.HasPrefix(repo.Path, "/")) {
+		return false
+	}
+	base, err := url.Parse(allowed)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(repo.Scheme, base.Scheme) || !strings.EqualFold(repo.Host, base.Host) {
+		return false
+	}
+	prefix := strings.TrimSuffix(base.Path, "/")
+	repoPath := path.Clean("/" + repo.Path)
+	return prefix == "" || repoPath == prefix || strings.HasPrefix(repoPath, prefix+"/")
+}
@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	var p *Policy
+	assert.NoError(t, p.Validate())
+	assert.NoError(t, (&Policy{DenyPackages: []string{"kernel-*"}}).Validate())
+	assert.ErrorContains(t, (&Policy{ProtectedPackages: []string{"glibc["}}).Validate(), `invalid package glob "glibc["`)
+	assert.ErrorContains(t, (&Policy{MaxTransactionSize: -1}).Validate(), "invalid max_transaction_size")
+}
+
+func TestCheckPackages(t *testing.T) {
+	p := &Policy{
+		AllowPackages:      []string{"vim*", "nginx", "openssl-3.*"},
+		DenyPackages:       []string{"vim-data"},
+		ProtectedPackages:  []string{"glibc", "vim"},
+		MaxTransactionSize: 3,
+	}
+	assert.True(t, p.HasPackageRules())
+	assert.False(t, (*Policy)(nil).HasPackageRules())
+	assert.False(t, (&Policy{RequireGPGCheck: true}).HasPackageRules())
+
+	assert.NoError(t, p.CheckPackage(Package{Name: "vim-data-common"}))
+	assert.NoError(t, p.CheckPackage(Package{Name: "openssl", Version: "3.1.4"}))
+	err := p.CheckPackage(Package{Name: "openssl", Version: "1.1.1w"})
+	assert.ErrorIs(t, err, ErrViolation)
+	assert.EqualError(t, err, "denied by policy: package openssl isn't in the allowed packages")
+	assert.EqualError(t, p.CheckPackage(Package{Name: "vim-data"}), "denied by policy: package vim-data matches the denied packages 'vim-data'")
+
+	assert.NoError(t, p.CheckRemove(Package{Name: "nginx"}))
+	assert.EqualError(t, p.CheckRemove(Package{Name: "vim"}), "denied by policy: package vim is protected by 'vim' and can't be removed")
+	// installing or updating protected packages is fine
+	assert.NoError(t, p.CheckTransaction(Transaction{Changed: []Package{{Name: "vim"}}}))
+
+	err = p.CheckTransaction(Transaction{
+		Changed: []Package{{Name: "nginx"}},
+		Removed: []Package{{Name: "glibc"}},
+	})
+	assert.ErrorContains(t, err, "package glibc is protected")
+	err = p.CheckTransaction(Transaction{
+		Changed: []Package{{Name: "vim"}, {Name: "vim-data-common"}, {Name: "nginx"}, {Name: "vim-small"}},
+	})
+	assert.EqualError(t, err, "denied by policy: the transaction changes 4 packages, more than the maximum of 3")
+}
+
+func TestCheckRepo(t *testing.T) {
+	var p *Policy
+	require.NoError(t, p.CheckRepo("http://example.com/repo", false))
+
+	p = &Policy{
+		AllowedRepoURLs: []string{"https://download.opensuse.org/", "/srv/repos/"},
+		RequireGPGCheck: true,
+	}
+	assert.NoError(t, p.CheckRepo("https://download.opensuse.org/tumbleweed/repo/oss/", true))
+	assert.NoError(t, p.CheckRepo("/srv/repos/local", true))
+	assert.NoError(t, p.CheckRepo("", true), "an empty URL keeps the one of the repository")
+	assert.EqualError(t, p.CheckRepo("http://example.com/repo", true),
+		"denied by policy: repository URL http://example.com/repo isn't below one of the allowed URLs https://download.opensuse.org/, /srv/repos/")
+	assert.ErrorIs(t, p.CheckRepo("https://download.opensuse.org.evil.example/repo/", true), ErrViolation)
+	assert.ErrorIs(t, p.CheckRepo("http://download.opensuse.org/repo/", true), ErrViolation)
+	assert.ErrorIs(t, p.CheckRepo("/srv/repos-evil/local", true), ErrViolation)
+	assert.ErrorIs(t, p.CheckRepo("/srv/repos/../../etc", true), ErrViolation)
+	assert.ErrorIs(t, p.CheckRepo("srv/repos/local", true), ErrViolation)
+	assert.NoError(t, p.CheckRepo("/srv/repos", true))
+	assert.EqualError(t, p.CheckRepo("/srv/repos/local", false), "denied by policy: the GPG check of repositories can't be disabled")
+}
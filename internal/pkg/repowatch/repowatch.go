@@ -0,0 +1,113 @@
+// Package repowatch reports changes of the repository configuration, made
+// through the tools or directly on disk, so that the input schemas offering
+// the repositories can be rebuilt.
+package repowatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDelay is the time to wait for further changes before calling the
+// handler, as package managers often write several files in a row.
+const DefaultDelay = 500 * time.Millisecond
+
+// Watcher calls its handler once after a burst of changes.
+type Watcher struct {
+	delay    time.Duration
+	onChange func()
+
+	mu    sync.Mutex
+	timer *time.Timer
+	// running serializes the calls of the handler
+	running sync.Mutex
+}
+
+// New returns a watcher which calls onChange delay after the last change.
+func New(delay time.Duration, onChange func()) *Watcher {
+	return &Watcher{delay: delay, onChange: onChange}
+}
+
+// Changed reports a change, like one made by modify_repo.
+func (w *Watcher) Changed() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Reset(w.delay)
+		return
+	}
+	w.timer = time.AfterFunc(w.delay, func() {
+		w.mu.Lock()
+		w.timer = nil
+		w.mu.Unlock()
+		w.running.Lock()
+		defer w.running.Unlock()
+		w.onChange()
+	})
+}
+
+// Watch reports the changes of the files and directories in paths until ctx
+// is done. For directories the changes of the files in them are reported.
+// Paths which don't exist are watched through their parent directory, so only
+// their creation is reported, and they are skipped if the parent doesn't
+// exist either.
+func (w *Watcher) Watch(ctx context.Context, paths []string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch the repositories: %w", err)
+	}
+	dirs := map[string]bool{}
+	files := map[string]bool{}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		info, err := os.Stat(path)
+		switch {
+		case err == nil && info.IsDir():
+			dirs[path] = true
+		case err == nil || os.IsNotExist(err):
+			// files are watched through their directory, as they are
+			// often replaced instead of written to
+			files[path] = true
+			path = filepath.Dir(path)
+		default:
+			continue
+		}
+		if err := watcher.Add(path); err != nil {
+			slog.Debug("not watching for repository changes", "path", path, "error", err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if dirs[filepath.Dir(event.Name)] || files[event.Name] {
+					slog.Debug("repository configuration changed", "event", event.String())
+					w.Changed()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("watching the repositories failed", "error", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,63 @@
+package repowatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedCoalesces(t *testing.T) {
+	var calls atomic.Int32
+	w := New(20*time.Millisecond, func() { calls.Add(1) })
+	for range 5 {
+		w.Changed()
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+
+	w.Changed()
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	reposDir := filepath.Join(dir, "sources.list.d")
+	require.NoError(t, os.Mkdir(reposDir, 0755))
+	sourcesList := filepath.Join(dir, "sources.list")
+
+	changed := make(chan struct{}, 10)
+	w := New(10*time.Millisecond, func() { changed <- struct{}{} })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, w.Watch(ctx, []string{sourcesList, reposDir, filepath.Join(dir, "missing.d"), filepath.Join(dir, "missing", "x.list")}))
+
+	wait := func(msg string) {
+		t.Helper()
+		select {
+		case <-changed:
+		case <-time.After(2 * time.Second):
+			t.Fatal(msg)
+		}
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(reposDir, "extra.list"), []byte("deb http://example.com stable main\n"), 0644))
+	wait("adding a file to the directory wasn't noticed")
+	require.NoError(t, os.WriteFile(sourcesList, []byte("deb http://example.com stable main\n"), 0644))
+	wait("creating the watched file wasn't noticed")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "missing.d"), 0755))
+	wait("creating the missing directory wasn't noticed")
+
+	// other files next to the watched file are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "apt.conf"), []byte(""), 0644))
+	select {
+	case <-changed:
+		t.Fatal("unrelated file was reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
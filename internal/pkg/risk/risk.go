@@ -0,0 +1,60 @@
+// Package risk classifies the tools by how much they can change the system,
+// so that operators can limit the tools offered to agents by their tier.
+package risk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Tier is the risk of a tool, the higher the more it can change.
+type Tier int
+
+const (
+	// ReadOnly tools only query the system.
+	ReadOnly Tier = iota
+	// RepoMutating tools change the repositories or their metadata.
+	RepoMutating
+	// PackageMutating tools install or remove selected packages.
+	PackageMutating
+	// SystemUpgrade tools can change all installed packages at once.
+	SystemUpgrade
+)
+
+var tierNames = []string{"read-only", "repo-mutating", "package-mutating", "system-upgrade"}
+
+// Names returns the names of the tiers from the lowest to the highest.
+func Names() []string {
+	return append([]string{}, tierNames...)
+}
+
+func (t Tier) String() string {
+	if t < 0 || int(t) >= len(tierNames) {
+		return fmt.Sprintf("tier(%d)", int(t))
+	}
+	return tierNames[t]
+}
+
+// Parse returns the tier of a name as returned by String.
+func Parse(name string) (Tier, error) {
+	for i, tierName := range tierNames {
+		if name == tierName {
+			return Tier(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown risk tier %q, valid tiers are %s", name, strings.Join(tierNames, ", "))
+}
+
+// Annotations returns the MCP annotations of the tools of the tier. Only
+// repository changes are not destructive, while a system upgrade isn't
+// idempotent as it picks up the packages published in the meantime.
+func (t Tier) Annotations() *mcp.ToolAnnotations {
+	destructive := t >= PackageMutating
+	return &mcp.ToolAnnotations{
+		ReadOnlyHint:    t == ReadOnly,
+		DestructiveHint: &destructive,
+		IdempotentHint:  t != SystemUpgrade,
+	}
+}
@@ -0,0 +1,38 @@
+package risk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for i, name := range Names() {
+		tier, err := Parse(name)
+		require.NoError(t, err)
+		assert.Equal(t, Tier(i), tier)
+		assert.Equal(t, name, tier.String())
+	}
+	_, err := Parse("dangerous")
+	assert.ErrorContains(t, err, `unknown risk tier "dangerous"`)
+}
+
+func TestAnnotations(t *testing.T) {
+	readOnly := ReadOnly.Annotations()
+	assert.True(t, readOnly.ReadOnlyHint)
+	assert.False(t, *readOnly.DestructiveHint)
+	assert.True(t, readOnly.IdempotentHint)
+
+	repo := RepoMutating.Annotations()
+	assert.False(t, repo.ReadOnlyHint)
+	assert.False(t, *repo.DestructiveHint)
+
+	pkg := PackageMutating.Annotations()
+	assert.True(t, *pkg.DestructiveHint)
+	assert.True(t, pkg.IdempotentHint)
+
+	upgrade := SystemUpgrade.Annotations()
+	assert.True(t, *upgrade.DestructiveHint)
+	assert.False(t, upgrade.IdempotentHint)
+}
@@ -4,16 +4,17 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"os/exec"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 )
 
-func (rpm RPM) listReposDnf(params syspackage.ListPackageParams) ([]map[string]any, error) {
+func (rpm RPM) listReposDnf(ctx context.Context, params syspackage.ListPackageParams) ([]syspackage.Repository, error) {
 	args := []string{}
 	if rpm.root != "" {
 		args = append(args, "--root", rpm.root)
@@ -22,21 +23,20 @@ func (rpm RPM) listReposDnf(params syspackage.ListPackageParams) ([]map[string]a
 	if params.Name != "" {
 		args = append(args, params.Name)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
 	if err != nil {
 		return nil, err
 	}
-	var repos []map[string]any
+	var repos []syspackage.Repository
 	scanner := bufio.NewScanner(bytes.NewReader(output))
-	currentRepo := make(map[string]any)
+	currentRepo := make(map[string]string)
 
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.TrimSpace(line) == "" {
 			if len(currentRepo) > 0 {
-				repos = append(repos, currentRepo)
-				currentRepo = make(map[string]any)
+				repos = append(repos, rpm.dnfRepository(currentRepo))
+				currentRepo = make(map[string]string)
 			}
 			continue
 		}
@@ -50,22 +50,70 @@ func (rpm RPM) listReposDnf(params syspackage.ListPackageParams) ([]map[string]a
 	}
 
 	if len(currentRepo) > 0 {
-		repos = append(repos, currentRepo)
+		repos = append(repos, rpm.dnfRepository(currentRepo))
 	}
 
 	return repos, nil
 
 }
 
-func (rpm RPM) modReposDnf(params syspackage.ModifyRepoParams) (map[string]any, error) {
+// dnfRepository converts the key/value pairs printed by dnf for a repository
+// to a Repository. dnf4 prints keys like 'Repo-baseurl' while dnf5 uses
+// 'Base URL', so the keys are normalized before they are interpreted. Values
+// dnf doesn't print, like gpgcheck, are read from the repo file if known.
+func (rpm RPM) dnfRepository(fields map[string]string) syspackage.Repository {
+	repo := syspackage.Repository{Extras: make(map[string]string)}
+	for key, value := range fields {
+		norm := strings.ReplaceAll(strings.ToLower(key), " ", "-")
+		norm = strings.TrimPrefix(norm, "repo-")
+		switch norm {
+		case "id":
+			repo.ID = value
+		case "name":
+			repo.Name = value
+		case "status":
+			repo.Enabled = repoBool(value)
+		case "baseurl", "base-url":
+			// dnf4 abbreviates long lists as 'url (2 more)'
+			if idx := strings.Index(value, " ("); idx != -1 {
+				value = value[:idx]
+			}
+			repo.URLs = append(repo.URLs, splitRepoList(value)...)
+		case "priority":
+			repo.Priority, _ = strconv.Atoi(value)
+		case "type":
+			repo.Type = value
+		case "filename", "config-file":
+			repo.SourceFile = value
+		default:
+			repo.Extras[key] = value
+		}
+	}
+	if repo.SourceFile != "" {
+		repoFile := readRepoFile(path.Join(rpm.root, repo.SourceFile), repo.ID)
+		repo.GPGCheck = repoBool(repoFile["gpgcheck"])
+		repo.Keys = splitRepoList(repoFile["gpgkey"])
+		if len(repo.URLs) == 0 {
+			repo.URLs = splitRepoList(repoFile["baseurl"])
+		}
+		if repo.Priority == 0 {
+			repo.Priority, _ = strconv.Atoi(repoFile["priority"])
+		}
+		if repo.Type == "" {
+			repo.Type = repoFile["type"]
+		}
+	}
+	return repo
+}
+
+func (rpm RPM) modReposDnf(ctx context.Context, params syspackage.ModifyRepoParams) (*syspackage.Repository, error) {
 	if params.RemoveRepos {
 		args := []string{}
 		if rpm.root != "" {
 			args = append(args, "--root", rpm.root)
 		}
 		args = append(args, "repo", "remove", params.Name)
-		cmd := exec.Command(rpm.mgr.mgrpath, args...)
-		if err := cmd.Run(); err != nil {
+		if _, err := rpm.run(ctx, rpm.mgr.mgrpath, args...); err != nil {
 			return nil, err
 		}
 		return nil, nil
@@ -83,8 +131,7 @@ func (rpm RPM) modReposDnf(params syspackage.ModifyRepoParams) (map[string]any,
 	if params.Name != "" {
 		args = append(args, "--name", params.Name)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	err := cmd.Run()
+	_, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
 	if err != nil {
 		// if the repo does not exist, add it
 		args := []string{}
@@ -92,44 +139,42 @@ func (rpm RPM) modReposDnf(params syspackage.ModifyRepoParams) (map[string]any,
 			args = append(args, "--root", rpm.root)
 		}
 		args = append(args, "config-manager", "--add-repo", params.Url)
-		cmd := exec.Command(rpm.mgr.mgrpath, args...)
-		if err := cmd.Run(); err != nil {
+		if _, err := rpm.run(ctx, rpm.mgr.mgrpath, args...); err != nil {
 			return nil, err
 		}
 	}
 
-	repos, err := rpm.listReposDnf(syspackage.ListPackageParams{Name: params.Name})
+	repos, err := rpm.listReposDnf(ctx, syspackage.ListPackageParams{Name: params.Name})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, repo := range repos {
-		if r, ok := repo["Repo-id"]; ok && r == params.Name {
-			return repo, nil
+	for i := range repos {
+		if repos[i].ID == params.Name {
+			return &repos[i], nil
 		}
 	}
 
 	return nil, nil
 }
 
-func (rpm RPM) refreshReposDnf(name string) error {
+func (rpm RPM) refreshReposDnf(ctx context.Context, request *mcp.CallToolRequest, name string) error {
 	args := []string{}
 	if rpm.root != "" {
 		args = append(args, "--root", rpm.root)
 	}
 	args = append(args, "makecache")
 	if name != "" {
-		args = append(args, "--disablerepo='*'", fmt.Sprintf("--enablerepo='%s'", name))
+		args = append(args, "--disablerepo=*", "--enablerepo="+name)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := syspackage.RunWithProgress(ctx, request, rpm.runner, cmdrunner.New(rpm.mgr.mgrpath, args...))
 	if err != nil {
-		return fmt.Errorf("dnf makecache failed: %w, output: %s", err, string(output))
+		return fmt.Errorf("dnf makecache failed: %w, output: %s", err, output)
 	}
 	return nil
 }
 
-func (rpm RPM) searchPackagesDnf(params syspackage.SearchPackageParams) (map[string]map[string][]syspackage.SearchedPackage, error) {
+func (rpm RPM) searchPackagesDnf(ctx context.Context, params syspackage.SearchPackageParams) (syspackage.SearchResult, error) {
 	args := []string{}
 	if rpm.root != "" {
 		args = append(args, "--root", rpm.root)
@@ -146,11 +191,10 @@ func (rpm RPM) searchPackagesDnf(params syspackage.SearchPackageParams) (map[str
 		query = "*" + query + "*"
 	}
 	args = append(args, query)
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
-	result := make(map[string]map[string][]syspackage.SearchedPackage)
+	output, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
+	result := make(syspackage.SearchResult)
 	if err != nil {
-		if _, ok := err.(*exec.ExitError); ok {
+		if _, ok := cmdrunner.ExitCode(err); ok {
 			return result, nil
 		}
 		return nil, fmt.Errorf("dnf repoquery failed: %w, output: %s", err, string(output))
@@ -198,7 +242,16 @@ func (rpm RPM) searchPackagesDnf(params syspackage.SearchPackageParams) (map[str
 	return result, nil
 }
 
-func (rpm RPM) installPackageDnf(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (string, error) {
+// dnfDryRun drops the error of a dry run with --assumeno, which dnf fails
+// with 'Operation aborted' after printing the transaction.
+func dnfDryRun(dryRun bool, output string, err error) error {
+	if dryRun && err != nil && strings.Contains(output, "Operation aborted") {
+		return nil
+	}
+	return err
+}
+
+func (rpm RPM) installPackageDnf(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (syspackage.InstallResult, error) {
 	args := []string{}
 	if rpm.root != "" {
 		args = append(args, "--root", rpm.root)
@@ -222,53 +275,14 @@ func (rpm RPM) installPackageDnf(ctx context.Context, request *mcp.CallToolReque
 		pkg = fmt.Sprintf("%s-%s", params.Name, params.Version)
 	}
 	args = append(args, pkg)
-	var cmd *exec.Cmd
-	if ctx != nil {
-		cmd = exec.CommandContext(ctx, rpm.mgr.mgrpath, args...)
-	} else {
-		cmd = exec.Command(rpm.mgr.mgrpath, args...)
-	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return "", err
-	}
-	cmd.Stderr = cmd.Stdout
-
-	if err := cmd.Start(); err != nil {
-		return "", err
+	output, err := syspackage.RunWithProgress(ctx, request, rpm.runner, cmdrunner.New(rpm.mgr.mgrpath, args...))
+	if err := dnfDryRun(params.ShowDetails, output, err); err != nil {
+		return syspackage.InstallResult{RawOutput: output}, fmt.Errorf("dnf install failed: %w, output: %s", err, output)
 	}
-
-	var out bytes.Buffer
-	var progressToken any
-	if request != nil && request.Params != nil {
-		progressToken = request.Params.GetProgressToken()
-	}
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := scanner.Text()
-		out.WriteString(line)
-		out.WriteString("\n")
-		if progressToken != nil && request != nil && request.Session != nil {
-			_ = request.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
-				ProgressToken: progressToken,
-				Message:       line,
-			})
-		}
-	}
-
-	err = cmd.Wait()
-	if err != nil {
-		return out.String(), fmt.Errorf("dnf install failed: %w, output: %s", err, out.String())
-	}
-	parsed := syspackage.ParseDnfInstallOutput(out.String(), params.Name)
-	jsonBytes, err := json.MarshalIndent(parsed, "", "  ")
-	if err == nil {
-		return string(jsonBytes), nil
-	}
-	return out.String(), nil
+	return syspackage.ParseDnfInstallOutput(output, params.Name), nil
 }
 
-func (rpm RPM) removePackageDnf(params syspackage.RemovePackageParams) (string, error) {
+func (rpm RPM) removePackageDnf(ctx context.Context, params syspackage.RemovePackageParams) (string, error) {
 	args := []string{}
 	if rpm.root != "" {
 		args = append(args, "--root", rpm.root)
@@ -286,20 +300,24 @@ func (rpm RPM) removePackageDnf(params syspackage.RemovePackageParams) (string,
 		args = append(args, "--setopt=clean_requirements_on_remove=True")
 	}
 	args = append(args, params.Name)
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
+	output, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
+	if err := dnfDryRun(params.ShowDetails, string(output), err); err != nil {
 		return string(output), fmt.Errorf("dnf remove failed: %w, output: %s", err, string(output))
 	}
 	return string(output), nil
 }
 
-func (rpm RPM) updatePackageDnf(params syspackage.UpdatePackageParams) (string, error) {
+func (rpm RPM) updatePackageDnf(ctx context.Context, request *mcp.CallToolRequest, params syspackage.UpdatePackageParams) (syspackage.UpdateResult, error) {
 	args := []string{}
 	if rpm.root != "" {
 		args = append(args, "--root", rpm.root)
 	}
-	args = append(args, "upgrade", "-y")
+	args = append(args, "upgrade")
+	if params.ShowDetails {
+		args = append(args, "--assumeno")
+	} else {
+		args = append(args, "-y")
+	}
 	if len(params.Repos) > 0 {
 		for _, repo := range params.Repos {
 			args = append(args, "--repo", repo)
@@ -308,10 +326,108 @@ func (rpm RPM) updatePackageDnf(params syspackage.UpdatePackageParams) (string,
 	if params.Name != "" {
 		args = append(args, params.Name)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := syspackage.RunWithProgress(ctx, request, rpm.runner, cmdrunner.New(rpm.mgr.mgrpath, args...))
+	if err := dnfDryRun(params.ShowDetails, output, err); err != nil {
+		return syspackage.UpdateResult{RawOutput: output}, fmt.Errorf("dnf upgrade failed: %w, output: %s", err, output)
+	}
+	return syspackage.ParseDnfUpdateOutput(output), nil
+}
+
+// updateinfoDnf returns the advisories with updates for the installed
+// packages which match the category and severity of a patch.
+func (rpm RPM) updateinfoDnf(ctx context.Context, category string, severity string) ([]dnfAdvisory, error) {
+	filter, err := dnfCategoryArgs(category)
 	if err != nil {
-		return string(output), fmt.Errorf("dnf upgrade failed: %w, output: %s", err, string(output))
+		return nil, err
 	}
-	return string(output), nil
+	sevFilter, err := dnfSeverityArgs(severity)
+	if err != nil {
+		return nil, err
+	}
+	filter = append(filter, sevFilter...)
+
+	args := []string{}
+	if rpm.root != "" {
+		args = append(args, "--root", rpm.root)
+	}
+	args = append(args, "updateinfo", "list")
+	args = append(args, filter...)
+	output, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("dnf updateinfo list failed: %w, output: %s", err, string(output))
+	}
+	advisories := parseUpdateinfoList(string(output))
+	if len(advisories) == 0 {
+		return advisories, nil
+	}
+
+	args = []string{}
+	if rpm.root != "" {
+		args = append(args, "--root", rpm.root)
+	}
+	args = append(args, "updateinfo", "info")
+	for _, adv := range advisories {
+		args = append(args, adv.ID)
+	}
+	output, err = rpm.run(ctx, rpm.mgr.mgrpath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("dnf updateinfo info failed: %w, output: %s", err, string(output))
+	}
+	parseUpdateinfoInfo(string(output), advisories)
+	return advisories, nil
+}
+
+func (rpm RPM) listPatchesDnf(ctx context.Context, params syspackage.ListPatchesParams) ([]map[string]any, error) {
+	advisories, err := rpm.updateinfoDnf(ctx, params.Category, params.Severity)
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]any
+	for _, adv := range advisories {
+		result = append(result, adv.toMap("needed"))
+	}
+	return result, nil
+}
+
+// installPatchesDnf installs the advisories which match the category and
+// severity. The advisories are looked up first, so that exactly the listed
+// advisories are installed and returned.
+func (rpm RPM) installPatchesDnf(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPatchesParams) (syspackage.InstallPatchesResult, error) {
+	advisories, err := rpm.updateinfoDnf(ctx, params.Category, params.Severity)
+	if err != nil {
+		return syspackage.InstallPatchesResult{}, err
+	}
+	if len(advisories) == 0 {
+		return syspackage.InstallPatchesResult{}, nil
+	}
+
+	args := []string{}
+	if rpm.root != "" {
+		args = append(args, "--root", rpm.root)
+	}
+	args = append(args, "upgrade")
+	status := "applied"
+	if params.ShowDetails {
+		args = append(args, "--assumeno")
+		status = "needed"
+	} else {
+		args = append(args, "-y")
+	}
+	for _, adv := range advisories {
+		args = append(args, "--advisory="+adv.ID)
+	}
+	output, err := syspackage.RunWithProgress(ctx, request, rpm.runner, cmdrunner.New(rpm.mgr.mgrpath, args...))
+	if err := dnfDryRun(params.ShowDetails, output, err); err != nil {
+		return syspackage.InstallPatchesResult{}, fmt.Errorf("dnf upgrade failed: %w, output: %s", err, output)
+	}
+
+	var result syspackage.InstallPatchesResult
+	for _, adv := range advisories {
+		result.Patches = append(result.Patches, adv.toMap(status))
+	}
+	if params.ShowDetails {
+		changes := syspackage.ParseDnfUpdateOutput(output)
+		result.Changes = &changes
+	}
+	return result, nil
 }
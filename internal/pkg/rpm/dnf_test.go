@@ -1,12 +1,15 @@
 package rpm
 
 import (
-	"encoding/json"
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
+	"github.com/suse/managesw-mcp/internal/pkg/confirm"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 	"github.com/suse/managesw-mcp/internal/pkg/testenv"
 )
@@ -46,12 +49,9 @@ fi
 	rpm := NewRPMTest("rpm", Dnf, env.GetPath("bin/dnf"), "")
 
 	// Search for packages matching "test"
-	pkgsAny, err := rpm.SearchPackageSysCall(syspackage.SearchPackageParams{Name: "test"})
+	pkgs, err := rpm.SearchPackageSysCall(context.Background(), nil, syspackage.SearchPackageParams{Name: "test"})
 	require.NoError(t, err)
 
-	pkgs, ok := pkgsAny.(map[string]map[string][]syspackage.SearchedPackage)
-	require.True(t, ok, "Expected search output to be map[string]map[string][]syspackage.SearchedPackage")
-
 	// Verify packages under "System" repo (originally @System)
 	assert.Contains(t, pkgs, "System")
 	assert.Contains(t, pkgs["System"], "x86_64")
@@ -129,7 +129,7 @@ fi
 	rpm := NewRPMTest("rpm", Dnf, env.GetPath("bin/dnf"), "")
 
 	// 1. List repos initially (should be empty)
-	repos, err := rpm.ListReposSysCall("")
+	repos, err := rpm.ListReposSysCall(context.Background(), nil, "")
 	require.NoError(t, err)
 	assert.Empty(t, repos)
 
@@ -138,37 +138,38 @@ fi
 		Name: "test-repo",
 		Url:  "http://example.com/dnf",
 	}
-	repo, err := rpm.ModifyRepoSysCall(addParams)
+	repo, err := rpm.ModifyRepoSysCall(context.Background(), nil, addParams)
 	require.NoError(t, err)
-	assert.Equal(t, "test-repo", repo["Repo-id"])
-	assert.Equal(t, "enabled", repo["Repo-status"])
+	assert.Equal(t, "test-repo", repo.ID)
+	assert.True(t, repo.Enabled)
+	assert.Equal(t, []string{"http://example.com/dnf"}, repo.URLs)
 
 	// 3. Verify it is listed
-	repos, err = rpm.ListReposSysCall("")
+	repos, err = rpm.ListReposSysCall(context.Background(), nil, "")
 	require.NoError(t, err)
 	require.Len(t, repos, 1)
-	assert.Equal(t, "test-repo", repos[0]["Repo-id"])
+	assert.Equal(t, "test-repo", repos[0].ID)
 
 	// 4. Disable repository
 	disableParams := syspackage.ModifyRepoParams{
 		Name:    "test-repo",
 		Disable: true,
 	}
-	repo, err = rpm.ModifyRepoSysCall(disableParams)
+	repo, err = rpm.ModifyRepoSysCall(context.Background(), nil, disableParams)
 	require.NoError(t, err)
-	assert.Equal(t, "disabled", repo["Repo-status"])
+	assert.False(t, repo.Enabled)
 
 	// 5. Enable repository
 	enableParams := syspackage.ModifyRepoParams{
 		Name:    "test-repo",
 		Disable: false,
 	}
-	repo, err = rpm.ModifyRepoSysCall(enableParams)
+	repo, err = rpm.ModifyRepoSysCall(context.Background(), nil, enableParams)
 	require.NoError(t, err)
-	assert.Equal(t, "enabled", repo["Repo-status"])
+	assert.True(t, repo.Enabled)
 
 	// 6. Refresh repository
-	err = rpm.RefreshReposSysCall("test-repo")
+	err = rpm.RefreshReposSysCall(context.Background(), nil, "test-repo")
 	require.NoError(t, err)
 
 	// 7. Remove repository
@@ -176,57 +177,33 @@ fi
 		Name:        "test-repo",
 		RemoveRepos: true,
 	}
-	_, err = rpm.ModifyRepoSysCall(removeParams)
+	_, err = rpm.ModifyRepoSysCall(context.Background(), nil, removeParams)
 	require.NoError(t, err)
 
 	// 8. Verify repository is removed
-	repos, err = rpm.ListReposSysCall("")
+	repos, err = rpm.ListReposSysCall(context.Background(), nil, "")
 	require.NoError(t, err)
 	assert.Empty(t, repos)
 }
 
-func TestDnfInstallPackage(t *testing.T) {
-	env := testenv.New(t)
-	defer env.RemoveAll()
-
-	binDir := env.GetPath("bin")
-	env.MkdirAll("bin")
-
-	oldPath := os.Getenv("PATH")
-	os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)
-	defer os.Setenv("PATH", oldPath)
-
-	// Mock dnf to simulate install commands and verify weak deps configuration
-	dnfMock := `#!/bin/sh
-# Log all args to a file to verify correct flags are passed
-echo "$@" >> "` + env.GetPath("dnf_args.log") + `"
-echo "Installing:"
-echo " test-pkg                      x86_64           1.2.3-1           fedora         10 k"
-echo "Installing dependencies:"
-echo " other-pkg                     noarch           2.0.0-1           fedora          5 k"
-echo "Installing weak dependencies:"
-echo " weak-pkg                      noarch           3.0.0-1           fedora          5 k"
-echo "Transaction Summary"
-echo "================================================================================"
-echo "Install  3 Packages"
-`
-	env.WriteFile("bin/dnf", dnfMock)
-	err := os.Chmod(env.GetPath("bin/dnf"), 0755)
+// newDnfFixture returns a dnf backend replaying the commands of the dnf
+// fixture, so that the transactions run without dnf being installed.
+func newDnfFixture(t *testing.T) RPM {
+	replayer, err := cmdrunner.LoadReplayer("testdata/dnf.json", nil)
 	require.NoError(t, err)
+	return NewRPM("/usr/bin/rpm", Dnf, "/usr/bin/dnf", "").WithRunner(replayer)
+}
 
-	rpm := NewRPMTest("rpm", Dnf, env.GetPath("bin/dnf"), "")
+func TestDnfInstallPackage(t *testing.T) {
+	rpm := newDnfFixture(t)
 
-	// Case 1: Default install (should install weak deps, meaning NoRecommends is false by default)
-	output, err := rpm.InstallPackageSysCall(nil, nil, syspackage.InstallPackageParams{
+	// Case 1: Default install, which installs the weak dependencies
+	// with --setopt=install_weak_deps=True
+	result, err := rpm.InstallPackageSysCall(context.Background(), nil, syspackage.InstallPackageParams{
 		Name: "test-pkg",
 	})
 	require.NoError(t, err)
 
-	// Parse the output as structured JSON
-	var result syspackage.InstallResult
-	err = json.Unmarshal([]byte(output), &result)
-	require.NoError(t, err)
-
 	assert.Len(t, result.Installed, 1)
 	assert.Equal(t, "test-pkg", result.Installed[0].Name)
 	assert.Equal(t, "1.2.3-1", result.Installed[0].Version)
@@ -239,63 +216,25 @@ echo "Install  3 Packages"
 	assert.Equal(t, "weak-pkg", result.Recommended[0].Name)
 	assert.Equal(t, "3.0.0-1", result.Recommended[0].Version)
 
-	// Case 2: Install with NoRecommends set to true
-	_, err = rpm.InstallPackageSysCall(nil, nil, syspackage.InstallPackageParams{
+	// Case 2: Install with NoRecommends, --setopt=install_weak_deps=False
+	_, err = rpm.InstallPackageSysCall(context.Background(), nil, syspackage.InstallPackageParams{
 		Name:         "test-pkg-no-rec",
 		NoRecommends: true,
 	})
 	require.NoError(t, err)
-
-	// Verify the arguments passed to dnf mock
-	argsLog, err := os.ReadFile(env.GetPath("dnf_args.log"))
-	require.NoError(t, err)
-	argsStr := string(argsLog)
-
-	// Default: NoRecommends: false -> --setopt=install_weak_deps=True
-	assert.Contains(t, argsStr, "install -y --setopt=install_weak_deps=True test-pkg")
-	// NoRecommends: true -> --setopt=install_weak_deps=False
-	assert.Contains(t, argsStr, "install -y --setopt=install_weak_deps=False test-pkg-no-rec")
 }
 
 func TestZypperInstallPackage(t *testing.T) {
-	env := testenv.New(t)
-	defer env.RemoveAll()
-
-	binDir := env.GetPath("bin")
-	env.MkdirAll("bin")
-
-	oldPath := os.Getenv("PATH")
-	os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)
-	defer os.Setenv("PATH", oldPath)
-
-	// Mock zypper to simulate install commands and verify recommends configuration
-	zypperMock := `#!/bin/sh
-# Log all args to a file to verify correct flags are passed
-echo "$@" >> "` + env.GetPath("zypper_args.log") + `"
-echo "The following NEW packages are going to be installed:"
-echo "  test-pkg  1.2.3-1"
-echo "  child-pkg  2.0.0-1"
-echo ""
-echo "The following recommended packages were automatically selected:"
-echo "  rec-pkg  3.0.0-1"
-`
-	env.WriteFile("bin/zypper", zypperMock)
-	err := os.Chmod(env.GetPath("bin/zypper"), 0755)
+	replayer, err := cmdrunner.LoadReplayer("testdata/zypper.json", nil)
 	require.NoError(t, err)
+	rpm := NewRPM("/usr/bin/rpm", Zypper, "/usr/bin/zypper", "").WithRunner(replayer)
 
-	rpm := NewRPMTest("rpm", Zypper, env.GetPath("bin/zypper"), "")
-
-	// Case 1: Default install (should install recommended packages by default, so --no-recommends is NOT passed)
-	output, err := rpm.InstallPackageSysCall(nil, nil, syspackage.InstallPackageParams{
+	// Case 1: Default install, which passes --recommends
+	result, err := rpm.InstallPackageSysCall(context.Background(), nil, syspackage.InstallPackageParams{
 		Name: "test-pkg",
 	})
 	require.NoError(t, err)
 
-	// Parse the output as structured JSON
-	var result syspackage.InstallResult
-	err = json.Unmarshal([]byte(output), &result)
-	require.NoError(t, err)
-
 	assert.Len(t, result.Installed, 1)
 	assert.Equal(t, "test-pkg", result.Installed[0].Name)
 	assert.Equal(t, "1.2.3-1", result.Installed[0].Version)
@@ -308,22 +247,113 @@ echo "  rec-pkg  3.0.0-1"
 	assert.Equal(t, "rec-pkg", result.Recommended[0].Name)
 	assert.Equal(t, "3.0.0-1", result.Recommended[0].Version)
 
-	// Case 2: Install with NoRecommends set to true
-	_, err = rpm.InstallPackageSysCall(nil, nil, syspackage.InstallPackageParams{
+	// Case 2: Install with NoRecommends, which passes --no-recommends
+	_, err = rpm.InstallPackageSysCall(context.Background(), nil, syspackage.InstallPackageParams{
 		Name:         "other-pkg",
 		NoRecommends: true,
 	})
 	require.NoError(t, err)
+}
 
-	// Verify the arguments passed to zypper mock
-	argsLog, err := os.ReadFile(env.GetPath("zypper_args.log"))
+func TestDnfUpdatePackage(t *testing.T) {
+	rpm := newDnfFixture(t)
+
+	result, err := rpm.UpdatePackageSysCall(context.Background(), nil, syspackage.UpdatePackageParams{
+		Repos: []string{"fedora"},
+	})
 	require.NoError(t, err)
-	argsStr := string(argsLog)
 
-	// Default: NoRecommends is false, so --no-recommends should NOT be present, but --recommends should be present for test-pkg
-	assert.Contains(t, argsStr, "install --recommends test-pkg")
-	assert.NotContains(t, argsStr, "--no-recommends test-pkg")
+	require.Len(t, result.Upgraded, 1)
+	assert.Equal(t, "test-pkg", result.Upgraded[0].Name)
+	assert.Equal(t, "1.2.4-1", result.Upgraded[0].Version)
+	require.Len(t, result.New, 1)
+	assert.Equal(t, "new-dep", result.New[0].Name)
+
+	// Refresh of a single repo must not pass shell quotes to dnf
+	err = rpm.RefreshReposSysCall(context.Background(), nil, "fedora")
+	require.NoError(t, err)
+}
+
+func TestDnfRemovePackage(t *testing.T) {
+	rpm := newDnfFixture(t)
+
+	// dnf exits with 1 when --assumeno aborts the transaction
+	output, err := rpm.RemovePackageSysCall(context.Background(), nil, syspackage.RemovePackageParams{
+		Name:        "test-pkg",
+		RemoveDeps:  true,
+		ShowDetails: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "test-pkg", Arch: "x86_64", Version: "1.0-1.fc40"},
+		{Name: "libtest", Arch: "x86_64", Version: "1.0-1.fc40"},
+	}, syspackage.ParseRemovedPackages(output))
+}
+
+// TestDnfConfirmRemove plans and confirms a removal, whose dry runs have to
+// succeed although dnf exits with 1.
+func TestDnfConfirmRemove(t *testing.T) {
+	sysPkg := syspackage.SysPackage{SysPackageInterface: newDnfFixture(t), Confirm: confirm.NewStore(time.Minute)}
+	params := syspackage.RemovePackageParams{Name: "test-pkg", RemoveDeps: true}
+
+	_, plan, err := sysPkg.RemovePackage(context.Background(), nil, params)
+	require.NoError(t, err)
+	require.NotNil(t, plan.Confirmation)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "test-pkg", Arch: "x86_64", Version: "1.0-1.fc40"},
+		{Name: "libtest", Arch: "x86_64", Version: "1.0-1.fc40"},
+	}, plan.Removed)
+
+	params.ConfirmToken = plan.Confirmation.Token
+	_, res, err := sysPkg.RemovePackage(context.Background(), nil, params)
+	require.NoError(t, err)
+	assert.Nil(t, res.Confirmation)
+	assert.Equal(t, plan.Removed, res.Removed)
+}
+
+func TestZypperUpdatePackage(t *testing.T) {
+	replayer, err := cmdrunner.LoadReplayer("testdata/zypper.json", nil)
+	require.NoError(t, err)
+	rpm := NewRPM("/usr/bin/rpm", Zypper, "/usr/bin/zypper", "").WithRunner(replayer)
+
+	result, err := rpm.UpdatePackageSysCall(context.Background(), nil, syspackage.UpdatePackageParams{
+		Upgrade: true,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, result.Upgraded, 1)
+	assert.Equal(t, syspackage.PackageInfo{Name: "test-pkg", OldVersion: "1.2.3-1", Version: "1.2.4-1", Arch: "x86_64"}, result.Upgraded[0])
+	require.Len(t, result.Removed, 1)
+	assert.Equal(t, "old-pkg", result.Removed[0].Name)
+}
+
+func TestDnfInstallPatches(t *testing.T) {
+	rpm := newDnfFixture(t)
+
+	patches, err := rpm.ListPatchesSysCall(context.Background(), nil, syspackage.ListPatchesParams{Category: "security", Severity: "important"})
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+	assert.Equal(t, "FEDORA-2024-1a2b3c", patches[0]["name"])
+	assert.Equal(t, "needed", patches[0]["status"])
+	assert.Equal(t, []string{"CVE-2023-46218"}, patches[0]["cves"])
+
+	// the dry run shows the packages of the advisories
+	result, err := rpm.InstallPatchesSysCall(context.Background(), nil, syspackage.InstallPatchesParams{Category: "security", ShowDetails: true})
+	require.NoError(t, err)
+	require.Len(t, result.Patches, 1)
+	assert.Equal(t, "needed", result.Patches[0]["status"])
+	require.NotNil(t, result.Changes)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "curl", Arch: "x86_64", Version: "8.2.1-4.fc39"},
+		{Name: "libcurl", Arch: "x86_64", Version: "8.2.1-4.fc39"},
+	}, result.Changes.Upgraded)
+
+	// only the listed advisories are installed
+	result, err = rpm.InstallPatchesSysCall(context.Background(), nil, syspackage.InstallPatchesParams{Category: "security"})
+	require.NoError(t, err)
+	require.Len(t, result.Patches, 1)
+	assert.Equal(t, "applied", result.Patches[0]["status"])
 
-	// NoRecommends: true -> --no-recommends should be present
-	assert.Contains(t, argsStr, "install --no-recommends other-pkg")
+	_, err = rpm.ListPatchesSysCall(context.Background(), nil, syspackage.ListPatchesParams{Category: "yast"})
+	assert.Error(t, err)
 }
@@ -0,0 +1,165 @@
+package rpm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+// TestZypperFixture parses recorded zypper output, so it runs without zypper
+// being installed.
+func TestZypperFixture(t *testing.T) {
+	root := t.TempDir()
+	replayer, err := cmdrunner.LoadReplayer("testdata/zypper.json", cmdrunner.Vars{"ROOT": root})
+	require.NoError(t, err)
+	rpm := NewRPM("/usr/bin/rpm", Zypper, "/usr/bin/zypper", root).WithRunner(replayer)
+	ctx := context.Background()
+
+	pkgs, err := rpm.SearchPackageSysCall(ctx, nil, syspackage.SearchPackageParams{Name: "vim"})
+	require.NoError(t, err)
+	assert.Equal(t, syspackage.SearchResult{
+		"(System Packages)": {"x86_64": {{Name: "vim", Version: "9.1.0836-1.1", Status: "installed"}}},
+		"repo-oss": {
+			"x86_64": {{Name: "vim", Version: "9.1.0836-1.1", Status: "not-installed"}},
+			"noarch": {{Name: "vim-data", Version: "9.1.0836-1.1", Status: "not-installed"}},
+		},
+		"repo-update": {"x86_64": {{Name: "vim", Version: "9.1.0330-1.1", Status: "other-version"}}},
+	}, pkgs)
+
+	// zypper exits with 104 if nothing is found
+	pkgs, err = rpm.SearchPackageSysCall(ctx, nil, syspackage.SearchPackageParams{Name: "nonexistent", Exact: true})
+	require.NoError(t, err)
+	assert.Empty(t, pkgs)
+
+	res, err := rpm.UpdatePackageSysCall(ctx, nil, syspackage.UpdatePackageParams{})
+	require.NoError(t, err)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "libzypp", OldVersion: "17.35.12-1.1", Version: "17.35.14-1.1", Arch: "x86_64"},
+		{Name: "zypper", OldVersion: "1.14.77-1.1", Version: "1.14.78-1.1", Arch: "x86_64"},
+	}, res.Upgraded)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "libsolv-tools-base", Version: "0.7.31-1.1", Arch: "x86_64"},
+	}, res.New)
+
+	// the install summary lists the patches along with their packages
+	patches, err := rpm.InstallPatchesSysCall(ctx, nil, syspackage.InstallPatchesParams{Category: "security", ShowDetails: true})
+	require.NoError(t, err)
+	require.NotNil(t, patches.Changes)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "vim", OldVersion: "9.1.0330-1.1", Version: "9.1.0836-1.1", Arch: "x86_64"},
+		{Name: "vim-data-common", OldVersion: "9.1.0330-1.1", Version: "9.1.0836-1.1", Arch: "noarch"},
+	}, patches.Changes.Upgraded)
+	assert.Empty(t, patches.Changes.New)
+}
+
+// TestZypperElicitation replays the prompts of zypper, which are answered
+// by the user through the elicitation of the client.
+func TestZypperElicitation(t *testing.T) {
+	root := t.TempDir()
+	replayer, err := cmdrunner.LoadReplayer("testdata/zypper-elicit.json", cmdrunner.Vars{"ROOT": root})
+	require.NoError(t, err)
+	sysPkg := syspackage.SysPackage{SysPackageInterface: NewRPM("/usr/bin/rpm", Zypper, "/usr/bin/zypper", root).WithRunner(replayer)}
+	ctx := context.Background()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "install_package"}, sysPkg.InstallPackage)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+
+	var messages []string
+	confirm := true
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, &mcp.ClientOptions{
+		ElicitationHandler: func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+			messages = append(messages, req.Params.Message)
+			if strings.HasPrefix(req.Params.Message, "zypper can't solve") {
+				return &mcp.ElicitResult{Action: "accept", Content: map[string]any{"choice": "deinstallation of nginx-1.27.2-1.1.x86_64"}}, nil
+			}
+			return &mcp.ElicitResult{Action: "accept", Content: map[string]any{"confirm": confirm}}, nil
+		},
+	})
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "install_package", Arguments: map[string]any{"name": "apache2"}})
+	require.NoError(t, err)
+	require.False(t, res.IsError, res.Content)
+	assert.Equal(t, []string{
+		"zypper can't solve the dependencies: the to be installed apache2-2.4.62-1.1.x86_64 conflicts with 'nginx' provided by the installed nginx-1.27.2-1.1.x86_64. Choose a solution:",
+		"The transaction also removes nginx. Continue?",
+	}, messages)
+
+	// the license is only shown when the transaction is committed
+	messages = nil
+	res, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "install_package", Arguments: map[string]any{"name": "unrar"}})
+	require.NoError(t, err)
+	require.False(t, res.IsError, res.Content)
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "Installing unrar-7.0.9-1.1.x86_64 needs you to agree to its license:\n\nUnRAR freeware license")
+
+	confirm = false
+	res, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "install_package", Arguments: map[string]any{"name": "unrar"}})
+	require.NoError(t, err)
+	assert.True(t, res.IsError)
+	assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "declined by the user")
+}
+
+// TestZypperSolverProblems replays an installation failing on a dependency
+// problem, which is returned with its solutions, and the installation with
+// the chosen solution.
+func TestZypperSolverProblems(t *testing.T) {
+	root := t.TempDir()
+	replayer, err := cmdrunner.LoadReplayer("testdata/zypper-problems.json", cmdrunner.Vars{"ROOT": root})
+	require.NoError(t, err)
+	sysPkg := syspackage.SysPackage{SysPackageInterface: NewRPM("/usr/bin/rpm", Zypper, "/usr/bin/zypper", root).WithRunner(replayer)}
+	ctx := context.Background()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "install_package"}, sysPkg.InstallPackage)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "install_package", Arguments: map[string]any{"name": "apache2"}})
+	require.NoError(t, err)
+	require.True(t, res.IsError)
+	assert.Equal(t, "the dependencies can't be solved, problem 1: the to be installed apache2-2.4.62-1.1.x86_64 conflicts with 'nginx' provided by the installed nginx-1.27.2-1.1.x86_64; call install_package again with the id of the chosen solution of every problem in solutions", res.Content[0].(*mcp.TextContent).Text)
+	var result syspackage.InstallResult
+	content, err := json.Marshal(res.StructuredContent)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(content, &result))
+	assert.Equal(t, []syspackage.SolverProblem{{
+		ID:          1,
+		Description: "the to be installed apache2-2.4.62-1.1.x86_64 conflicts with 'nginx' provided by the installed nginx-1.27.2-1.1.x86_64",
+		Solutions: []syspackage.SolverSolution{
+			{ID: 1, Description: "deinstallation of nginx-1.27.2-1.1.x86_64"},
+			{ID: 2, Description: "do not install apache2-2.4.62-1.1.x86_64"},
+		},
+	}}, result.Problems)
+	assert.Contains(t, result.RawOutput, "Choose from above solutions")
+
+	res, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "install_package", Arguments: map[string]any{"name": "apache2", "solutions": []int{1}}})
+	require.NoError(t, err)
+	require.False(t, res.IsError, res.Content)
+	content, err = json.Marshal(res.StructuredContent)
+	require.NoError(t, err)
+	result = syspackage.InstallResult{}
+	require.NoError(t, json.Unmarshal(content, &result))
+	assert.Empty(t, result.Problems)
+	assert.Contains(t, result.RawOutput, "Installing: apache2-2.4.62-1.1.x86_64")
+
+	_, _, err = sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "apache2", Solutions: []int{0}})
+	assert.EqualError(t, err, "invalid solution id: 0")
+}
@@ -0,0 +1,221 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// rpm header tags, see rpmtag.h
+const (
+	tagName             = 1000
+	tagVersion          = 1001
+	tagRelease          = 1002
+	tagEpoch            = 1003
+	tagSummary          = 1004
+	tagDescription      = 1005
+	tagBuildTime        = 1006
+	tagBuildHost        = 1007
+	tagInstallTime      = 1008
+	tagSize             = 1009
+	tagVendor           = 1011
+	tagLicense          = 1014
+	tagPackager         = 1015
+	tagGroup            = 1016
+	tagURL              = 1020
+	tagArch             = 1022
+	tagPreIn            = 1023
+	tagPostIn           = 1024
+	tagPreUn            = 1025
+	tagPostUn           = 1026
+	tagOldFilenames     = 1027
+	tagSourceRPM        = 1044
+	tagProvideName      = 1047
+	tagRequireFlags     = 1048
+	tagRequireName      = 1049
+	tagRequireVersion   = 1050
+	tagConflictFlags    = 1053
+	tagConflictName     = 1054
+	tagConflictVersion  = 1055
+	tagChangelogTime    = 1080
+	tagChangelogName    = 1081
+	tagChangelogText    = 1082
+	tagPreInProg        = 1085
+	tagPostInProg       = 1086
+	tagPreUnProg        = 1087
+	tagPostUnProg       = 1088
+	tagObsoleteName     = 1090
+	tagProvideFlags     = 1112
+	tagProvideVersion   = 1113
+	tagObsoleteFlags    = 1114
+	tagObsoleteVersion  = 1115
+	tagDirIndexes       = 1116
+	tagBaseNames        = 1117
+	tagDirNames         = 1118
+	tagLongSize         = 5009
+	tagRecommendName    = 5046
+	tagRecommendVersion = 5047
+	tagRecommendFlags   = 5048
+	tagSuggestName      = 5049
+	tagSuggestVersion   = 5050
+	tagSuggestFlags     = 5051
+	tagSupplementName   = 5052
+	tagSupplementVer    = 5053
+	tagSupplementFlags  = 5054
+	tagEnhanceName      = 5055
+	tagEnhanceVersion   = 5056
+	tagEnhanceFlags     = 5057
+)
+
+// rpm header data types
+const (
+	typeChar        = 1
+	typeInt8        = 2
+	typeInt16       = 3
+	typeInt32       = 4
+	typeInt64       = 5
+	typeString      = 6
+	typeBin         = 7
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// dependency flags
+const (
+	senseLess    = 1 << 1
+	senseGreater = 1 << 2
+	senseEqual   = 1 << 3
+)
+
+var errHeaderFormat = errors.New("invalid rpm header")
+
+type headerEntry struct {
+	typ    uint32
+	offset uint32
+	count  uint32
+}
+
+// rpmHeader is a header blob as stored in the rpm database: the number of
+// index entries and the size of the data store, followed by the index
+// entries (tag, type, offset, count) and the data store.
+type rpmHeader struct {
+	entries map[uint32]headerEntry
+	data    []byte
+}
+
+func parseHeader(blob []byte) (*rpmHeader, error) {
+	if len(blob) < 8 {
+		return nil, errHeaderFormat
+	}
+	il := binary.BigEndian.Uint32(blob[0:4])
+	dl := binary.BigEndian.Uint32(blob[4:8])
+	indexEnd := 8 + uint64(il)*16
+	if indexEnd+uint64(dl) > uint64(len(blob)) {
+		return nil, errHeaderFormat
+	}
+	hdr := &rpmHeader{
+		entries: make(map[uint32]headerEntry, il),
+		data:    blob[indexEnd : indexEnd+uint64(dl)],
+	}
+	for i := uint64(0); i < uint64(il); i++ {
+		entry := blob[8+i*16 : 8+(i+1)*16]
+		tag := binary.BigEndian.Uint32(entry[0:4])
+		e := headerEntry{
+			typ:    binary.BigEndian.Uint32(entry[4:8]),
+			offset: binary.BigEndian.Uint32(entry[8:12]),
+			count:  binary.BigEndian.Uint32(entry[12:16]),
+		}
+		if e.offset > dl {
+			return nil, errHeaderFormat
+		}
+		hdr.entries[tag] = e
+	}
+	return hdr, nil
+}
+
+// strs returns the values of a string tag. Strings are NUL terminated and
+// for arrays stored one after another. Only the first, untranslated value of
+// an i18n string is returned.
+func (hdr *rpmHeader) strs(tag uint32) []string {
+	e, ok := hdr.entries[tag]
+	if !ok {
+		return nil
+	}
+	count := e.count
+	switch e.typ {
+	case typeString, typeI18NString:
+		count = 1
+	case typeStringArray:
+	default:
+		return nil
+	}
+	data := hdr.data[e.offset:]
+	values := make([]string, 0, min(count, 4096))
+	for i := uint32(0); i < count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end == -1 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+// str returns the first value of a string tag or "" if it isn't set.
+func (hdr *rpmHeader) str(tag uint32) string {
+	values := hdr.strs(tag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// ints returns the values of an integer tag.
+func (hdr *rpmHeader) ints(tag uint32) []int64 {
+	e, ok := hdr.entries[tag]
+	if !ok {
+		return nil
+	}
+	var size uint32
+	switch e.typ {
+	case typeChar, typeInt8:
+		size = 1
+	case typeInt16:
+		size = 2
+	case typeInt32:
+		size = 4
+	case typeInt64:
+		size = 8
+	default:
+		return nil
+	}
+	data := hdr.data[e.offset:]
+	if uint64(e.count)*uint64(size) > uint64(len(data)) {
+		return nil
+	}
+	values := make([]int64, e.count)
+	for i := range values {
+		item := data[uint32(i)*size:]
+		switch size {
+		case 1:
+			values[i] = int64(item[0])
+		case 2:
+			values[i] = int64(binary.BigEndian.Uint16(item))
+		case 4:
+			values[i] = int64(binary.BigEndian.Uint32(item))
+		case 8:
+			values[i] = int64(binary.BigEndian.Uint64(item))
+		}
+	}
+	return values
+}
+
+// num returns the first value of an integer tag.
+func (hdr *rpmHeader) num(tag uint32) (int64, bool) {
+	values := hdr.ints(tag)
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
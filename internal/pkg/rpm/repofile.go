@@ -0,0 +1,69 @@
+package rpm
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// readRepoFile returns the key/value pairs of the section id in the ini style
+// repo file at path, as used by zypper and dnf. Continuation lines, which are
+// common for gpgkey and baseurl, are joined with a newline. A missing file or
+// section results in an empty map.
+func readRepoFile(path string, id string) map[string]string {
+	values := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	inSection := false
+	lastKey := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inSection = strings.TrimSpace(trimmed[1:len(trimmed)-1]) == id
+			lastKey = ""
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && lastKey != "" {
+			values[lastKey] += "\n" + trimmed
+			continue
+		}
+		parts := strings.SplitN(trimmed, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		lastKey = strings.TrimSpace(parts[0])
+		values[lastKey] = strings.TrimSpace(parts[1])
+	}
+	return values
+}
+
+// splitRepoList splits a list value like baseurl or gpgkey, which can be
+// separated by whitespace, commas or newlines.
+func splitRepoList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// repoBool interprets the boolean values used in repo files and in the
+// output of the package managers.
+func repoBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "yes", "true", "on", "enabled":
+		return true
+	default:
+		return false
+	}
+}
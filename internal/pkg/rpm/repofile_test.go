@@ -0,0 +1,136 @@
+package rpm
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/testenv"
+)
+
+const fedoraRepoFile = `[fedora]
+name=Fedora $releasever - $basearch
+#baseurl=http://download.example/pub/fedora/linux/releases/$releasever/Everything/$basearch/os/
+metalink=https://mirrors.fedoraproject.org/metalink?repo=fedora-$releasever&arch=$basearch
+enabled=1
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-fedora-$releasever-$basearch
+       file:///etc/pki/rpm-gpg/RPM-GPG-KEY-fedora-extra
+
+[fedora-debuginfo]
+name=Fedora $releasever - $basearch - Debug
+enabled=0
+gpgcheck=0
+`
+
+func TestReadRepoFile(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/yum.repos.d/fedora.repo", fedoraRepoFile)
+
+	values := readRepoFile(env.GetPath("etc/yum.repos.d/fedora.repo"), "fedora")
+	assert.Equal(t, "1", values["gpgcheck"])
+	assert.NotContains(t, values, "baseurl")
+	assert.Equal(t, []string{
+		"file:///etc/pki/rpm-gpg/RPM-GPG-KEY-fedora-$releasever-$basearch",
+		"file:///etc/pki/rpm-gpg/RPM-GPG-KEY-fedora-extra",
+	}, splitRepoList(values["gpgkey"]))
+
+	debug := readRepoFile(env.GetPath("etc/yum.repos.d/fedora.repo"), "fedora-debuginfo")
+	assert.Equal(t, "0", debug["enabled"])
+
+	assert.Empty(t, readRepoFile(env.GetPath("etc/yum.repos.d/missing.repo"), "fedora"))
+}
+
+func TestDnfRepository(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/yum.repos.d/fedora.repo", fedoraRepoFile)
+
+	rpm := NewRPMTest("rpm", Dnf, "dnf", env.GetPath(""))
+
+	// dnf5 style keys
+	repo := rpm.dnfRepository(map[string]string{
+		"Repo ID":     "fedora",
+		"Name":        "Fedora 40 - x86_64",
+		"Status":      "enabled",
+		"Priority":    "99",
+		"Base URL":    "http://a.example/os, http://b.example/os",
+		"Config file": "/etc/yum.repos.d/fedora.repo",
+		"Cost":        "1000",
+	})
+	assert.Equal(t, "fedora", repo.ID)
+	assert.Equal(t, "Fedora 40 - x86_64", repo.Name)
+	assert.True(t, repo.Enabled)
+	assert.Equal(t, 99, repo.Priority)
+	assert.Equal(t, []string{"http://a.example/os", "http://b.example/os"}, repo.URLs)
+	assert.Equal(t, "/etc/yum.repos.d/fedora.repo", repo.SourceFile)
+	assert.True(t, repo.GPGCheck)
+	assert.Len(t, repo.Keys, 2)
+	assert.Equal(t, "1000", repo.Extras["Cost"])
+
+	// dnf4 style keys
+	repo = rpm.dnfRepository(map[string]string{
+		"Repo-id":      "updates",
+		"Repo-name":    "Fedora 40 - x86_64 - Updates",
+		"Repo-status":  "disabled",
+		"Repo-baseurl": "http://c.example/updates (2 more)",
+	})
+	assert.Equal(t, "updates", repo.ID)
+	assert.Equal(t, "Fedora 40 - x86_64 - Updates", repo.Name)
+	assert.False(t, repo.Enabled)
+	assert.Equal(t, []string{"http://c.example/updates"}, repo.URLs)
+	assert.False(t, repo.GPGCheck)
+}
+
+func TestZypperListRepos(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	env.WriteFile("etc/zypp/repos.d/repo-oss.repo", `[repo-oss]
+name=Main Repository
+gpgkey=https://download.opensuse.org/repositories/repodata/repomd.xml.key
+`)
+	zypperMock := `#!/bin/sh
+cat <<EOX
+<?xml version='1.0'?>
+<stream>
+<repo-list>
+<repo alias="repo-oss" name="Main Repository" type="rpm-md" priority="99" enabled="1" autorefresh="1" gpgcheck="1" repo_gpgcheck="1" pkg_gpgcheck="0" keeppackages="0">
+<url>http://download.opensuse.org/tumbleweed/repo/oss/</url>
+</repo>
+<repo alias="repo-debug" name="Debug Repository" type="NONE" priority="90" enabled="0" autorefresh="0" gpgcheck="0">
+<url>http://download.opensuse.org/debug/tumbleweed/repo/oss/</url>
+</repo>
+</repo-list>
+</stream>
+EOX
+`
+	env.WriteFile("bin/zypper", zypperMock)
+	err := os.Chmod(env.GetPath("bin/zypper"), 0755)
+	require.NoError(t, err)
+
+	rpm := NewRPMTest("rpm", Zypper, env.GetPath("bin/zypper"), env.GetPath(""))
+	repos, err := rpm.ListReposSysCall(context.Background(), nil, "")
+	require.NoError(t, err)
+	require.Len(t, repos, 2)
+
+	assert.Equal(t, "repo-oss", repos[0].ID)
+	assert.Equal(t, "Main Repository", repos[0].Name)
+	assert.Equal(t, []string{"http://download.opensuse.org/tumbleweed/repo/oss/"}, repos[0].URLs)
+	assert.True(t, repos[0].Enabled)
+	assert.True(t, repos[0].GPGCheck)
+	assert.True(t, repos[0].AutoRefresh)
+	assert.Equal(t, 99, repos[0].Priority)
+	assert.Equal(t, "rpm-md", repos[0].Type)
+	assert.Equal(t, env.GetPath("etc/zypp/repos.d/repo-oss.repo"), repos[0].SourceFile)
+	assert.Equal(t, []string{"https://download.opensuse.org/repositories/repodata/repomd.xml.key"}, repos[0].Keys)
+	assert.Equal(t, "1", repos[0].Extras["repo_gpgcheck"])
+
+	assert.Equal(t, "repo-debug", repos[1].ID)
+	assert.False(t, repos[1].Enabled)
+	assert.False(t, repos[1].GPGCheck)
+	assert.Empty(t, repos[1].SourceFile)
+}
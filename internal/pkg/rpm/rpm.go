@@ -4,13 +4,18 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os/exec"
 	"path"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 )
 
@@ -31,6 +36,7 @@ type RPM struct {
 	mgr     PkgMgr
 	root    string
 	isTest  bool
+	runner  cmdrunner.Runner
 }
 
 func NewRPM(path string, systype RPMType, mgrpath string, root string) RPM {
@@ -40,7 +46,8 @@ func NewRPM(path string, systype RPMType, mgrpath string, root string) RPM {
 			mgrtype: systype,
 			mgrpath: mgrpath,
 		},
-		root: root,
+		root:   root,
+		runner: cmdrunner.Exec{},
 	}
 }
 
@@ -53,184 +60,373 @@ func NewRPMTest(path string, systype RPMType, mgrpath string, root string) RPM {
 		},
 		root:   root,
 		isTest: true,
+		runner: cmdrunner.Exec{},
+	}
+}
+
+// WithRunner returns the backend running its commands with runner.
+func (rpm RPM) WithRunner(runner cmdrunner.Runner) RPM {
+	rpm.runner = runner
+	return rpm
+}
+
+// run runs a package manager command and returns its combined output. The
+// command is interrupted when ctx is cancelled.
+func (rpm RPM) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return rpm.runner.Run(ctx, cmdrunner.New(name, args...))
+}
+
+// SystemInfoSysCall reports the package manager and the versions of rpm
+// and of the package manager.
+func (rpm RPM) SystemInfoSysCall(ctx context.Context, request *mcp.CallToolRequest) (syspackage.SystemInfo, error) {
+	backend := "zypper"
+	if rpm.mgr.mgrtype == Dnf {
+		backend = "dnf"
+	}
+	info := syspackage.NewSystemInfo(backend, rpm.root)
+	for name, binary := range map[string]string{"rpm": rpm.rpmpath, backend: rpm.mgr.mgrpath} {
+		if version := syspackage.ToolVersion(ctx, rpm.runner, binary); version != "" {
+			info.Versions[name] = version
+		}
+	}
+	return info, nil
+}
+
+// Capabilities supports all operations with zypper and dnf, and only the
+// queries of the rpm database without them. Only zypper offers solutions
+// to dependency problems.
+func (rpm RPM) Capabilities() syspackage.Capabilities {
+	if rpm.mgr.mgrtype != Zypper && rpm.mgr.mgrtype != Dnf {
+		caps := syspackage.NoCapabilities("no rpm package manager installed")
+		delete(caps.Unsupported, "list_packages")
+		delete(caps.Unsupported, "query_package")
+		caps.QueryModes = syspackage.ValidQueryModes()
+		caps.Relations = syspackage.ValidRelations()
+		return caps
+	}
+	caps := syspackage.AllCapabilities()
+	caps.Solutions = rpm.mgr.mgrtype == Zypper
+	return caps
+}
+
+func (rpm RPM) RepoConfigPaths() []string {
+	switch rpm.mgr.mgrtype {
+	case Zypper:
+		return []string{path.Join("/", rpm.root, "etc/zypp/repos.d")}
+	case Dnf:
+		return []string{path.Join("/", rpm.root, "etc/yum.repos.d")}
 	}
+	return nil
 }
 
 // ListInstalledPackagesSysCall lists the installed packages given by their name pattern.
-func (rpm RPM) ListInstalledPackagesSysCall(params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
-	// The query format doesn't need shell quoting since exec.Command passes arguments directly.
-	qf := `%{NAME},%{VERSION},%{SIZE}\n`
-	args := []string{}
+// The rpm database is read natively if possible, so that images without rpm
+// can be inspected, and the rpm binary is used otherwise.
+func (rpm RPM) ListInstalledPackagesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+	lst, err := rpm.listRpmdb(params)
+	if !errors.Is(err, errNoRpmdb) {
+		return lst, err
+	}
+	return rpm.listInstalledRpm(ctx, params)
+}
+
+// rpmDBArgs returns the arguments selecting the rpm database of the root.
+func (rpm RPM) rpmDBArgs() []string {
 	if rpm.isTest {
-		args = append(args, "--dbpath", path.Join(rpm.root, "/var/lib/rpm"))
+		return []string{"--dbpath", path.Join(rpm.root, "/var/lib/rpm")}
 	} else if rpm.root != "" {
-		args = append(args, "--root", rpm.root)
-	}
-	args = append(args, "-qa", "--qf", qf)
-	if params.Name != "" {
-		args = append(args, params.Name)
+		return []string{"--root", rpm.root}
 	}
+	return nil
+}
 
-	cmd := exec.Command(rpm.rpmpath, args...)
-	pkgList, err := cmd.CombinedOutput()
+// The query format doesn't need shell quoting since the arguments are passed arguments directly.
+// Fields are separated by tabs as vendor and license may contain commas.
+const rpmInfoFormat = `%{NAME}\t%{EPOCHNUM}\t%{VERSION}\t%{RELEASE}\t%{ARCH}\t%{SIZE}\t%{VENDOR}\t%{LICENSE}\t%{SOURCERPM}\t%{INSTALLTIME}\t%{BUILDTIME}`
 
-	// rpm exits with 1 if no packages are found. This is not an error for us.
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
-			// No packages found, return empty list
-			return []syspackage.SysPackageInfo{}, nil
-		}
-		return nil, fmt.Errorf("rpm command failed: %w, output: %s", err, string(pkgList))
-	}
+// Separators of the batched query, descriptions and changelogs may contain
+// any printable character.
+const (
+	rpmRecordSep = "\x1e"
+	rpmFieldSep  = "\x1f"
+	rpmItemSep   = "\x1d"
+)
 
-	var lst []syspackage.SysPackageInfo
-	scanner := bufio.NewScanner(bytes.NewReader(pkgList))
-	for scanner.Scan() {
-		line := scanner.Text()
-		// The output might have leading/trailing single quotes from the old command format, let's be robust.
-		line = strings.Trim(line, "'")
-		splitLine := strings.Split(line, ",")
-		if len(splitLine) != 3 {
+// rpmRelationTags are the tags printed by 'rpm -q --requires' and friends.
+var rpmRelationTags = map[string]string{
+	"requires":    "REQUIRENEVRS",
+	"recommends":  "RECOMMENDNEVRS",
+	"obsoletes":   "OBSOLETENEVRS",
+	"provides":    "PROVIDENEVRS",
+	"conflicts":   "CONFLICTNEVRS",
+	"suggests":    "SUGGESTNEVRS",
+	"supplements": "SUPPLEMENTNEVRS",
+	"enhances":    "ENHANCENEVRS",
+}
+
+// rpmChangelogFormat is the format of 'rpm -q --changelog'.
+const rpmChangelogFormat = `[* %{CHANGELOGTIME:day} %{CHANGELOGNAME}\n%{CHANGELOGTEXT}\n\n]`
+
+// rpmWorkers bounds the rpm processes run in parallel for the per package
+// queries.
+var rpmWorkers = min(runtime.NumCPU(), 8)
+
+// rpmQueryFormat returns the query format printing all fields requested by
+// params for a package as one record, together with the keys of the fields
+// following the package info.
+func rpmQueryFormat(params syspackage.ListPackageParams) (string, []string) {
+	format := rpmInfoFormat
+	var keys []string
+	if params.Filelist {
+		format += rpmFieldSep + "[%{FILENAMES}" + rpmItemSep + "]"
+		keys = append(keys, "files")
+	}
+	if params.Description {
+		format += rpmFieldSep + "%{DESCRIPTION}"
+		keys = append(keys, "description")
+	}
+	for _, rel := range params.Relations {
+		rel = strings.ToLower(strings.TrimSpace(rel))
+		tag, ok := rpmRelationTags[rel]
+		if !ok || slices.Contains(keys, rel) {
 			continue
 		}
-		size, err := strconv.ParseUint(splitLine[2], 10, 64)
-		if err != nil {
-			// If size is not a valid number, we can either skip the package or set size to 0.
-			// Setting to 0 seems like a reasonable default.
-			size = 0
-		}
-		lst = append(lst, syspackage.SysPackageInfo{
-			Name:    splitLine[0],
-			Version: splitLine[1],
-			Size:    size,
-		})
+		format += rpmFieldSep + "[%{" + tag + "}" + rpmItemSep + "]"
+		keys = append(keys, rel)
 	}
+	if params.Changelog > 0 {
+		format += rpmFieldSep + rpmChangelogFormat
+		keys = append(keys, "changelog")
+	}
+	return format + rpmRecordSep, keys
+}
 
-	// Fetch additional fields if requested
-	for i := range lst {
-		pkgName := lst[i].Name
-		if params.Filelist {
-			fileArgs := []string{}
-			if rpm.isTest {
-				fileArgs = append(fileArgs, "--dbpath", path.Join(rpm.root, "/var/lib/rpm"))
-			} else if rpm.root != "" {
-				fileArgs = append(fileArgs, "--root", rpm.root)
-			}
-			fileArgs = append(fileArgs, "-ql", pkgName)
-			fileListOut, err := exec.Command(rpm.rpmpath, fileArgs...).CombinedOutput()
-			if err == nil {
-				scannerFiles := bufio.NewScanner(bytes.NewReader(fileListOut))
-				var files []string
-				for scannerFiles.Scan() {
-					f := strings.TrimSpace(scannerFiles.Text())
-					if f != "" {
-						files = append(files, f)
-					}
-				}
-				lst[i].FileList = files
+// parseRpmRecord parses a record printed with the format of rpmQueryFormat.
+func parseRpmRecord(record string, keys []string, params syspackage.ListPackageParams) (syspackage.SysPackageInfo, bool) {
+	fields := strings.Split(record, rpmFieldSep)
+	if len(fields) != len(keys)+1 {
+		return syspackage.SysPackageInfo{}, false
+	}
+	pkg, ok := parseRpmInfoLine(strings.TrimLeft(fields[0], "\n"))
+	if !ok {
+		return pkg, false
+	}
+	for i, key := range keys {
+		value := fields[i+1]
+		switch key {
+		case "files":
+			pkg.FileList = splitRpmItems(value)
+		case "description":
+			pkg.Description = value
+		case "changelog":
+			pkg.Changelog = firstLines(value, params.Changelog)
+		default:
+			if pkg.Relations == nil {
+				pkg.Relations = make(map[string][]string)
 			}
+			pkg.Relations[key] = splitRpmItems(value)
 		}
+	}
+	return pkg, true
+}
 
-		if params.Description {
-			descArgs := []string{}
-			if rpm.isTest {
-				descArgs = append(descArgs, "--dbpath", path.Join(rpm.root, "/var/lib/rpm"))
-			} else if rpm.root != "" {
-				descArgs = append(descArgs, "--root", rpm.root)
-			}
-			descArgs = append(descArgs, "-q", "--qf", "%{DESCRIPTION}", pkgName)
-			descOut, err := exec.Command(rpm.rpmpath, descArgs...).CombinedOutput()
-			if err == nil {
-				lst[i].Description = string(descOut)
-			}
+func splitRpmItems(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, rpmItemSep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
+	}
+	return items
+}
 
-		if len(params.Relations) > 0 {
-			lst[i].Relations = make(map[string][]string)
-			for _, rel := range params.Relations {
-				rel = strings.ToLower(strings.TrimSpace(rel))
-				if rel == "" {
-					continue
-				}
-				var relFlag string
-				switch rel {
-				case "requires":
-					relFlag = "--requires"
-				case "recommends":
-					relFlag = "--recommends"
-				case "obsoletes":
-					relFlag = "--obsoletes"
-				case "provides":
-					relFlag = "--provides"
-				case "conflicts":
-					relFlag = "--conflicts"
-				case "suggests":
-					relFlag = "--suggests"
-				case "supplements":
-					relFlag = "--supplements"
-				case "enhances":
-					relFlag = "--enhances"
-				default:
-					continue
-				}
+// firstLines returns the first count lines of text.
+func firstLines(text string, count uint) string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() && uint(len(lines)) < count {
+		lines = append(lines, scanner.Text())
+	}
+	return strings.Join(lines, "\n")
+}
 
-				relArgs := []string{}
-				if rpm.isTest {
-					relArgs = append(relArgs, "--dbpath", path.Join(rpm.root, "/var/lib/rpm"))
-				} else if rpm.root != "" {
-					relArgs = append(relArgs, "--root", rpm.root)
-				}
-				relArgs = append(relArgs, "-q", relFlag, pkgName)
-				relOut, err := exec.Command(rpm.rpmpath, relArgs...).CombinedOutput()
-				if err == nil {
-					scannerRel := bufio.NewScanner(bytes.NewReader(relOut))
-					var rels []string
-					for scannerRel.Scan() {
-						r := strings.TrimSpace(scannerRel.Text())
-						if r != "" && !strings.HasPrefix(r, "package ") && !strings.Contains(r, "is not installed") {
-							rels = append(rels, r)
-						}
-					}
-					lst[i].Relations[rel] = rels
-				}
-			}
+// listInstalledRpm lists the installed packages with the rpm binary. All
+// requested fields are printed by a single query. Versions of rpm without
+// the tags needed for it are queried per package instead.
+func (rpm RPM) listInstalledRpm(ctx context.Context, params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+	format, keys := rpmQueryFormat(params)
+	output, err := rpm.queryAll(ctx, format, params.Name)
+	if err != nil && len(keys) > 0 && strings.Contains(output, "unknown tag") {
+		return rpm.listInstalledPerPackage(ctx, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lst := []syspackage.SysPackageInfo{}
+	for _, record := range strings.Split(output, rpmRecordSep) {
+		if pkg, ok := parseRpmRecord(record, keys, params); ok {
+			lst = append(lst, pkg)
 		}
+	}
+	return lst, nil
+}
+
+// queryAll runs 'rpm -qa' with a query format.
+func (rpm RPM) queryAll(ctx context.Context, format string, name string) (string, error) {
+	args := append(rpm.rpmDBArgs(), "-qa", "--qf", format)
+	if name != "" {
+		args = append(args, name)
+	}
+	output, err := rpm.run(ctx, rpm.rpmpath, args...)
+
+	// rpm exits with 1 if no packages are found. This is not an error for us.
+	if err != nil {
+		if code, ok := cmdrunner.ExitCode(err); ok && code == 1 {
+			return "", nil
+		}
+		return string(output), fmt.Errorf("rpm command failed: %w, output: %s", err, string(output))
+	}
+	return string(output), nil
+}
 
-		if params.Changelog > 0 {
-			changeArgs := []string{}
-			if rpm.isTest {
-				changeArgs = append(changeArgs, "--dbpath", path.Join(rpm.root, "/var/lib/rpm"))
-			} else if rpm.root != "" {
-				changeArgs = append(changeArgs, "--root", rpm.root)
+// listInstalledPerPackage lists the installed packages and queries the
+// additional fields for every package by a bounded number of workers.
+func (rpm RPM) listInstalledPerPackage(ctx context.Context, params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+	output, err := rpm.queryAll(ctx, rpmInfoFormat+`\n`, params.Name)
+	if err != nil {
+		return nil, err
+	}
+	lst := []syspackage.SysPackageInfo{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if pkg, ok := parseRpmInfoLine(scanner.Text()); ok {
+			lst = append(lst, pkg)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(rpmWorkers, len(lst)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				rpm.queryPackageFields(ctx, &lst[i], params)
 			}
-			changeArgs = append(changeArgs, "-q", "--changelog", pkgName)
-			changeOut, err := exec.Command(rpm.rpmpath, changeArgs...).CombinedOutput()
-			if err == nil {
-				scannerChange := bufio.NewScanner(bytes.NewReader(changeOut))
-				var lines []string
-				var count uint
-				for scannerChange.Scan() && count < params.Changelog {
-					lines = append(lines, scannerChange.Text())
-					count++
+		}()
+	}
+	for i := range lst {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return lst, nil
+}
+
+// queryPackageFields queries the additional fields of a package with one
+// rpm invocation per field.
+func (rpm RPM) queryPackageFields(ctx context.Context, pkg *syspackage.SysPackageInfo, params syspackage.ListPackageParams) {
+	pkgName := rpmQueryName(*pkg)
+	query := func(args ...string) (string, bool) {
+		args = append(append(rpm.rpmDBArgs(), args...), pkgName)
+		out, err := rpm.run(ctx, rpm.rpmpath, args...)
+		return string(out), err == nil
+	}
+	if params.Filelist {
+		if out, ok := query("-q", "--qf", "[%{FILENAMES}"+rpmItemSep+"]"); ok {
+			pkg.FileList = splitRpmItems(out)
+		}
+	}
+	if params.Description {
+		if out, ok := query("-q", "--qf", "%{DESCRIPTION}"); ok {
+			pkg.Description = out
+		}
+	}
+	for _, rel := range params.Relations {
+		rel = strings.ToLower(strings.TrimSpace(rel))
+		if _, ok := rpmRelationTags[rel]; !ok {
+			continue
+		}
+		if pkg.Relations == nil {
+			pkg.Relations = make(map[string][]string)
+		}
+		if out, ok := query("-q", "--"+rel); ok {
+			var rels []string
+			for _, r := range strings.Split(out, "\n") {
+				r = strings.TrimSpace(r)
+				if r != "" && !strings.HasPrefix(r, "package ") && !strings.Contains(r, "is not installed") {
+					rels = append(rels, r)
 				}
-				lst[i].Changelog = strings.Join(lines, "\n")
 			}
+			pkg.Relations[rel] = rels
 		}
 	}
+	if params.Changelog > 0 {
+		if out, ok := query("-q", "--changelog"); ok {
+			pkg.Changelog = firstLines(out, params.Changelog)
+		}
+	}
+}
 
-	return lst, nil
+// rpmQueryName returns the name-version-release.arch of the package as
+// accepted by 'rpm -q', so that multilib packages are queried individually.
+func rpmQueryName(pkg syspackage.SysPackageInfo) string {
+	name := pkg.Name + "-" + pkg.Version + "-" + pkg.Release
+	if pkg.Arch != "" {
+		name += "." + pkg.Arch
+	}
+	return name
 }
 
-// QueryPackageSyscall queries package information.
-func (rpm RPM) QueryPackageSysCall(name string, mode syspackage.QueryMode, lines int) (result map[string]any, err error) {
-	var cmdArgs []string
-	var resultKey string
+// parseRpmInfoLine parses a line printed with the query format of
+// ListInstalledPackagesSysCall.
+func parseRpmInfoLine(line string) (syspackage.SysPackageInfo, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 11 {
+		return syspackage.SysPackageInfo{}, false
+	}
+	// rpm prints '(none)' for unset tags, e.g. the arch of gpg-pubkey
+	for i := range fields {
+		if fields[i] == "(none)" {
+			fields[i] = ""
+		}
+	}
+	pkg := syspackage.SysPackageInfo{
+		Name:          fields[0],
+		Version:       fields[2],
+		Release:       fields[3],
+		Arch:          fields[4],
+		Vendor:        fields[6],
+		License:       fields[7],
+		SourcePackage: fields[8],
+	}
+	pkg.Epoch, _ = strconv.Atoi(fields[1])
+	// If size is not a valid number, 0 seems like a reasonable default.
+	pkg.Size, _ = strconv.ParseUint(fields[5], 10, 64)
+	if installTime, err := strconv.ParseInt(fields[9], 10, 64); err == nil && installTime > 0 {
+		pkg.InstallTime = time.Unix(installTime, 0)
+	}
+	if buildTime, err := strconv.ParseInt(fields[10], 10, 64); err == nil && buildTime > 0 {
+		pkg.BuildTime = time.Unix(buildTime, 0)
+	}
+	return pkg, true
+}
 
-	if rpm.isTest {
-		cmdArgs = append(cmdArgs, "--dbpath", path.Join(rpm.root, "/var/lib/rpm"))
-	} else if rpm.root != "" {
-		cmdArgs = append(cmdArgs, "--root", rpm.root)
+// QueryPackageSyscall queries package information from the native rpm
+// database or with the rpm binary.
+func (rpm RPM) QueryPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, name string, mode syspackage.QueryMode, lines int) (result map[string]any, err error) {
+	result, err = rpm.queryRpmdb(name, mode, lines)
+	if !errors.Is(err, errNoRpmdb) {
+		return result, err
 	}
+	return rpm.queryRpm(ctx, name, mode, lines)
+}
+
+// queryRpm queries package information with the rpm binary.
+func (rpm RPM) queryRpm(ctx context.Context, name string, mode syspackage.QueryMode, lines int) (result map[string]any, err error) {
+	cmdArgs := rpm.rpmDBArgs()
+	var resultKey string
 
 	switch mode {
 	case syspackage.Info:
@@ -249,17 +445,18 @@ func (rpm RPM) QueryPackageSysCall(name string, mode syspackage.QueryMode, lines
 		return nil, fmt.Errorf("unsupported query mode: %v", mode)
 	}
 
-	output, err := exec.Command(rpm.rpmpath, cmdArgs...).CombinedOutput()
+	output, err := rpm.run(ctx, rpm.rpmpath, cmdArgs...)
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
+		if code, ok := cmdrunner.ExitCode(err); ok && code == 1 {
 			// Package not found
 			return nil, fmt.Errorf("package not found: %s", name)
 		}
 		return nil, fmt.Errorf("failed to query package '%s': %w. Output: %s", name, err, string(output))
 	}
-	result = make(map[string]any)
 	if mode == syspackage.Info {
-		// For info, parse the key-value output.
+		// For info, parse the key-value output. Every package matching
+		// name starts a new block with its Name.
+		var infos []map[string]any
 		scanner := bufio.NewScanner(bytes.NewReader(output))
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -267,124 +464,131 @@ func (rpm RPM) QueryPackageSysCall(name string, mode syspackage.QueryMode, lines
 			if len(parts) == 2 {
 				key := strings.TrimSpace(parts[0])
 				value := strings.TrimSpace(parts[1])
-				result[key] = value
+				if key == "Name" || len(infos) == 0 {
+					infos = append(infos, make(map[string]any))
+				}
+				infos[len(infos)-1][key] = value
 			}
 		}
 		if lines > 0 {
-			var changeArgs []string
-			if rpm.isTest {
-				changeArgs = append(changeArgs, "--dbpath", path.Join(rpm.root, "/var/lib/rpm"))
-			} else if rpm.root != "" {
-				changeArgs = append(changeArgs, "--root", rpm.root)
-			}
-			changeArgs = append(changeArgs, "-q", "--changelog", name)
-			changeOut, err := exec.Command(rpm.rpmpath, changeArgs...).CombinedOutput()
-			if err == nil {
-				splittedLines := strings.Split(string(changeOut), "\n")
-				if len(splittedLines) > lines {
-					result["changelog"] = splittedLines[:lines]
-				} else {
-					result["changelog"] = splittedLines
+			for _, info := range infos {
+				query := name
+				if len(infos) > 1 {
+					query = fmt.Sprintf("%s-%s-%s.%s", info["Name"], info["Version"], info["Release"], info["Architecture"])
+				}
+				changeArgs := append(rpm.rpmDBArgs(), "-q", "--changelog", query)
+				changeOut, err := rpm.run(ctx, rpm.rpmpath, changeArgs...)
+				if err == nil {
+					splittedLines := strings.Split(string(changeOut), "\n")
+					if len(splittedLines) > lines {
+						info["changelog"] = splittedLines[:lines]
+					} else {
+						info["changelog"] = splittedLines
+					}
 				}
 			}
 		}
-	} else {
-		// For other modes, return the full output under a single key.
-		splittedLines := strings.Split(string(output), "\n")
-		if lines > 0 && len(splittedLines) > lines {
-			result[resultKey] = splittedLines[:lines]
-		} else {
-			result[resultKey] = splittedLines
+		if len(infos) == 0 {
+			return make(map[string]any), nil
 		}
+		return infoResult(infos), nil
+	}
+	// For other modes, return the full output under a single key.
+	result = make(map[string]any)
+	splittedLines := strings.Split(string(output), "\n")
+	if lines > 0 && len(splittedLines) > lines {
+		result[resultKey] = splittedLines[:lines]
+	} else {
+		result[resultKey] = splittedLines
 	}
 
 	return result, nil
 }
 
-func (rpm RPM) ListReposSysCall(name string) ([]map[string]any, error) {
+func (rpm RPM) ListReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) ([]syspackage.Repository, error) {
 	params := syspackage.ListPackageParams{Name: name}
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.listReposZypper(params)
+		return rpm.listReposZypper(ctx, params)
 	case Dnf:
-		return rpm.listReposDnf(params)
+		return rpm.listReposDnf(ctx, params)
 	default:
 		return nil, fmt.Errorf("No rpm package manager installed")
 	}
 }
 
-func (rpm RPM) ModifyRepoSysCall(params syspackage.ModifyRepoParams) (ret map[string]any, err error) {
+func (rpm RPM) ModifyRepoSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ModifyRepoParams) (ret *syspackage.Repository, err error) {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.modReposZypper(params)
+		return rpm.modReposZypper(ctx, params)
 	case Dnf:
-		return rpm.modReposDnf(params)
+		return rpm.modReposDnf(ctx, params)
 	default:
 		return nil, fmt.Errorf("No rpm package manager installed")
 	}
 }
 
-func (rpm RPM) RefreshReposSysCall(name string) error {
+func (rpm RPM) RefreshReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) error {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.refreshReposZypper(name)
+		return rpm.refreshReposZypper(ctx, request, name)
 	case Dnf:
-		return rpm.refreshReposDnf(name)
+		return rpm.refreshReposDnf(ctx, request, name)
 	default:
 		return fmt.Errorf("No rpm package manager installed")
 	}
 }
 
-func (rpm RPM) ListPatchesSysCall(params syspackage.ListPatchesParams) ([]map[string]any, error) {
+func (rpm RPM) ListPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPatchesParams) ([]map[string]any, error) {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.listPatchesZypper(params)
+		return rpm.listPatchesZypper(ctx, params)
 	case Dnf:
-		return nil, fmt.Errorf("Listing patches is not supported on dnf")
+		return rpm.listPatchesDnf(ctx, params)
 	default:
 		return nil, fmt.Errorf("No rpm package manager installed")
 	}
 }
 
-func (rpm RPM) InstallPatchesSysCall(params syspackage.InstallPatchesParams) ([]map[string]any, error) {
+func (rpm RPM) InstallPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPatchesParams) (syspackage.InstallPatchesResult, error) {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.installPatchesZypper(params)
+		return rpm.installPatchesZypper(ctx, request, params)
 	case Dnf:
-		return nil, fmt.Errorf("Installing patches is not supported on dnf")
+		return rpm.installPatchesDnf(ctx, request, params)
 	default:
-		return nil, fmt.Errorf("No rpm package manager installed")
+		return syspackage.InstallPatchesResult{}, fmt.Errorf("No rpm package manager installed")
 	}
 }
 
-func (rpm RPM) SearchPackageSysCall(params syspackage.SearchPackageParams) (any, error) {
+func (rpm RPM) SearchPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.SearchPackageParams) (syspackage.SearchResult, error) {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.searchPackagesZypper(params)
+		return rpm.searchPackagesZypper(ctx, params)
 	case Dnf:
-		return rpm.searchPackagesDnf(params)
+		return rpm.searchPackagesDnf(ctx, params)
 	default:
 		return nil, fmt.Errorf("No rpm package manager installed")
 	}
 }
 
-func (rpm RPM) InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (string, error) {
+func (rpm RPM) InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (syspackage.InstallResult, error) {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
 		return rpm.installPackageZypper(ctx, request, params)
 	case Dnf:
 		return rpm.installPackageDnf(ctx, request, params)
 	default:
-		return "", fmt.Errorf("No rpm package manager installed")
+		return syspackage.InstallResult{}, fmt.Errorf("No rpm package manager installed")
 	}
 }
 
-func (rpm RPM) RemovePackageSysCall(params syspackage.RemovePackageParams) (string, error) {
+func (rpm RPM) RemovePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.RemovePackageParams) (string, error) {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.removePackageZypper(params)
+		return rpm.removePackageZypper(ctx, request, params)
 	case Dnf:
-		return rpm.removePackageDnf(params)
+		return rpm.removePackageDnf(ctx, params)
 	default:
 		return "", fmt.Errorf("No rpm package manager installed")
 	}
@@ -394,13 +598,13 @@ func (rpm RPM) PkgType() string {
 	return "rpm"
 }
 
-func (rpm RPM) UpdatePackageSysCall(params syspackage.UpdatePackageParams) (string, error) {
+func (rpm RPM) UpdatePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.UpdatePackageParams) (syspackage.UpdateResult, error) {
 	switch rpm.mgr.mgrtype {
 	case Zypper:
-		return rpm.updatePackageZypper(params)
+		return rpm.updatePackageZypper(ctx, request, params)
 	case Dnf:
-		return rpm.updatePackageDnf(params)
+		return rpm.updatePackageDnf(ctx, request, params)
 	default:
-		return "", fmt.Errorf("No rpm package manager installed")
+		return syspackage.UpdateResult{}, fmt.Errorf("No rpm package manager installed")
 	}
 }
@@ -4,6 +4,7 @@
 package rpm
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 
@@ -28,12 +29,12 @@ func TestListInstalledPackagesSysCall(t *testing.T) {
 	rpm := NewRPMTest("rpm", Zypper, "zypper", env.GetPath(""))
 
 	// List all installed packages
-	pkgs, err := rpm.ListInstalledPackagesSysCall(syspackage.ListPackageParams{})
+	pkgs, err := rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{})
 	assert.NoError(t, err)
 	assert.Len(t, pkgs, 3, "Expected 3 packages to be installed")
 
 	// Check for a specific package with details
-	basePkgs, err := rpm.ListInstalledPackagesSysCall(syspackage.ListPackageParams{
+	basePkgs, err := rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{
 		Name:        "base",
 		Filelist:    true,
 		Description: true,
@@ -66,14 +67,14 @@ func TestQueryPackageSysCall(t *testing.T) {
 	rpm := NewRPMTest("rpm", Zypper, "zypper", env.GetPath(""))
 
 	// Query package in Info mode without changelog (lines = 0)
-	res, err := rpm.QueryPackageSysCall("base", syspackage.Info, 0)
+	res, err := rpm.QueryPackageSysCall(context.Background(), nil, "base", syspackage.Info, 0)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, res)
 	assert.Equal(t, "base", res["Name"])
 	assert.Nil(t, res["changelog"])
 
 	// Query package in Info mode with changelog (lines = 2)
-	resWithChange, err := rpm.QueryPackageSysCall("base", syspackage.Info, 2)
+	resWithChange, err := rpm.QueryPackageSysCall(context.Background(), nil, "base", syspackage.Info, 2)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, resWithChange)
 	assert.Equal(t, "base", resWithChange["Name"])
@@ -0,0 +1,360 @@
+package rpm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+// errNoRpmdb is returned if the rpm database can't be read natively and the
+// rpm binary has to be used instead.
+var errNoRpmdb = errors.New("rpm database can't be read natively")
+
+// rpmdbPath returns the sqlite rpm database of the root. The test
+// environment keeps it in var/lib/rpm, like the --dbpath used for rpm.
+func (rpm RPM) rpmdbPath() string {
+	if rpm.isTest {
+		return path.Join(rpm.root, "/var/lib/rpm/rpmdb.sqlite")
+	}
+	for _, dir := range []string{"/usr/lib/sysimage/rpm", "/var/lib/rpm"} {
+		dbPath := path.Join(rpm.root, dir, "rpmdb.sqlite")
+		if _, err := os.Stat(dbPath); err == nil {
+			return dbPath
+		}
+	}
+	return ""
+}
+
+// readRpmdb returns the headers of all installed packages. Transactions not
+// yet checkpointed are only visible through the write-ahead log, so the
+// database is only read natively if there is none.
+func (rpm RPM) readRpmdb() ([]*rpmHeader, error) {
+	dbPath := rpm.rpmdbPath()
+	if dbPath == "" {
+		return nil, errNoRpmdb
+	}
+	if info, err := os.Stat(dbPath + "-wal"); err == nil && info.Size() > 0 {
+		return nil, errNoRpmdb
+	}
+	db, err := openSqlite(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoRpmdb, err)
+	}
+	defer db.Close()
+
+	var headers []*rpmHeader
+	err = db.rows("Packages", func(_ int64, values []any) error {
+		if len(values) < 2 {
+			return errSqliteFormat
+		}
+		blob, ok := values[1].([]byte)
+		if !ok {
+			return errSqliteFormat
+		}
+		hdr, err := parseHeader(blob)
+		if err != nil {
+			return err
+		}
+		headers = append(headers, hdr)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoRpmdb, err)
+	}
+	return headers, nil
+}
+
+// matches reports whether the package matches a pattern as given to
+// 'rpm -q', which can be the name or the name with version, release and
+// architecture appended.
+func (hdr *rpmHeader) matches(pattern string) bool {
+	if pattern == "" {
+		return true
+	}
+	name := hdr.str(tagName)
+	nv := name + "-" + hdr.str(tagVersion)
+	nvr := nv + "-" + hdr.str(tagRelease)
+	for _, label := range []string{name, nv, nvr, nvr + "." + hdr.str(tagArch)} {
+		if ok, _ := path.Match(pattern, label); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// packageInfo returns the fields printed with the query format of
+// ListInstalledPackagesSysCall.
+func (hdr *rpmHeader) packageInfo() syspackage.SysPackageInfo {
+	pkg := syspackage.SysPackageInfo{
+		Name:          hdr.str(tagName),
+		Version:       hdr.str(tagVersion),
+		Release:       hdr.str(tagRelease),
+		Arch:          hdr.str(tagArch),
+		Vendor:        hdr.str(tagVendor),
+		License:       hdr.str(tagLicense),
+		SourcePackage: hdr.str(tagSourceRPM),
+	}
+	if epoch, ok := hdr.num(tagEpoch); ok {
+		pkg.Epoch = int(epoch)
+	}
+	if size, ok := hdr.num(tagLongSize); ok {
+		pkg.Size = uint64(size)
+	} else if size, ok := hdr.num(tagSize); ok {
+		pkg.Size = uint64(size)
+	}
+	if installTime, ok := hdr.num(tagInstallTime); ok && installTime > 0 {
+		pkg.InstallTime = time.Unix(installTime, 0)
+	}
+	if buildTime, ok := hdr.num(tagBuildTime); ok && buildTime > 0 {
+		pkg.BuildTime = time.Unix(buildTime, 0)
+	}
+	return pkg
+}
+
+// files returns the files of the package like 'rpm -ql'.
+func (hdr *rpmHeader) files() []string {
+	baseNames := hdr.strs(tagBaseNames)
+	if len(baseNames) == 0 {
+		return hdr.strs(tagOldFilenames)
+	}
+	dirNames := hdr.strs(tagDirNames)
+	dirIndexes := hdr.ints(tagDirIndexes)
+	files := make([]string, 0, len(baseNames))
+	for i, base := range baseNames {
+		if i >= len(dirIndexes) || dirIndexes[i] < 0 || int(dirIndexes[i]) >= len(dirNames) {
+			break
+		}
+		files = append(files, dirNames[dirIndexes[i]]+base)
+	}
+	return files
+}
+
+// relationTags are the name, version and flag tags of the relations.
+var relationTags = map[string][3]uint32{
+	"requires":    {tagRequireName, tagRequireVersion, tagRequireFlags},
+	"recommends":  {tagRecommendName, tagRecommendVersion, tagRecommendFlags},
+	"obsoletes":   {tagObsoleteName, tagObsoleteVersion, tagObsoleteFlags},
+	"provides":    {tagProvideName, tagProvideVersion, tagProvideFlags},
+	"conflicts":   {tagConflictName, tagConflictVersion, tagConflictFlags},
+	"suggests":    {tagSuggestName, tagSuggestVersion, tagSuggestFlags},
+	"supplements": {tagSupplementName, tagSupplementVer, tagSupplementFlags},
+	"enhances":    {tagEnhanceName, tagEnhanceVersion, tagEnhanceFlags},
+}
+
+// relations returns the dependencies of a kind formatted like
+// 'rpm -q --requires', e.g. 'libc.so.6(GLIBC_2.34)(64bit)' or
+// 'rpmlib(CompressedFileNames) <= 3.0.4-1'.
+func (hdr *rpmHeader) relations(rel string) ([]string, bool) {
+	tags, ok := relationTags[rel]
+	if !ok {
+		return nil, false
+	}
+	names := hdr.strs(tags[0])
+	versions := hdr.strs(tags[1])
+	flags := hdr.ints(tags[2])
+	var rels []string
+	for i, name := range names {
+		var version string
+		var flag int64
+		if i < len(versions) {
+			version = versions[i]
+		}
+		if i < len(flags) {
+			flag = flags[i]
+		}
+		if version == "" {
+			rels = append(rels, name)
+			continue
+		}
+		op := ""
+		if flag&senseLess != 0 {
+			op += "<"
+		}
+		if flag&senseGreater != 0 {
+			op += ">"
+		}
+		if flag&senseEqual != 0 {
+			op += "="
+		}
+		rels = append(rels, name+" "+op+" "+version)
+	}
+	return rels, true
+}
+
+// changelog returns the lines of the changelog like 'rpm -q --changelog'.
+func (hdr *rpmHeader) changelog() []string {
+	times := hdr.ints(tagChangelogTime)
+	names := hdr.strs(tagChangelogName)
+	texts := hdr.strs(tagChangelogText)
+	var lines []string
+	for i := range min(len(times), len(names), len(texts)) {
+		date := time.Unix(times[i], 0).UTC().Format("Mon Jan 02 2006")
+		lines = append(lines, "* "+date+" "+names[i])
+		lines = append(lines, strings.Split(texts[i], "\n")...)
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// scriptlets returns the install and uninstall scripts with their
+// interpreter.
+func (hdr *rpmHeader) scriptlets() map[string]string {
+	scripts := make(map[string]string)
+	for name, tags := range map[string][2]uint32{
+		"prein":  {tagPreIn, tagPreInProg},
+		"postin": {tagPostIn, tagPostInProg},
+		"preun":  {tagPreUn, tagPreUnProg},
+		"postun": {tagPostUn, tagPostUnProg},
+	} {
+		script := hdr.str(tags[0])
+		prog := strings.Join(hdr.strs(tags[1]), " ")
+		if script == "" && prog == "" {
+			continue
+		}
+		if prog != "" {
+			script = "# interpreter: " + prog + "\n" + script
+		}
+		scripts[name] = script
+	}
+	return scripts
+}
+
+// info returns the fields printed by 'rpm -qi'.
+func (hdr *rpmHeader) info() map[string]any {
+	pkg := hdr.packageInfo()
+	result := map[string]any{
+		"Name":         pkg.Name,
+		"Version":      pkg.Version,
+		"Release":      pkg.Release,
+		"Architecture": pkg.Arch,
+		"Group":        hdr.str(tagGroup),
+		"Size":         strconv.FormatUint(pkg.Size, 10),
+		"License":      pkg.License,
+		"Source RPM":   pkg.SourcePackage,
+		"Build Host":   hdr.str(tagBuildHost),
+		"Packager":     hdr.str(tagPackager),
+		"Vendor":       pkg.Vendor,
+		"URL":          hdr.str(tagURL),
+		"Summary":      hdr.str(tagSummary),
+		"Description":  hdr.str(tagDescription),
+	}
+	if _, ok := hdr.num(tagEpoch); ok {
+		result["Epoch"] = strconv.Itoa(pkg.Epoch)
+	}
+	if !pkg.InstallTime.IsZero() {
+		result["Install Date"] = pkg.InstallTime.Format(time.ANSIC)
+	}
+	if !pkg.BuildTime.IsZero() {
+		result["Build Date"] = pkg.BuildTime.Format(time.ANSIC)
+	}
+	if scripts := hdr.scriptlets(); len(scripts) > 0 {
+		result["scriptlets"] = scripts
+	}
+	return result
+}
+
+// listRpmdb lists the installed packages from the native rpm database, which
+// needs no rpm invocation per package for the additional fields.
+func (rpm RPM) listRpmdb(params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+	headers, err := rpm.readRpmdb()
+	if err != nil {
+		return nil, err
+	}
+	lst := []syspackage.SysPackageInfo{}
+	for _, hdr := range headers {
+		if !hdr.matches(params.Name) {
+			continue
+		}
+		pkg := hdr.packageInfo()
+		if params.Filelist {
+			pkg.FileList = hdr.files()
+		}
+		if params.Description {
+			pkg.Description = hdr.str(tagDescription)
+		}
+		if len(params.Relations) > 0 {
+			pkg.Relations = make(map[string][]string)
+			for _, rel := range params.Relations {
+				rel = strings.ToLower(strings.TrimSpace(rel))
+				if rels, ok := hdr.relations(rel); ok {
+					pkg.Relations[rel] = rels
+				}
+			}
+		}
+		if params.Changelog > 0 {
+			lines := hdr.changelog()
+			pkg.Changelog = strings.Join(lines[:min(uint(len(lines)), params.Changelog)], "\n")
+		}
+		lst = append(lst, pkg)
+	}
+	return lst, nil
+}
+
+// queryRpmdb queries a package from the native rpm database with the result
+// of QueryPackageSysCall. Like the rpm binary it reports every installed
+// package matching name, e.g. both architectures of a multilib package.
+func (rpm RPM) queryRpmdb(name string, mode syspackage.QueryMode, lines int) (map[string]any, error) {
+	headers, err := rpm.readRpmdb()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*rpmHeader
+	for _, h := range headers {
+		if h.matches(name) {
+			matches = append(matches, h)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("package not found: %s", name)
+	}
+
+	limit := func(values []string) []string {
+		if lines > 0 && len(values) > lines {
+			return values[:lines]
+		}
+		return values
+	}
+	relations := func(key string) map[string]any {
+		var rels []string
+		for _, hdr := range matches {
+			r, _ := hdr.relations(key)
+			rels = append(rels, r...)
+		}
+		return map[string]any{key: limit(rels)}
+	}
+	switch mode {
+	case syspackage.Info:
+		var infos []map[string]any
+		for _, hdr := range matches {
+			info := hdr.info()
+			if lines > 0 {
+				info["changelog"] = limit(hdr.changelog())
+			}
+			infos = append(infos, info)
+		}
+		return infoResult(infos), nil
+	case syspackage.Requires:
+		return relations("requires"), nil
+	case syspackage.Recommends:
+		return relations("recommends"), nil
+	case syspackage.Obsoletes:
+		return relations("obsoletes"), nil
+	default:
+		return nil, fmt.Errorf("unsupported query mode: %v", mode)
+	}
+}
+
+// infoResult returns the info of a single package as is and the infos of
+// several packages matching the same query as a list.
+func infoResult(infos []map[string]any) map[string]any {
+	if len(infos) == 1 {
+		return infos[0]
+	}
+	return map[string]any{"packages": infos}
+}
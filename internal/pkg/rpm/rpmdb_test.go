@@ -0,0 +1,397 @@
+package rpm
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+	"github.com/suse/managesw-mcp/internal/pkg/testenv"
+)
+
+// testHeader builds an rpm header blob from tags with string, []string or
+// []int32 values.
+func testHeader(tags map[uint32]any) []byte {
+	var index, data []byte
+	count := 0
+	for tag, value := range tags {
+		var typ, n uint32
+		var buf []byte
+		switch v := value.(type) {
+		case string:
+			typ, n = typeString, 1
+			buf = append([]byte(v), 0)
+		case []string:
+			typ, n = typeStringArray, uint32(len(v))
+			for _, s := range v {
+				buf = append(buf, append([]byte(s), 0)...)
+			}
+		case []int32:
+			typ, n = typeInt32, uint32(len(v))
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+			for _, i := range v {
+				buf = binary.BigEndian.AppendUint32(buf, uint32(i))
+			}
+		}
+		index = binary.BigEndian.AppendUint32(index, tag)
+		index = binary.BigEndian.AppendUint32(index, typ)
+		index = binary.BigEndian.AppendUint32(index, uint32(len(data)))
+		index = binary.BigEndian.AppendUint32(index, n)
+		data = append(data, buf...)
+		count++
+	}
+	blob := binary.BigEndian.AppendUint32(nil, uint32(count))
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(data)))
+	blob = append(blob, index...)
+	return append(blob, data...)
+}
+
+// testSqliteVarint encodes a varint of up to 8 bytes.
+func testSqliteVarint(v uint64) []byte {
+	var buf []byte
+	for {
+		buf = append([]byte{byte(v & 0x7f)}, buf...)
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(buf)-1; i++ {
+		buf[i] |= 0x80
+	}
+	return buf
+}
+
+// writeTestRpmdb writes a sqlite database with the Packages table of rpm.
+// Every row gets its own leaf page below an interior root page, and blobs
+// not fitting into a page are continued in overflow pages.
+func writeTestRpmdb(t *testing.T, path string, blobs [][]byte) {
+	const pageSize = 512
+	pages := [][]byte{nil, nil}
+	newPage := func() int {
+		pages = append(pages, make([]byte, pageSize))
+		return len(pages)
+	}
+	// leafPage stores a cell with the record at the end of a new leaf page
+	leafPage := func(number int, offset int, rowid int64, record []byte) {
+		page := pages[number-1]
+		maxLocal := pageSize - 35
+		local := len(record)
+		if local > maxLocal {
+			minLocal := (pageSize-12)*32/255 - 23
+			local = minLocal + (len(record)-minLocal)%(pageSize-4)
+			if local > maxLocal {
+				local = minLocal
+			}
+		}
+		cell := append(testSqliteVarint(uint64(len(record))), testSqliteVarint(uint64(rowid))...)
+		cell = append(cell, record[:local]...)
+		if local < len(record) {
+			rest := record[local:]
+			next := newPage()
+			cell = binary.BigEndian.AppendUint32(cell, uint32(next))
+			for len(rest) > 0 {
+				overflow := pages[next-1]
+				chunk := min(len(rest), pageSize-4)
+				copy(overflow[4:], rest[:chunk])
+				rest = rest[chunk:]
+				if len(rest) > 0 {
+					next = newPage()
+					binary.BigEndian.PutUint32(overflow, uint32(next))
+				}
+			}
+		}
+		start := pageSize - len(cell)
+		copy(page[start:], cell)
+		page[offset] = sqliteLeafTable
+		binary.BigEndian.PutUint16(page[offset+3:], 1)
+		binary.BigEndian.PutUint16(page[offset+5:], uint16(start))
+		binary.BigEndian.PutUint16(page[offset+8:], uint16(start))
+	}
+	record := func(types []uint64, body []byte) []byte {
+		var header []byte
+		for _, typ := range types {
+			header = append(header, testSqliteVarint(typ)...)
+		}
+		header = append(testSqliteVarint(uint64(len(header)+1)), header...)
+		return append(header, body...)
+	}
+
+	// page 1 holds the schema with the root page 2 of the Packages table
+	pages[0] = make([]byte, pageSize)
+	pages[1] = make([]byte, pageSize)
+	sql := "CREATE TABLE 'Packages' (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)"
+	schema := "tablePackagesPackages\x02" + sql
+	leafPage(1, 100, 1, record([]uint64{23, 29, 29, 1, uint64(len(sql))*2 + 13}, []byte(schema)))
+
+	var leaves []int
+	for i, blob := range blobs {
+		leaf := newPage()
+		leafPage(leaf, 0, int64(i+1), record([]uint64{0, uint64(len(blob))*2 + 12}, blob))
+		leaves = append(leaves, leaf)
+	}
+	root := pages[1]
+	root[0] = sqliteInteriorTable
+	binary.BigEndian.PutUint16(root[3:], uint16(len(leaves)-1))
+	binary.BigEndian.PutUint32(root[8:], uint32(leaves[len(leaves)-1]))
+	end := pageSize
+	for i, leaf := range leaves[:len(leaves)-1] {
+		cell := binary.BigEndian.AppendUint32(nil, uint32(leaf))
+		cell = append(cell, testSqliteVarint(uint64(i+1))...)
+		end -= len(cell)
+		copy(root[end:], cell)
+		binary.BigEndian.PutUint16(root[12+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(root[5:], uint16(end))
+
+	header := pages[0]
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], pageSize)
+	header[18], header[19] = 1, 1
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[28:], uint32(len(pages)))
+	binary.BigEndian.PutUint32(header[44:], 4)
+	binary.BigEndian.PutUint32(header[56:], 1)
+
+	var content []byte
+	for _, page := range pages {
+		content = append(content, page...)
+	}
+	require.NoError(t, os.WriteFile(path, content, 0644))
+}
+
+func writeTestPackages(t *testing.T, env *testenv.TestEnv) {
+	var files []string
+	for i := range 200 {
+		files = append(files, "file"+strings.Repeat("x", i%7)+string(rune('a'+i%26)))
+	}
+	writeTestRpmdb(t, env.GetPath("var/lib/rpm/rpmdb.sqlite"), [][]byte{
+		testHeader(map[uint32]any{
+			tagName:           "gpg-pubkey",
+			tagVersion:        "3fa1d6ce",
+			tagRelease:        "63c9481c",
+			tagInstallTime:    []int32{1700000000},
+			tagSummary:        "gpg(SUSE Package Signing Key)",
+			tagRequireName:    []string{},
+			tagRequireVersion: []string{},
+		}),
+		testHeader(map[uint32]any{
+			tagName:           "glibc",
+			tagEpoch:          []int32{0},
+			tagVersion:        "2.38",
+			tagRelease:        "7.1",
+			tagArch:           "x86_64",
+			tagSize:           []int32{6361234},
+			tagVendor:         "SUSE LLC <https://www.suse.com/>",
+			tagLicense:        "LGPL-2.1-or-later",
+			tagSourceRPM:      "glibc-2.38-7.1.src.rpm",
+			tagInstallTime:    []int32{1700000000},
+			tagBuildTime:      []int32{1690000000},
+			tagSummary:        "Standard Shared Libraries",
+			tagDescription:    "The GNU C Library provides the most important standard libraries.",
+			tagGroup:          "System/Libraries",
+			tagBuildHost:      "build",
+			tagURL:            "https://www.gnu.org/software/libc/libc.html",
+			tagDirNames:       []string{"/etc/", "/usr/lib64/"},
+			tagDirIndexes:     []int32{0, 1, 1},
+			tagBaseNames:      []string{"ld.so.conf", "libc.so.6", "libm.so.6"},
+			tagRequireName:    []string{"/sbin/ldconfig", "rpmlib(CompressedFileNames)", "filesystem"},
+			tagRequireVersion: []string{"", "3.0.4-1", "5"},
+			tagRequireFlags:   []int32{0, senseLess | senseEqual, senseGreater | senseEqual},
+			tagProvideName:    []string{"glibc", "glibc(x86-64)"},
+			tagProvideVersion: []string{"2.38-7.1", "2.38-7.1"},
+			tagProvideFlags:   []int32{senseEqual, senseEqual},
+			tagChangelogTime:  []int32{1696161600, 1693483200},
+			tagChangelogName:  []string{"maintainer@suse.com", "packager@suse.com"},
+			tagChangelogText:  []string{"- Update to 2.38\n- Fix CVE-2023-4911", "- Rebuild"},
+			tagPostIn:         "/sbin/ldconfig",
+			tagPostInProg:     []string{"/sbin/ldconfig"},
+		}),
+		testHeader(map[uint32]any{
+			tagName:        "bigpkg",
+			tagVersion:     "1.0",
+			tagRelease:     "1",
+			tagArch:        "noarch",
+			tagInstallTime: []int32{1700000100},
+			tagOldFilenames: func() []string {
+				var paths []string
+				for _, f := range files {
+					paths = append(paths, "/usr/share/bigpkg/"+f)
+				}
+				return paths
+			}(),
+		}),
+	})
+}
+
+func TestRpmdbListInstalled(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	writeTestPackages(t, env)
+
+	// the rpm binary must not be invoked
+	rpm := NewRPMTest(env.GetPath("bin/rpm"), Zypper, "zypper", env.GetPath(""))
+	pkgs, err := rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 3)
+	assert.Equal(t, "gpg-pubkey-3fa1d6ce-63c9481c", rpmQueryName(pkgs[0]))
+	assert.Equal(t, "bigpkg", pkgs[2].Name)
+
+	pkgs, err = rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{
+		Name:        "glibc",
+		Filelist:    true,
+		Description: true,
+		Relations:   []string{"requires", "Provides", "unknown"},
+		Changelog:   4,
+	})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	assert.Equal(t, syspackage.SysPackageInfo{
+		Name:          "glibc",
+		Version:       "2.38",
+		Release:       "7.1",
+		Arch:          "x86_64",
+		Size:          6361234,
+		Vendor:        "SUSE LLC <https://www.suse.com/>",
+		License:       "LGPL-2.1-or-later",
+		SourcePackage: "glibc-2.38-7.1.src.rpm",
+		InstallTime:   time.Unix(1700000000, 0),
+		BuildTime:     time.Unix(1690000000, 0),
+		FileList:      []string{"/etc/ld.so.conf", "/usr/lib64/libc.so.6", "/usr/lib64/libm.so.6"},
+		Description:   "The GNU C Library provides the most important standard libraries.",
+		Relations: map[string][]string{
+			"requires": {"/sbin/ldconfig", "rpmlib(CompressedFileNames) <= 3.0.4-1", "filesystem >= 5"},
+			"provides": {"glibc = 2.38-7.1", "glibc(x86-64) = 2.38-7.1"},
+		},
+		Changelog: "* Sun Oct 01 2023 maintainer@suse.com\n- Update to 2.38\n- Fix CVE-2023-4911\n",
+	}, pkgs[0])
+
+	// the file list of bigpkg is stored in overflow pages
+	pkgs, err = rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{Name: "big*-1.0-1.noarch", Filelist: true})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Len(t, pkgs[0].FileList, 200)
+	assert.Equal(t, "/usr/share/bigpkg/filea", pkgs[0].FileList[0])
+	assert.Equal(t, "/usr/share/bigpkg/filexxxxxxz", pkgs[0].FileList[181])
+
+	pkgs, err = rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{Name: "missing"})
+	require.NoError(t, err)
+	assert.Empty(t, pkgs)
+}
+
+func TestRpmdbQueryPackage(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	writeTestPackages(t, env)
+
+	rpm := NewRPMTest(env.GetPath("bin/rpm"), Zypper, "zypper", env.GetPath(""))
+	res, err := rpm.QueryPackageSysCall(context.Background(), nil, "glibc", syspackage.Info, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "glibc", res["Name"])
+	assert.Equal(t, "0", res["Epoch"])
+	assert.Equal(t, "x86_64", res["Architecture"])
+	assert.Equal(t, "6361234", res["Size"])
+	assert.Equal(t, "System/Libraries", res["Group"])
+	assert.Equal(t, time.Unix(1700000000, 0).Format(time.ANSIC), res["Install Date"])
+	assert.Equal(t, []string{"* Sun Oct 01 2023 maintainer@suse.com", "- Update to 2.38"}, res["changelog"])
+	assert.Equal(t, map[string]string{"postin": "# interpreter: /sbin/ldconfig\n/sbin/ldconfig"}, res["scriptlets"])
+
+	res, err = rpm.QueryPackageSysCall(context.Background(), nil, "glibc-2.38", syspackage.Requires, 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"requires": []string{"/sbin/ldconfig", "rpmlib(CompressedFileNames) <= 3.0.4-1"}}, res)
+
+	res, err = rpm.QueryPackageSysCall(context.Background(), nil, "gpg-pubkey", syspackage.Info, 0)
+	require.NoError(t, err)
+	assert.NotContains(t, res, "Epoch")
+	assert.NotContains(t, res, "changelog")
+
+	_, err = rpm.QueryPackageSysCall(context.Background(), nil, "missing", syspackage.Info, 0)
+	assert.EqualError(t, err, "package not found: missing")
+}
+
+func TestRpmdbFallback(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	writeTestPackages(t, env)
+
+	rpm := NewRPMTest(env.GetPath("bin/rpm"), Zypper, "zypper", env.GetPath(""))
+	_, err := rpm.readRpmdb()
+	require.NoError(t, err)
+
+	// uncheckpointed transactions are only in the write-ahead log
+	env.WriteFile("var/lib/rpm/rpmdb.sqlite-wal", "wal")
+	_, err = rpm.readRpmdb()
+	assert.ErrorIs(t, err, errNoRpmdb)
+
+	env.WriteFile("var/lib/rpm/rpmdb.sqlite-wal", "")
+	env.WriteFile("var/lib/rpm/rpmdb.sqlite", "not a database")
+	_, err = rpm.readRpmdb()
+	assert.ErrorIs(t, err, errNoRpmdb)
+
+	rpmMock := `#!/bin/sh
+printf 'glibc\t0\t2.38\t7.1\tx86_64\t100\tvendor\tMIT\tglibc-2.38-7.1.src.rpm\t1700000000\t1690000000\n'
+`
+	env.WriteFile("bin/rpm", rpmMock)
+	require.NoError(t, os.Chmod(env.GetPath("bin/rpm"), 0755))
+	pkgs, err := rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	assert.Equal(t, "glibc", pkgs[0].Name)
+
+	// both architectures of a multilib package are reported
+	rpmMock = `#!/bin/sh
+printf 'Name        : glibc\nArchitecture: x86_64\nName        : glibc\nArchitecture: i586\n'
+`
+	env.WriteFile("bin/rpm", rpmMock)
+	res, err := rpm.QueryPackageSysCall(context.Background(), nil, "glibc", syspackage.Info, 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"packages": []map[string]any{
+		{"Name": "glibc", "Architecture": "x86_64"},
+		{"Name": "glibc", "Architecture": "i586"},
+	}}, res)
+}
+
+func TestRpmdbQueryMultilib(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	glibc := func(arch string, requires string) []byte {
+		return testHeader(map[uint32]any{
+			tagName:           "glibc",
+			tagVersion:        "2.38",
+			tagRelease:        "7.1",
+			tagArch:           arch,
+			tagInstallTime:    []int32{1700000000},
+			tagRequireName:    []string{requires},
+			tagRequireVersion: []string{""},
+			tagRequireFlags:   []int32{0},
+		})
+	}
+	writeTestRpmdb(t, env.GetPath("var/lib/rpm/rpmdb.sqlite"), [][]byte{
+		glibc("x86_64", "filesystem"),
+		glibc("i586", "glibc-32bit-compat"),
+	})
+
+	rpm := NewRPMTest(env.GetPath("bin/rpm"), Zypper, "zypper", env.GetPath(""))
+	res, err := rpm.QueryPackageSysCall(context.Background(), nil, "glibc", syspackage.Info, 0)
+	require.NoError(t, err)
+	require.Contains(t, res, "packages")
+	infos := res["packages"].([]map[string]any)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "x86_64", infos[0]["Architecture"])
+	assert.Equal(t, "i586", infos[1]["Architecture"])
+
+	res, err = rpm.QueryPackageSysCall(context.Background(), nil, "glibc", syspackage.Requires, 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"requires": []string{"filesystem", "glibc-32bit-compat"}}, res)
+
+	res, err = rpm.QueryPackageSysCall(context.Background(), nil, "glibc-2.38-7.1.i586", syspackage.Info, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "i586", res["Architecture"])
+}
@@ -0,0 +1,142 @@
+package rpm
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+	"github.com/suse/managesw-mcp/internal/pkg/testenv"
+)
+
+func TestParseRpmInfoLine(t *testing.T) {
+	pkg, ok := parseRpmInfoLine("glibc\t0\t2.38\t7.1\tx86_64\t6361234\tSUSE LLC <https://www.suse.com/>\tLGPL-2.1-or-later AND GPL-2.0-or-later\tglibc-2.38-7.1.src.rpm\t1700000000\t1690000000")
+	require.True(t, ok)
+	assert.Equal(t, syspackage.SysPackageInfo{
+		Name:          "glibc",
+		Version:       "2.38",
+		Release:       "7.1",
+		Arch:          "x86_64",
+		Size:          6361234,
+		Vendor:        "SUSE LLC <https://www.suse.com/>",
+		License:       "LGPL-2.1-or-later AND GPL-2.0-or-later",
+		SourcePackage: "glibc-2.38-7.1.src.rpm",
+		InstallTime:   time.Unix(1700000000, 0),
+		BuildTime:     time.Unix(1690000000, 0),
+	}, pkg)
+	assert.Equal(t, "glibc-2.38-7.1.x86_64", pkg.NEVRA())
+
+	pkg, ok = parseRpmInfoLine("gpg-pubkey\t0\t3fa1d6ce\t63c9481c\t(none)\t0\t(none)\tpubkey\t(none)\t1700000000\t1674135580")
+	require.True(t, ok)
+	assert.Empty(t, pkg.Arch)
+	assert.Empty(t, pkg.Vendor)
+	assert.Empty(t, pkg.SourcePackage)
+	assert.Equal(t, "gpg-pubkey-3fa1d6ce-63c9481c", rpmQueryName(pkg))
+
+	_, ok = parseRpmInfoLine("broken,line")
+	assert.False(t, ok)
+}
+
+func TestRpmListInstalledBatched(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	// Mock rpm to print a record for a multilib package with all fields
+	rpmMock := `#!/bin/sh
+echo "$@" >> "` + env.GetPath("rpm_args.log") + `"
+printf 'libfoo\t1\t1.0\t2\tx86_64\t100\tvendor\tMIT\tlibfoo-1.0-2.src.rpm\t1700000000\t1690000000'
+printf '\037/usr/lib64/libfoo.so.1\035/usr/share/doc/libfoo\035'
+printf '\037A library\n\twith\ttabs'
+printf '\037libc.so.6()(64bit)\035rpmlib(PayloadIsZstd) <= 5.4.18-1\035'
+printf '\037* Mon Oct 02 2023 packager@suse.com\n- Update\n- Fix\n\n\036'
+printf 'libfoo\t1\t1.0\t2\ti686\t90\tvendor\tMIT\tlibfoo-1.0-2.src.rpm\t1700000100\t1690000000'
+printf '\037\037\037\037\036'
+`
+	env.WriteFile("bin/rpm", rpmMock)
+	require.NoError(t, os.Chmod(env.GetPath("bin/rpm"), 0755))
+	os.Remove(env.GetPath("var/lib/rpm/rpmdb.sqlite"))
+
+	rpm := NewRPMTest(env.GetPath("bin/rpm"), Zypper, "zypper", env.GetPath(""))
+	pkgs, err := rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{
+		Name:        "libfoo",
+		Filelist:    true,
+		Description: true,
+		Relations:   []string{"requires", "bogus"},
+		Changelog:   2,
+	})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 2)
+	assert.Equal(t, []string{"/usr/lib64/libfoo.so.1", "/usr/share/doc/libfoo"}, pkgs[0].FileList)
+	assert.Equal(t, "A library\n\twith\ttabs", pkgs[0].Description)
+	assert.Equal(t, map[string][]string{"requires": {"libc.so.6()(64bit)", "rpmlib(PayloadIsZstd) <= 5.4.18-1"}}, pkgs[0].Relations)
+	assert.Equal(t, "* Mon Oct 02 2023 packager@suse.com\n- Update", pkgs[0].Changelog)
+	assert.Equal(t, "i686", pkgs[1].Arch)
+	assert.Empty(t, pkgs[1].FileList)
+	assert.Empty(t, pkgs[1].Changelog)
+
+	// a single rpm invocation
+	argsLog, err := os.ReadFile(env.GetPath("rpm_args.log"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(argsLog), "-qa"))
+	assert.Contains(t, string(argsLog), "%{REQUIRENEVRS}")
+}
+
+func TestRpmListInstalledMultilib(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	// Mock rpm without the tags of the batched query to return a multilib
+	// package and log the per package queries
+	rpmMock := `#!/bin/sh
+echo "$@" >> "` + env.GetPath("rpm_args.log") + `"
+for arg in "$@"; do
+	case "$arg" in
+	*NEVRS*)
+		echo 'error: incorrect format: unknown tag: "REQUIRENEVRS"'
+		exit 2
+		;;
+	esac
+done
+for arg in "$@"; do
+	if [ "$arg" = "-qa" ]; then
+		printf 'libfoo\t1\t1.0\t2\tx86_64\t100\tvendor\tMIT\tlibfoo-1.0-2.src.rpm\t1700000000\t1690000000\n'
+		printf 'libfoo\t1\t1.0\t2\ti686\t90\tvendor\tMIT\tlibfoo-1.0-2.src.rpm\t1700000100\t1690000000\n'
+		exit 0
+	fi
+	if [ "$arg" = "--requires" ]; then
+		echo "libc.so.6"
+		exit 0
+	fi
+done
+echo "description"
+`
+	env.WriteFile("bin/rpm", rpmMock)
+	err := os.Chmod(env.GetPath("bin/rpm"), 0755)
+	require.NoError(t, err)
+	// use the rpm binary even if the test environment has an rpm database
+	os.Remove(env.GetPath("var/lib/rpm/rpmdb.sqlite"))
+
+	rpm := NewRPMTest(env.GetPath("bin/rpm"), Zypper, "zypper", env.GetPath(""))
+	pkgs, err := rpm.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{
+		Name:        "libfoo",
+		Description: true,
+		Relations:   []string{"requires"},
+	})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 2)
+	assert.Equal(t, "x86_64", pkgs[0].Arch)
+	assert.Equal(t, "i686", pkgs[1].Arch)
+	assert.Equal(t, 1, pkgs[0].Epoch)
+	assert.Equal(t, "1:1.0-2", pkgs[0].EVR())
+	assert.Equal(t, "description\n", pkgs[1].Description)
+	assert.Equal(t, []string{"libc.so.6"}, pkgs[1].Relations["requires"])
+
+	argsLog, err := os.ReadFile(env.GetPath("rpm_args.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(argsLog), "libfoo-1.0-2.x86_64")
+	assert.Contains(t, string(argsLog), "libfoo-1.0-2.i686")
+}
@@ -0,0 +1,317 @@
+package rpm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// sqliteDB is a minimal read-only reader of SQLite database files. It only
+// walks table b-trees, which is all that is needed to read the header blobs
+// of the rpm database without cgo or an additional dependency.
+type sqliteDB struct {
+	file     *os.File
+	pageSize int
+	usable   int
+	pages    int
+}
+
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+	// maximal depth of a b-tree, protects against loops in corrupt files
+	sqliteMaxDepth = 32
+)
+
+var errSqliteFormat = errors.New("not a valid sqlite database")
+
+func openSqlite(path string) (*sqliteDB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 100)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, errSqliteFormat
+	}
+	if string(header[:16]) != "SQLite format 3\x00" {
+		file.Close()
+		return nil, errSqliteFormat
+	}
+	db := &sqliteDB{file: file}
+	db.pageSize = int(binary.BigEndian.Uint16(header[16:18]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	if db.pageSize < 512 {
+		file.Close()
+		return nil, errSqliteFormat
+	}
+	db.usable = db.pageSize - int(header[20])
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	db.pages = int(info.Size() / int64(db.pageSize))
+	return db, nil
+}
+
+func (db *sqliteDB) Close() error {
+	return db.file.Close()
+}
+
+func (db *sqliteDB) page(number int) ([]byte, error) {
+	if number < 1 || number > db.pages {
+		return nil, fmt.Errorf("sqlite page %d out of range", number)
+	}
+	buf := make([]byte, db.pageSize)
+	if _, err := db.file.ReadAt(buf, int64(number-1)*int64(db.pageSize)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// tableRoot returns the root page of a table from the schema table, which
+// is stored at page 1 with the columns type, name, tbl_name, rootpage, sql.
+func (db *sqliteDB) tableRoot(name string) (int, error) {
+	root := 0
+	err := db.walk(1, 0, func(_ int64, payload []byte) error {
+		values, err := sqliteRecord(payload)
+		if err != nil {
+			return err
+		}
+		if len(values) < 4 || values[0] != "table" || values[1] != name {
+			return nil
+		}
+		if page, ok := values[3].(int64); ok {
+			root = int(page)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if root == 0 {
+		return 0, fmt.Errorf("table %s not found", name)
+	}
+	return root, nil
+}
+
+// rows calls fn for the rowid and the columns of every row of a table in
+// the order of the rowids.
+func (db *sqliteDB) rows(table string, fn func(rowid int64, values []any) error) error {
+	root, err := db.tableRoot(table)
+	if err != nil {
+		return err
+	}
+	return db.walk(root, 0, func(rowid int64, payload []byte) error {
+		values, err := sqliteRecord(payload)
+		if err != nil {
+			return err
+		}
+		return fn(rowid, values)
+	})
+}
+
+// walk traverses the table b-tree at page number and calls fn with the
+// complete payload of every cell.
+func (db *sqliteDB) walk(number int, depth int, fn func(rowid int64, payload []byte) error) error {
+	if depth > sqliteMaxDepth {
+		return errSqliteFormat
+	}
+	page, err := db.page(number)
+	if err != nil {
+		return err
+	}
+	// page 1 starts with the database header
+	offset := 0
+	if number == 1 {
+		offset = 100
+	}
+	if len(page) < offset+12 {
+		return errSqliteFormat
+	}
+	pageType := page[offset]
+	cells := int(binary.BigEndian.Uint16(page[offset+3:]))
+	headerSize := 8
+	if pageType == sqliteInteriorTable {
+		headerSize = 12
+	} else if pageType != sqliteLeafTable {
+		return fmt.Errorf("unexpected sqlite page type %#x", pageType)
+	}
+	pointers := offset + headerSize
+	if pointers+2*cells > len(page) {
+		return errSqliteFormat
+	}
+	for i := range cells {
+		cell := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+		if cell >= len(page) {
+			return errSqliteFormat
+		}
+		if pageType == sqliteInteriorTable {
+			if cell+4 > len(page) {
+				return errSqliteFormat
+			}
+			child := int(binary.BigEndian.Uint32(page[cell:]))
+			if err := db.walk(child, depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		rowid, payload, err := db.leafCell(page[cell:])
+		if err != nil {
+			return err
+		}
+		if err := fn(rowid, payload); err != nil {
+			return err
+		}
+	}
+	if pageType == sqliteInteriorTable {
+		right := int(binary.BigEndian.Uint32(page[offset+8:]))
+		return db.walk(right, depth+1, fn)
+	}
+	return nil
+}
+
+// leafCell reads a cell of a table leaf page. Payloads which don't fit into
+// the page are continued in a linked list of overflow pages.
+func (db *sqliteDB) leafCell(cell []byte) (int64, []byte, error) {
+	size, n := sqliteVarint(cell)
+	if n == 0 {
+		return 0, nil, errSqliteFormat
+	}
+	rowid, m := sqliteVarint(cell[n:])
+	if m == 0 {
+		return 0, nil, errSqliteFormat
+	}
+	cell = cell[n+m:]
+	total := int(size)
+	if total < 0 {
+		return 0, nil, errSqliteFormat
+	}
+
+	// the computation of the local part is described in the file format
+	// documentation of sqlite
+	maxLocal := db.usable - 35
+	local := total
+	if total > maxLocal {
+		minLocal := (db.usable-12)*32/255 - 23
+		local = minLocal + (total-minLocal)%(db.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if local > len(cell) {
+		return 0, nil, errSqliteFormat
+	}
+	payload := make([]byte, 0, total)
+	payload = append(payload, cell[:local]...)
+	if local == total {
+		return int64(rowid), payload, nil
+	}
+	if local+4 > len(cell) {
+		return 0, nil, errSqliteFormat
+	}
+	next := int(binary.BigEndian.Uint32(cell[local:]))
+	for visited := 0; len(payload) < total; visited++ {
+		if next == 0 || visited > db.pages {
+			return 0, nil, errSqliteFormat
+		}
+		page, err := db.page(next)
+		if err != nil {
+			return 0, nil, err
+		}
+		next = int(binary.BigEndian.Uint32(page))
+		chunk := min(total-len(payload), db.usable-4)
+		payload = append(payload, page[4:4+chunk]...)
+	}
+	return int64(rowid), payload, nil
+}
+
+// sqliteVarint decodes a big-endian variable length integer of up to 9
+// bytes and returns it together with its length, which is 0 on errors.
+func sqliteVarint(buf []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(buf) {
+			return 0, 0
+		}
+		if i == 8 {
+			return value<<8 | uint64(buf[i]), 9
+		}
+		value = value<<7 | uint64(buf[i]&0x7f)
+		if buf[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// sqliteRecord decodes a record into its values, which are nil, int64,
+// float64, string or []byte.
+func sqliteRecord(payload []byte) ([]any, error) {
+	headerSize, n := sqliteVarint(payload)
+	if n == 0 || int(headerSize) < n || int(headerSize) > len(payload) {
+		return nil, errSqliteFormat
+	}
+	header := payload[n:headerSize]
+	body := payload[headerSize:]
+	var values []any
+	for len(header) > 0 {
+		serialType, m := sqliteVarint(header)
+		if m == 0 {
+			return nil, errSqliteFormat
+		}
+		header = header[m:]
+		var size int
+		switch {
+		case serialType == 0 || serialType == 8 || serialType == 9:
+			size = 0
+		case serialType <= 4:
+			size = int(serialType)
+		case serialType == 5:
+			size = 6
+		case serialType == 6 || serialType == 7:
+			size = 8
+		case serialType >= 12:
+			size = int(serialType-12) / 2
+		default:
+			return nil, errSqliteFormat
+		}
+		if size > len(body) {
+			return nil, errSqliteFormat
+		}
+		data := body[:size]
+		body = body[size:]
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType <= 6:
+			// sign extend the big-endian two's complement integer
+			var value int64
+			if data[0]&0x80 != 0 {
+				value = -1
+			}
+			for _, b := range data {
+				value = value<<8 | int64(b)
+			}
+			values = append(values, value)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case serialType%2 == 0:
+			values = append(values, data)
+		default:
+			values = append(values, string(data))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,230 @@
+package rpm
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// dnfAdvisory holds the information of an advisory from the updateinfo
+// metadata of a dnf repository.
+type dnfAdvisory struct {
+	ID              string
+	Type            string
+	Severity        string
+	Summary         string
+	Issued          string
+	CVEs            []string
+	Packages        []string
+	RebootSuggested bool
+}
+
+var cveRegexp = regexp.MustCompile(`CVE-\d{4}-\d+`)
+
+// dnfAdvisoryTypes are the advisory types dnf knows about
+var dnfAdvisoryTypes = []string{"security", "bugfix", "enhancement", "newpackage", "unspecified"}
+
+// dnfSeverities are the severities dnf knows about, 'none' is used by dnf5
+// for advisories without severity
+var dnfSeverities = []string{"critical", "important", "moderate", "low", "none"}
+
+// patchCategory maps a dnf advisory type to the patch category used by
+// zypper, so that the patches of both package managers can be handled alike.
+func patchCategory(advisoryType string) string {
+	switch advisoryType {
+	case "bugfix":
+		return "recommended"
+	case "enhancement":
+		return "feature"
+	case "newpackage":
+		return "optional"
+	default:
+		return advisoryType
+	}
+}
+
+// dnfCategoryArgs returns the dnf arguments which filter for the advisories
+// of a zypper patch category. The dnf advisory types are accepted as well.
+func dnfCategoryArgs(category string) ([]string, error) {
+	switch strings.ToLower(category) {
+	case "":
+		return nil, nil
+	case "security":
+		return []string{"--security"}, nil
+	case "recommended", "bugfix":
+		return []string{"--bugfix"}, nil
+	case "feature", "enhancement":
+		return []string{"--enhancement"}, nil
+	case "optional", "newpackage":
+		return []string{"--newpackage"}, nil
+	default:
+		return nil, fmt.Errorf("unknown patch category: %s", category)
+	}
+}
+
+// dnfSeverityArgs returns the dnf arguments which filter for the advisories
+// with the given severity.
+func dnfSeverityArgs(severity string) ([]string, error) {
+	severity = strings.ToLower(severity)
+	if severity == "" {
+		return nil, nil
+	}
+	if !slices.Contains(dnfSeverities, severity) || severity == "none" {
+		return nil, fmt.Errorf("unknown patch severity: %s", severity)
+	}
+	return []string{"--sec-severity=" + strings.ToUpper(severity[:1]) + severity[1:]}, nil
+}
+
+// toMap converts the advisory to the representation of a patch, using the
+// keys zypper uses for its patches where possible.
+func (adv dnfAdvisory) toMap(status string) map[string]any {
+	severity := adv.Severity
+	if severity == "" || severity == "none" {
+		severity = "unspecified"
+	}
+	return map[string]any{
+		"name":             adv.ID,
+		"status":           status,
+		"category":         patchCategory(adv.Type),
+		"type":             adv.Type,
+		"severity":         severity,
+		"summary":          adv.Summary,
+		"issued":           adv.Issued,
+		"cves":             adv.CVEs,
+		"packages":         adv.Packages,
+		"reboot_suggested": adv.RebootSuggested,
+	}
+}
+
+// parseUpdateinfoList parses the output of 'dnf updateinfo list'. dnf4 prints
+// the lines as 'ID Important/Sec. package' while dnf5 uses separate columns
+// 'ID security Important package issued'. The advisories are returned in
+// the order of their first appearance with the affected packages collected.
+func parseUpdateinfoList(output string) []dnfAdvisory {
+	var advisories []dnfAdvisory
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		advType, severity, ok := parseAdvisoryType(fields[1])
+		if !ok {
+			continue
+		}
+		pkg := fields[2]
+		if severity == "" && len(fields) > 3 && slices.Contains(dnfSeverities, strings.ToLower(fields[2])) {
+			severity = strings.ToLower(fields[2])
+			pkg = fields[3]
+		}
+		i, exists := index[fields[0]]
+		if !exists {
+			i = len(advisories)
+			index[fields[0]] = i
+			advisories = append(advisories, dnfAdvisory{ID: fields[0], Type: advType, Severity: severity})
+		}
+		if !slices.Contains(advisories[i].Packages, pkg) {
+			advisories[i].Packages = append(advisories[i].Packages, pkg)
+		}
+	}
+	return advisories
+}
+
+// parseAdvisoryType parses the type column of 'dnf updateinfo list', which
+// can carry the severity like in 'Important/Sec.'.
+func parseAdvisoryType(field string) (advType string, severity string, ok bool) {
+	for _, part := range strings.Split(strings.ToLower(field), "/") {
+		switch {
+		case part == "sec.":
+			advType = "security"
+		case slices.Contains(dnfAdvisoryTypes, part):
+			advType = part
+		case slices.Contains(dnfSeverities, part):
+			severity = part
+		default:
+			return "", "", false
+		}
+	}
+	return advType, severity, advType != ""
+}
+
+// parseUpdateinfoInfo parses the output of 'dnf updateinfo info' and adds the
+// details to the given advisories. dnf4 prints every advisory with its title
+// framed by '=' lines followed by 'Key: value' lines, dnf5 prints 'Key : value'
+// lines starting with the 'Name' of the advisory and nested references. Lines
+// with an empty key continue the value of the previous key.
+func parseUpdateinfoInfo(output string, advisories []dnfAdvisory) {
+	index := make(map[string]int)
+	for i, adv := range advisories {
+		index[adv.ID] = i
+	}
+	var current *dnfAdvisory
+	var title string
+	inHeader := false
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "====") {
+			inHeader = !inHeader
+			if inHeader {
+				title = ""
+			}
+			continue
+		}
+		if inHeader {
+			title = line
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if key == "update id" || key == "name" {
+			current = nil
+			if i, ok := index[value]; ok {
+				current = &advisories[i]
+				seen = make(map[string]bool)
+				if current.Summary == "" {
+					current.Summary = title
+				}
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		for _, cve := range cveRegexp.FindAllString(value, -1) {
+			if !slices.Contains(current.CVEs, cve) {
+				current.CVEs = append(current.CVEs, cve)
+			}
+		}
+		// nested keys of dnf5 references must not override the values
+		// of the advisory itself
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		switch key {
+		case "title":
+			current.Summary = value
+		case "type":
+			if current.Type == "" {
+				current.Type = strings.ToLower(value)
+			}
+		case "severity":
+			if current.Severity == "" {
+				current.Severity = strings.ToLower(value)
+			}
+		case "updated", "issued":
+			current.Issued = value
+		case "reboot", "reboot suggested", "reboot_suggested":
+			current.RebootSuggested = repoBool(value)
+		}
+	}
+}
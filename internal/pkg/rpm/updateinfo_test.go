@@ -0,0 +1,136 @@
+package rpm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dnf4UpdateinfoList = `Last metadata expiration check: 0:12:01 ago on Mon 01 Jan 2024 10:00:00 AM UTC.
+FEDORA-2024-1a2b3c Important/Sec. curl-8.2.1-4.fc39.x86_64
+FEDORA-2024-1a2b3c Important/Sec. libcurl-8.2.1-4.fc39.x86_64
+FEDORA-2024-4d5e6f bugfix         vim-enhanced-9.1.016-1.fc39.x86_64
+FEDORA-2024-7a8b9c enhancement    podman-4.8.3-1.fc39.x86_64
+`
+
+const dnf4UpdateinfoInfo = `Last metadata expiration check: 0:12:01 ago on Mon 01 Jan 2024 10:00:00 AM UTC.
+===============================================================================
+  curl-8.2.1-4.fc39
+===============================================================================
+  Update ID: FEDORA-2024-1a2b3c
+       Type: security
+    Updated: 2024-01-02 03:04:05
+       Bugs: 2255001 - CVE-2023-46218 curl: cookie mixed case PSL bypass
+           : 2255002 - CVE-2023-46219 curl: HSTS long file name clears contents
+       CVEs: CVE-2023-46218
+           : CVE-2023-46219
+Description: Fixes for CVE-2023-46218 and CVE-2023-46219.
+   Severity: Important
+     Reboot: no
+
+===============================================================================
+  vim-9.1.016-1.fc39
+===============================================================================
+  Update ID: FEDORA-2024-4d5e6f
+       Type: bugfix
+    Updated: 2024-01-03 00:00:00
+Description: The newest upstream commit
+   Severity: None
+`
+
+const dnf5UpdateinfoList = `Name               Type        Severity  Package                        Issued
+FEDORA-2024-aa11bb security    Critical  kernel-6.7.5-200.fc39.x86_64   2024-02-20 01:02:03
+FEDORA-2024-aa11bb security    Critical  kernel-core-6.7.5-200.fc39.x86_64 2024-02-20 01:02:03
+FEDORA-2024-cc22dd bugfix      None      bash-5.2.26-1.fc39.x86_64      2024-02-21 01:02:03
+`
+
+const dnf5UpdateinfoInfo = `Name             : FEDORA-2024-aa11bb
+Title            : kernel-6.7.5-200.fc39
+Severity         : Critical
+Type             : security
+Status           : stable
+Vendor           : Fedora Project
+Issued           : 2024-02-20 01:02:03
+Description      : The 6.7.5 stable kernel update contains fixes for CVE-2024-1086.
+Message          : 
+Rights           : Copyright Fedora Project
+Reboot suggested : yes
+Reference        : 
+  Title          : CVE-2024-26581 kernel: netfilter
+  Id             : 2265001
+  Type           : bugzilla
+  Url            : https://bugzilla.redhat.com/show_bug.cgi?id=2265001
+Collection       : 
+  Packages       : kernel-6.7.5-200.fc39.x86_64
+                 : kernel-core-6.7.5-200.fc39.x86_64
+
+Name             : FEDORA-2024-cc22dd
+Title            : bash-5.2.26-1.fc39
+Severity         : None
+Type             : bugfix
+Issued           : 2024-02-21 01:02:03
+`
+
+func TestParseUpdateinfoDnf4(t *testing.T) {
+	advisories := parseUpdateinfoList(dnf4UpdateinfoList)
+	require.Len(t, advisories, 3)
+	assert.Equal(t, "FEDORA-2024-1a2b3c", advisories[0].ID)
+	assert.Equal(t, "security", advisories[0].Type)
+	assert.Equal(t, "important", advisories[0].Severity)
+	assert.Equal(t, []string{"curl-8.2.1-4.fc39.x86_64", "libcurl-8.2.1-4.fc39.x86_64"}, advisories[0].Packages)
+	assert.Equal(t, "bugfix", advisories[1].Type)
+	assert.Empty(t, advisories[1].Severity)
+	assert.Equal(t, "enhancement", advisories[2].Type)
+
+	parseUpdateinfoInfo(dnf4UpdateinfoInfo, advisories)
+	assert.Equal(t, "curl-8.2.1-4.fc39", advisories[0].Summary)
+	assert.Equal(t, "2024-01-02 03:04:05", advisories[0].Issued)
+	assert.Equal(t, []string{"CVE-2023-46218", "CVE-2023-46219"}, advisories[0].CVEs)
+	assert.False(t, advisories[0].RebootSuggested)
+	assert.Equal(t, "vim-9.1.016-1.fc39", advisories[1].Summary)
+	assert.Equal(t, "none", advisories[1].Severity)
+	assert.Empty(t, advisories[1].CVEs)
+
+	patch := advisories[1].toMap("needed")
+	assert.Equal(t, "recommended", patch["category"])
+	assert.Equal(t, "unspecified", patch["severity"])
+	assert.Equal(t, "feature", advisories[2].toMap("needed")["category"])
+}
+
+func TestParseUpdateinfoDnf5(t *testing.T) {
+	advisories := parseUpdateinfoList(dnf5UpdateinfoList)
+	require.Len(t, advisories, 2)
+	assert.Equal(t, "FEDORA-2024-aa11bb", advisories[0].ID)
+	assert.Equal(t, "security", advisories[0].Type)
+	assert.Equal(t, "critical", advisories[0].Severity)
+	assert.Equal(t, []string{"kernel-6.7.5-200.fc39.x86_64", "kernel-core-6.7.5-200.fc39.x86_64"}, advisories[0].Packages)
+	assert.Equal(t, "none", advisories[1].Severity)
+
+	parseUpdateinfoInfo(dnf5UpdateinfoInfo, advisories)
+	// the title and type of the reference must not override the advisory
+	assert.Equal(t, "kernel-6.7.5-200.fc39", advisories[0].Summary)
+	assert.Equal(t, "security", advisories[0].Type)
+	assert.Equal(t, "2024-02-20 01:02:03", advisories[0].Issued)
+	assert.Equal(t, []string{"CVE-2024-1086", "CVE-2024-26581"}, advisories[0].CVEs)
+	assert.True(t, advisories[0].RebootSuggested)
+	assert.Equal(t, "bash-5.2.26-1.fc39", advisories[1].Summary)
+	assert.False(t, advisories[1].RebootSuggested)
+}
+
+func TestDnfPatchFilterArgs(t *testing.T) {
+	args, err := dnfCategoryArgs("recommended")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--bugfix"}, args)
+	args, err = dnfCategoryArgs("enhancement")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--enhancement"}, args)
+	_, err = dnfCategoryArgs("yast")
+	assert.Error(t, err)
+
+	args, err = dnfSeverityArgs("important")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--sec-severity=Important"}, args)
+	_, err = dnfSeverityArgs("urgent")
+	assert.Error(t, err)
+}
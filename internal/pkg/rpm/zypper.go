@@ -1,15 +1,17 @@
 package rpm
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"os/exec"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/beevik/etree"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 )
 
@@ -26,14 +28,13 @@ func (rpm RPM) zypperArgs() []string {
 	return args
 }
 
-func (rpm RPM) listReposZypper(params syspackage.ListPackageParams) ([]map[string]any, error) {
+func (rpm RPM) listReposZypper(ctx context.Context, params syspackage.ListPackageParams) ([]syspackage.Repository, error) {
 	args := rpm.zypperArgs()
 	args = append(args, "--xmlout", "-s", "0", "lr")
 	if params.Name != "" {
 		args = append(args, params.Name)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -43,31 +44,57 @@ func (rpm RPM) listReposZypper(params syspackage.ListPackageParams) ([]map[strin
 		return nil, err
 	}
 
-	var result []map[string]any
+	var result []syspackage.Repository
 	for _, repoElement := range doc.FindElements("//repo-list/repo") {
-		repoMap := make(map[string]any)
+		repo := syspackage.Repository{Extras: make(map[string]string)}
 		for _, attr := range repoElement.Attr {
-			repoMap[attr.Key] = attr.Value
+			switch attr.Key {
+			case "alias":
+				repo.ID = attr.Value
+			case "name":
+				repo.Name = attr.Value
+			case "type":
+				repo.Type = attr.Value
+			case "priority":
+				repo.Priority, _ = strconv.Atoi(attr.Value)
+			case "enabled":
+				repo.Enabled = repoBool(attr.Value)
+			case "autorefresh":
+				repo.AutoRefresh = repoBool(attr.Value)
+			case "gpgcheck":
+				repo.GPGCheck = repoBool(attr.Value)
+			default:
+				repo.Extras[attr.Key] = attr.Value
+			}
+		}
+		for _, urlElement := range repoElement.SelectElements("url") {
+			repo.URLs = append(repo.URLs, urlElement.Text())
 		}
-		if urlElement := repoElement.SelectElement("url"); urlElement != nil {
-			repoMap["url"] = urlElement.Text()
+		for _, keyElement := range repoElement.SelectElements("gpgkey") {
+			repo.Keys = append(repo.Keys, keyElement.Text())
 		}
-		result = append(result, repoMap)
+		repoFile := path.Join("/", rpm.root, "etc/zypp/repos.d", repo.ID+".repo")
+		if _, err := os.Stat(repoFile); err == nil {
+			repo.SourceFile = repoFile
+			if len(repo.Keys) == 0 {
+				repo.Keys = splitRepoList(readRepoFile(repoFile, repo.ID)["gpgkey"])
+			}
+		}
+		result = append(result, repo)
 	}
 	return result, nil
 }
 
-func (rpm RPM) modReposZypper(params syspackage.ModifyRepoParams) (map[string]any, error) {
+func (rpm RPM) modReposZypper(ctx context.Context, params syspackage.ModifyRepoParams) (*syspackage.Repository, error) {
 	if params.RemoveRepos {
 		args := rpm.zypperArgs()
 		args = append(args, "--non-interactive", "rr", params.Name)
-		cmd := exec.Command(rpm.mgr.mgrpath, args...)
-		if err := cmd.Run(); err != nil {
+		if _, err := rpm.run(ctx, rpm.mgr.mgrpath, args...); err != nil {
 			return nil, err
 		}
 		return nil, nil
 	}
-	repos, err := rpm.listReposZypper(syspackage.ListPackageParams{Name: params.Name})
+	repos, err := rpm.listReposZypper(ctx, syspackage.ListPackageParams{Name: params.Name})
 	repoExists := true
 	if err != nil {
 		repoExists = false
@@ -87,8 +114,7 @@ func (rpm RPM) modReposZypper(params syspackage.ModifyRepoParams) (map[string]an
 			zypperArgs = append(zypperArgs, "-n", params.Name)
 		}
 		zypperArgs = append(zypperArgs, params.Name)
-		cmd := exec.Command(rpm.mgr.mgrpath, zypperArgs...)
-		if err := cmd.Run(); err != nil {
+		if _, err := rpm.run(ctx, rpm.mgr.mgrpath, zypperArgs...); err != nil {
 			return nil, err
 		}
 	} else {
@@ -98,39 +124,37 @@ func (rpm RPM) modReposZypper(params syspackage.ModifyRepoParams) (map[string]an
 			args = append(args, "--no-gpgcheck")
 		}
 		args = append(args, params.Url, params.Name)
-		cmd := exec.Command(rpm.mgr.mgrpath, args...)
-		if err := cmd.Run(); err != nil {
+		if _, err := rpm.run(ctx, rpm.mgr.mgrpath, args...); err != nil {
 			return nil, err
 		}
 	}
 
-	repos, err = rpm.listReposZypper(syspackage.ListPackageParams{Name: params.Name})
+	repos, err = rpm.listReposZypper(ctx, syspackage.ListPackageParams{Name: params.Name})
 	if err != nil {
 		return nil, err
 	}
 	if len(repos) < 1 {
 		return nil, fmt.Errorf("couldn't get repo %s", params.Name)
 	} else {
-		return repos[0], nil
+		return &repos[0], nil
 	}
 
 }
 
-func (rpm RPM) refreshReposZypper(name string) error {
+func (rpm RPM) refreshReposZypper(ctx context.Context, request *mcp.CallToolRequest, name string) error {
 	args := rpm.zypperArgs()
 	args = append(args, "--non-interactive", "--verbose", "refresh")
 	if name != "" {
 		args = append(args, name)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := syspackage.RunWithProgress(ctx, request, rpm.runner, cmdrunner.New(rpm.mgr.mgrpath, args...))
 	if err != nil {
-		return fmt.Errorf("zypper refresh failed: %w, output: %s", err, string(output))
+		return fmt.Errorf("zypper refresh failed: %w, output: %s", err, output)
 	}
 	return nil
 }
 
-func (rpm RPM) listPatchesZypper(params syspackage.ListPatchesParams) ([]map[string]any, error) {
+func (rpm RPM) listPatchesZypper(ctx context.Context, params syspackage.ListPatchesParams) ([]map[string]any, error) {
 	args := rpm.zypperArgs()
 	args = append(args, "--xmlout", "lp")
 	if params.Category != "" {
@@ -139,8 +163,7 @@ func (rpm RPM) listPatchesZypper(params syspackage.ListPatchesParams) ([]map[str
 	if params.Severity != "" {
 		args = append(args, "--severity", params.Severity)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -161,7 +184,7 @@ func (rpm RPM) listPatchesZypper(params syspackage.ListPatchesParams) ([]map[str
 	return result, nil
 }
 
-func (rpm RPM) searchPackagesZypper(params syspackage.SearchPackageParams) (map[string]map[string][]syspackage.SearchedPackage, error) {
+func (rpm RPM) searchPackagesZypper(ctx context.Context, params syspackage.SearchPackageParams) (syspackage.SearchResult, error) {
 	args := rpm.zypperArgs()
 	args = append(args, "--xmlout", "se", "-s")
 	if len(params.Repos) > 0 {
@@ -173,11 +196,10 @@ func (rpm RPM) searchPackagesZypper(params syspackage.SearchPackageParams) (map[
 		args = append(args, "-x")
 	}
 	args = append(args, params.Name)
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
-	result := make(map[string]map[string][]syspackage.SearchedPackage)
+	output, err := rpm.run(ctx, rpm.mgr.mgrpath, args...)
+	result := make(syspackage.SearchResult)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 104 {
+		if code, ok := cmdrunner.ExitCode(err); ok && code == 104 {
 			return result, nil
 		}
 		return nil, fmt.Errorf("zypper search failed: %w, output: %s", err, string(output))
@@ -224,40 +246,212 @@ func (rpm RPM) searchPackagesZypper(params syspackage.SearchPackageParams) (map[
 	return result, nil
 }
 
-func (rpm RPM) installPatchesZypper(params syspackage.InstallPatchesParams) ([]map[string]any, error) {
+func (rpm RPM) installPatchesZypper(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPatchesParams) (syspackage.InstallPatchesResult, error) {
 	args := rpm.zypperArgs()
 	args = append(args, "--non-interactive", "--xmlout", "patch")
+	if params.ShowDetails {
+		args = append(args, "--dry-run")
+	}
 	if params.Category != "" {
 		args = append(args, "--category", params.Category)
 	}
 	if params.Severity != "" {
 		args = append(args, "--severity", params.Severity)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := syspackage.RunWithProgress(ctx, request, rpm.runner, cmdrunner.New(rpm.mgr.mgrpath, args...))
 	if err != nil {
-		return nil, err
+		return syspackage.InstallPatchesResult{}, err
 	}
 
 	doc := etree.NewDocument()
-	if err := doc.ReadFromBytes(output); err != nil {
-		return nil, err
+	if err := doc.ReadFromString(output); err != nil {
+		return syspackage.InstallPatchesResult{}, err
 	}
 
-	var result []map[string]any
+	var result syspackage.InstallPatchesResult
 	for _, patchElement := range doc.FindElements("//patch-list/patch") {
 		patchMap := make(map[string]any)
 		for _, attr := range patchElement.Attr {
 			patchMap[attr.Key] = attr.Value
 		}
-		result = append(result, patchMap)
+		result.Patches = append(result.Patches, patchMap)
+	}
+	if params.ShowDetails {
+		changes := parseZypperInstallSummary(doc, output)
+		result.Changes = &changes
 	}
 	return result, nil
 }
 
-func (rpm RPM) installPackageZypper(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (string, error) {
-	args := rpm.zypperArgs()
-	args = append(args, "--non-interactive", "install")
+// parseZypperInstallSummary returns the packages of the install summary
+// zypper prints with --xmlout, which lists the patches as well.
+func parseZypperInstallSummary(doc *etree.Document, output string) syspackage.UpdateResult {
+	res := syspackage.UpdateResult{
+		Upgraded:   []syspackage.PackageInfo{},
+		Downgraded: []syspackage.PackageInfo{},
+		New:        []syspackage.PackageInfo{},
+		Removed:    []syspackage.PackageInfo{},
+		RawOutput:  output,
+	}
+	for _, section := range []struct {
+		name string
+		pkgs *[]syspackage.PackageInfo
+	}{
+		{"to-upgrade", &res.Upgraded},
+		{"to-downgrade", &res.Downgraded},
+		{"to-install", &res.New},
+		{"to-remove", &res.Removed},
+	} {
+		for _, solvable := range doc.FindElements("//install-summary/" + section.name + "/solvable[@type='package']") {
+			*section.pkgs = append(*section.pkgs, syspackage.PackageInfo{
+				Name:       solvable.SelectAttrValue("name", ""),
+				Version:    solvable.SelectAttrValue("edition", ""),
+				OldVersion: solvable.SelectAttrValue("edition-old", ""),
+				Arch:       solvable.SelectAttrValue("arch", ""),
+			})
+		}
+	}
+	return res
+}
+
+// maxZypperProblems is the maximal number of dependency problems the user
+// is asked to solve for one transaction.
+const maxZypperProblems = 10
+
+// zypperExitErrZypp is the exit code of zypper for errors of libzypp, like
+// unsolved dependency problems.
+const zypperExitErrZypp = 4
+
+// zypperRun runs zypper with args, which are preceded by --non-interactive
+// unless there are answers to the prompts of the dependency problems.
+func (rpm RPM) zypperRun(ctx context.Context, request *mcp.CallToolRequest, args []string, answers []string) (string, error) {
+	cmd := cmdrunner.New(rpm.mgr.mgrpath, rpm.zypperArgs()...)
+	if len(answers) == 0 {
+		cmd.Args = append(cmd.Args, "--non-interactive")
+	} else {
+		// zypper asks to continue once the problems are solved and
+		// aborts at the end of the input, further problems don't accept
+		// the 'y' and are cancelled
+		cmd.Stdin = strings.Join(append(slices.Clone(answers), "y"), "\n") + "\n"
+	}
+	cmd.Args = append(cmd.Args, args...)
+	return syspackage.RunWithProgress(ctx, request, rpm.runner, cmd)
+}
+
+// zypperTransaction runs a zypper transaction, args starting with the
+// command and answers being the ids of the solutions to the dependency
+// problems which were already chosen. If the client supports elicitation, a
+// dry run finds the decisions --non-interactive would make on its own, and
+// the user is asked instead: the solutions of further dependency problems,
+// which are fed back as the answers to the prompts of zypper, removals of
+// packages other than the ones in removing, vendor changes and licenses.
+func (rpm RPM) zypperTransaction(ctx context.Context, request *mcp.CallToolRequest, args []string, answers []string, removing ...string) (string, error) {
+	run := func(args []string, answers []string) (string, error) {
+		return rpm.zypperRun(ctx, request, args, answers)
+	}
+	if !syspackage.CanElicit(request) || slices.Contains(args, "--dry-run") {
+		return run(args, answers)
+	}
+
+	dryRun := slices.Insert(slices.Clone(args), 1, "--dry-run")
+	answers = slices.Clone(answers)
+	output, err := run(dryRun, answers)
+	for range maxZypperProblems {
+		problems := syspackage.ParseZypperProblems(output)
+		if len(problems) <= len(answers) {
+			break
+		}
+		problem := problems[len(answers)]
+		var choices []string
+		for _, solution := range problem.Solutions {
+			choices = append(choices, solution.Description)
+		}
+		choice, elicitErr := syspackage.ElicitChoice(ctx, request, "zypper can't solve the dependencies: "+problem.Description+". Choose a solution:", choices)
+		if elicitErr != nil {
+			return output, elicitErr
+		}
+		answers = append(answers, strconv.Itoa(problem.Solutions[choice].ID))
+		output, err = run(dryRun, answers)
+	}
+	if err != nil {
+		return output, err
+	}
+	var changes []string
+	var collateral []string
+	for _, pkg := range syspackage.ParseRemovedPackages(output) {
+		if !slices.Contains(removing, pkg.Name) {
+			collateral = append(collateral, pkg.Name)
+		}
+	}
+	if len(collateral) > 0 {
+		changes = append(changes, "removes "+strings.Join(collateral, ", "))
+	}
+	if vendor := syspackage.ParseZypperVendorChanges(output); len(vendor) > 0 {
+		changes = append(changes, "changes the vendor of "+strings.Join(vendor, ", "))
+	}
+	if len(changes) > 0 {
+		if err := syspackage.ElicitConfirm(ctx, request, "The transaction also "+strings.Join(changes, " and ")+". Continue?"); err != nil {
+			return output, err
+		}
+	}
+
+	agreed := false
+	agree := func(output string) error {
+		for _, license := range syspackage.ParseZypperLicenses(output) {
+			if err := syspackage.ElicitConfirm(ctx, request, fmt.Sprintf("Installing %s needs you to agree to its license:\n\n%s", license.Package, license.Text)); err != nil {
+				return err
+			}
+			agreed = true
+		}
+		if agreed {
+			args = slices.Insert(args, 1, "--auto-agree-with-licenses")
+		}
+		return nil
+	}
+	if err := agree(output); err != nil {
+		return output, err
+	}
+	output, err = run(args, answers)
+	if err != nil && !agreed {
+		// the licenses may only be shown when the transaction is committed,
+		// zypper aborts before changing anything then
+		if err := agree(output); err != nil {
+			return output, err
+		}
+		if agreed {
+			output, err = run(args, answers)
+		}
+	}
+	return output, err
+}
+
+// zypperProblems returns the dependency problems of the transaction of args
+// with the answers to the prompts, parsed from the messages of a dry run with
+// --xmlout.
+func (rpm RPM) zypperProblems(ctx context.Context, args []string, answers []string) []syspackage.SolverProblem {
+	if !slices.Contains(args, "--dry-run") {
+		args = slices.Insert(slices.Clone(args), 1, "--dry-run")
+	}
+	output, _ := rpm.zypperRun(ctx, nil, slices.Concat([]string{"--xmlout"}, args), answers)
+	return parseZypperProblemsXML([]byte(output))
+}
+
+// parseZypperProblemsXML returns the problems in the messages of the output
+// of zypper with --xmlout, which are the ones of the text output.
+func parseZypperProblemsXML(output []byte) []syspackage.SolverProblem {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(output); err != nil {
+		return syspackage.ParseZypperProblems(string(output))
+	}
+	var lines []string
+	for _, message := range doc.FindElements("//stream/message") {
+		lines = append(lines, message.Text())
+	}
+	return syspackage.ParseZypperProblems(strings.Join(lines, "\n"))
+}
+
+func (rpm RPM) installPackageZypper(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (syspackage.InstallResult, error) {
+	args := []string{"install"}
 	if params.ShowDetails {
 		args = append(args, "--dry-run")
 	}
@@ -274,55 +468,27 @@ func (rpm RPM) installPackageZypper(ctx context.Context, request *mcp.CallToolRe
 		pkg = fmt.Sprintf("%s=%s", params.Name, params.Version)
 	}
 	args = append(args, pkg)
-	var cmd *exec.Cmd
-	if ctx != nil {
-		cmd = exec.CommandContext(ctx, rpm.mgr.mgrpath, args...)
-	} else {
-		cmd = exec.Command(rpm.mgr.mgrpath, args...)
-	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return "", err
-	}
-	cmd.Stderr = cmd.Stdout
-
-	if err := cmd.Start(); err != nil {
-		return "", err
-	}
-
-	var out bytes.Buffer
-	var progressToken any
-	if request != nil && request.Params != nil {
-		progressToken = request.Params.GetProgressToken()
+	var answers []string
+	for _, id := range params.Solutions {
+		if id < 1 {
+			return syspackage.InstallResult{}, fmt.Errorf("invalid solution id: %d", id)
+		}
+		answers = append(answers, strconv.Itoa(id))
 	}
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := scanner.Text()
-		out.WriteString(line)
-		out.WriteString("\n")
-		if progressToken != nil && request != nil && request.Session != nil {
-			_ = request.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
-				ProgressToken: progressToken,
-				Message:       line,
-			})
+	output, err := rpm.zypperTransaction(ctx, request, args, answers)
+	if code, _ := cmdrunner.ExitCode(err); code == zypperExitErrZypp {
+		if problems := rpm.zypperProblems(ctx, args, answers); len(problems) > len(answers) {
+			err = &syspackage.SolverProblemsError{Problems: problems, Output: output}
 		}
 	}
-
-	err = cmd.Wait()
 	if err != nil {
-		return out.String(), fmt.Errorf("zypper install failed: %w, output: %s", err, out.String())
+		return syspackage.InstallResult{RawOutput: output}, fmt.Errorf("zypper install failed: %w, output: %s", err, output)
 	}
-	parsed := syspackage.ParseZypperInstallOutput(out.String(), params.Name)
-	jsonBytes, err := json.MarshalIndent(parsed, "", "  ")
-	if err == nil {
-		return string(jsonBytes), nil
-	}
-	return out.String(), nil
+	return syspackage.ParseZypperInstallOutput(output, params.Name), nil
 }
 
-func (rpm RPM) removePackageZypper(params syspackage.RemovePackageParams) (string, error) {
-	args := rpm.zypperArgs()
-	args = append(args, "--non-interactive", "remove")
+func (rpm RPM) removePackageZypper(ctx context.Context, request *mcp.CallToolRequest, params syspackage.RemovePackageParams) (string, error) {
+	args := []string{"remove"}
 	if params.ShowDetails {
 		args = append(args, "--dry-run")
 	}
@@ -330,21 +496,22 @@ func (rpm RPM) removePackageZypper(params syspackage.RemovePackageParams) (strin
 		args = append(args, "--clean-deps")
 	}
 	args = append(args, params.Name)
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := rpm.zypperTransaction(ctx, request, args, nil, params.Name)
 	if err != nil {
-		return string(output), fmt.Errorf("zypper remove failed: %w, output: %s", err, string(output))
+		return output, fmt.Errorf("zypper remove failed: %w, output: %s", err, output)
 	}
-	return string(output), nil
+	return output, nil
 }
 
-func (rpm RPM) updatePackageZypper(params syspackage.UpdatePackageParams) (string, error) {
-	args := rpm.zypperArgs()
+func (rpm RPM) updatePackageZypper(ctx context.Context, request *mcp.CallToolRequest, params syspackage.UpdatePackageParams) (syspackage.UpdateResult, error) {
 	updateCmd := "update"
 	if params.Upgrade {
 		updateCmd = "dup"
 	}
-	args = append(args, "--non-interactive", updateCmd)
+	args := []string{updateCmd, "--details"}
+	if params.ShowDetails {
+		args = append(args, "--dry-run")
+	}
 	if len(params.Repos) > 0 {
 		for _, repo := range params.Repos {
 			args = append(args, "--from", repo)
@@ -353,10 +520,9 @@ func (rpm RPM) updatePackageZypper(params syspackage.UpdatePackageParams) (strin
 	if params.Name != "" {
 		args = append(args, params.Name)
 	}
-	cmd := exec.Command(rpm.mgr.mgrpath, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := rpm.zypperTransaction(ctx, request, args, nil)
 	if err != nil {
-		return string(output), fmt.Errorf("zypper %s failed: %w, output: %s", updateCmd, err, string(output))
+		return syspackage.UpdateResult{RawOutput: output}, fmt.Errorf("zypper %s failed: %w, output: %s", updateCmd, err, output)
 	}
-	return string(output), nil
+	return syspackage.ParseZypperUpdateOutput(output), nil
 }
@@ -4,6 +4,7 @@
 package rpm
 
 import (
+	"context"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -47,23 +48,23 @@ gpgcheck=0
 	env.ImportFile(filepath.Join("my-local-repo", "base-1.0-1."+arch+".rpm"), baseRpmPath)
 
 	// Refresh repos
-	err = rpm.RefreshReposSysCall("my-local-repo")
+	err = rpm.RefreshReposSysCall(context.Background(), nil, "my-local-repo")
 	require.NoError(t, err)
 
 	// List repos and check if it is correctly added
-	repos, err := rpm.ListReposSysCall("")
+	repos, err := rpm.ListReposSysCall(context.Background(), nil, "")
 	require.NoError(t, err)
 	require.Len(t, repos, 1, "Expected to find 1 repo")
-	assert.Equal(t, "my-local-repo", repos[0]["alias"])
-	assert.Equal(t, "My Local Repo", repos[0]["name"])
-	assert.Equal(t, "1", repos[0]["enabled"])
-	assert.Equal(t, "1", repos[0]["autorefresh"])
+	assert.Equal(t, "my-local-repo", repos[0].ID)
+	assert.Equal(t, "My Local Repo", repos[0].Name)
+	assert.True(t, repos[0].Enabled)
+	assert.True(t, repos[0].AutoRefresh)
+	assert.False(t, repos[0].GPGCheck)
+	assert.Equal(t, "rpm-md", repos[0].Type)
 
 	// Search for base package
-	pkgsAny, err := rpm.SearchPackageSysCall(syspackage.SearchPackageParams{Name: "base"})
+	pkgs, err := rpm.SearchPackageSysCall(context.Background(), nil, syspackage.SearchPackageParams{Name: "base"})
 	require.NoError(t, err)
-	pkgs, ok := pkgsAny.(map[string]map[string][]syspackage.SearchedPackage)
-	require.True(t, ok, "Expected search output to be map[string]map[string][]syspackage.SearchedPackage")
 	assert.Contains(t, pkgs, "My Local Repo")
 	assert.Contains(t, pkgs["My Local Repo"], arch)
 	require.Len(t, pkgs["My Local Repo"][arch], 1, "Expected to find 1 package in My Local Repo for arch "+arch)
@@ -76,14 +77,12 @@ gpgcheck=0
 	env.ImportFile(filepath.Join("my-local-repo", "child-1.0-1."+arch+".rpm"), childRpmPath)
 
 	// Refresh repos again
-	err = rpm.RefreshReposSysCall("my-local-repo")
+	err = rpm.RefreshReposSysCall(context.Background(), nil, "my-local-repo")
 	require.NoError(t, err)
 
 	// Search for child package
-	pkgsAny, err = rpm.SearchPackageSysCall(syspackage.SearchPackageParams{Name: "child"})
+	pkgs, err = rpm.SearchPackageSysCall(context.Background(), nil, syspackage.SearchPackageParams{Name: "child"})
 	require.NoError(t, err)
-	pkgs, ok = pkgsAny.(map[string]map[string][]syspackage.SearchedPackage)
-	require.True(t, ok, "Expected search output to be map[string]map[string][]syspackage.SearchedPackage")
 	assert.Contains(t, pkgs, "My Local Repo")
 	assert.Contains(t, pkgs["My Local Repo"], arch)
 	require.Len(t, pkgs["My Local Repo"][arch], 1, "Expected to find 1 package in My Local Repo for arch "+arch)
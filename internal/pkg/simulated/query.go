@@ -0,0 +1,306 @@
+package simulated
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+// systemRepo is the repository the installed packages are reported in by
+// SearchPackageSysCall, like the other backends do.
+const systemRepo = "System"
+
+func (s *Simulated) ListInstalledPackagesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPackageParams) ([]syspackage.SysPackageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lst := []syspackage.SysPackageInfo{}
+	for _, pkg := range s.installed {
+		if !matchName(params.Name, pkg.Name) {
+			continue
+		}
+		info := pkg.info()
+		if params.Filelist {
+			info.FileList = pkg.Files
+		}
+		if params.Description {
+			info.Description = pkg.Description
+		}
+		if len(params.Relations) > 0 {
+			info.Relations = make(map[string][]string)
+			for _, rel := range params.Relations {
+				rel = strings.ToLower(strings.TrimSpace(rel))
+				if rels, ok := pkg.relations(rel); ok {
+					info.Relations[rel] = rels
+				}
+			}
+		}
+		if params.Changelog > 0 {
+			info.Changelog = strings.Join(limit(pkg.Changelog, int(params.Changelog)), "\n")
+		}
+		lst = append(lst, info)
+	}
+	return lst, nil
+}
+
+// findInstalled returns the index of the first installed package matching
+// the name pattern or the full name with version.
+func (s *Simulated) findInstalled(name string) int {
+	return slices.IndexFunc(s.installed, func(pkg Package) bool {
+		return matchName(name, pkg.Name) || name == pkg.Name+"-"+pkg.evr() || name == pkg.nevra()
+	})
+}
+
+func (s *Simulated) QueryPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, name string, mode syspackage.QueryMode, lines int) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findInstalled(name)
+	if i < 0 {
+		return nil, fmt.Errorf("package not found: %s", name)
+	}
+	pkg := s.installed[i]
+	switch mode {
+	case syspackage.Info:
+		result := map[string]any{
+			"Name":         pkg.Name,
+			"Version":      pkg.Version,
+			"Release":      pkg.Release,
+			"Architecture": pkg.Arch,
+			"Size":         strconv.FormatUint(pkg.Size, 10),
+			"License":      pkg.License,
+			"Vendor":       pkg.Vendor,
+			"Summary":      pkg.Summary,
+			"Description":  pkg.Description,
+		}
+		if pkg.Epoch > 0 {
+			result["Epoch"] = strconv.Itoa(pkg.Epoch)
+		}
+		if !pkg.InstallTime.IsZero() {
+			result["Install Date"] = pkg.InstallTime.Format(time.ANSIC)
+		}
+		if lines > 0 {
+			result["changelog"] = limit(pkg.Changelog, lines)
+		}
+		return result, nil
+	case syspackage.Requires:
+		return map[string]any{"requires": limit(pkg.Requires, lines)}, nil
+	case syspackage.Recommends:
+		return map[string]any{"recommends": limit(pkg.Recommends, lines)}, nil
+	case syspackage.Obsoletes:
+		return map[string]any{"obsoletes": limit(pkg.Obsoletes, lines)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported query mode: %v", mode)
+	}
+}
+
+func (repo Repo) repository() syspackage.Repository {
+	r := syspackage.Repository{
+		ID:          repo.ID,
+		Name:        repo.Name,
+		Enabled:     repo.Enabled,
+		GPGCheck:    repo.GPGCheck,
+		Priority:    repo.Priority,
+		AutoRefresh: repo.AutoRefresh,
+	}
+	if repo.URL != "" {
+		r.URLs = []string{repo.URL}
+	}
+	return r
+}
+
+// findRepo returns the index of the repository with the id or name.
+func (s *Simulated) findRepo(name string) int {
+	return slices.IndexFunc(s.repos, func(repo Repo) bool {
+		return repo.ID == name || repo.Name == name
+	})
+}
+
+func (s *Simulated) ListReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) ([]syspackage.Repository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repos := []syspackage.Repository{}
+	for _, repo := range s.repos {
+		if name == "" || repo.ID == name || repo.Name == name {
+			repos = append(repos, repo.repository())
+		}
+	}
+	return repos, nil
+}
+
+func (s *Simulated) RefreshReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name != "" && s.findRepo(name) < 0 {
+		return fmt.Errorf("repository '%s' not found", name)
+	}
+	progress := syspackage.Progress(ctx, request)
+	for _, repo := range s.repos {
+		if (name == "" && repo.Enabled) || repo.ID == name || repo.Name == name {
+			progress(fmt.Sprintf("Retrieving repository '%s' metadata ...[done]", repo.ID))
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *Simulated) ModifyRepoSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ModifyRepoParams) (*syspackage.Repository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findRepo(params.Name)
+	if params.RemoveRepos {
+		if i < 0 {
+			return nil, fmt.Errorf("repository '%s' not found", params.Name)
+		}
+		s.repos = slices.Delete(s.repos, i, i+1)
+		return nil, nil
+	}
+	if i < 0 {
+		if params.Url == "" {
+			return nil, fmt.Errorf("repository '%s' not found and no url given to add it", params.Name)
+		}
+		s.repos = append(s.repos, Repo{ID: params.Name, Name: params.Name, AutoRefresh: true, Priority: 99})
+		i = len(s.repos) - 1
+	}
+	repo := &s.repos[i]
+	if params.Url != "" {
+		repo.URL = params.Url
+	}
+	repo.Enabled = !params.Disable
+	repo.GPGCheck = !params.NoGPGCheck
+	r := repo.repository()
+	return &r, nil
+}
+
+// patchStatus returns 'needed' if an installed package is older than the
+// package of the patch, 'applied' if all installed packages are at least as
+// new and 'not-needed' if none of its packages are installed.
+func (s *Simulated) patchStatus(patch Patch) string {
+	status := "not-needed"
+	for _, fixed := range patch.Packages {
+		for _, pkg := range s.installed {
+			if pkg.Name != fixed.Name {
+				continue
+			}
+			if compareEVR(pkg, fixed) < 0 {
+				return "needed"
+			}
+			status = "applied"
+		}
+	}
+	return status
+}
+
+// toMap converts the patch to the keys zypper uses for its patches.
+func (patch Patch) toMap(status string) map[string]any {
+	var packages []string
+	for _, pkg := range patch.Packages {
+		packages = append(packages, pkg.nevra())
+	}
+	return map[string]any{
+		"name":     patch.Name,
+		"status":   status,
+		"category": patch.Category,
+		"severity": patch.Severity,
+		"summary":  patch.Summary,
+		"packages": packages,
+	}
+}
+
+func (patch Patch) matches(category string, severity string) bool {
+	return (category == "" || strings.EqualFold(category, patch.Category)) &&
+		(severity == "" || strings.EqualFold(severity, patch.Severity))
+}
+
+// ListPatchesSysCall lists the needed patches, like 'zypper list-patches'.
+func (s *Simulated) ListPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.ListPatchesParams) ([]map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := []map[string]any{}
+	for _, patch := range s.patches {
+		if !patch.matches(params.Category, params.Severity) {
+			continue
+		}
+		if status := s.patchStatus(patch); status == "needed" {
+			result = append(result, patch.toMap(status))
+		}
+	}
+	return result, nil
+}
+
+// searchRepos returns the repositories to search or install from, which are
+// the given ones or all enabled ones.
+func (s *Simulated) searchRepos(ids []string) ([]Repo, error) {
+	var repos []Repo
+	for _, id := range ids {
+		i := s.findRepo(id)
+		if i < 0 {
+			return nil, fmt.Errorf("repository '%s' not found", id)
+		}
+		repos = append(repos, s.repos[i])
+	}
+	if len(ids) == 0 {
+		for _, repo := range s.repos {
+			if repo.Enabled {
+				repos = append(repos, repo)
+			}
+		}
+	}
+	return repos, nil
+}
+
+func (s *Simulated) SearchPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.SearchPackageParams) (syspackage.SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	match := func(name string) bool {
+		if params.Exact {
+			return name == params.Name
+		}
+		return strings.Contains(strings.ToLower(name), strings.ToLower(params.Name))
+	}
+	add := func(result syspackage.SearchResult, repo string, pkg Package, status string) {
+		arch := pkg.Arch
+		if arch == "" {
+			arch = "unknown"
+		}
+		if result[repo] == nil {
+			result[repo] = make(map[string][]syspackage.SearchedPackage)
+		}
+		result[repo][arch] = append(result[repo][arch], syspackage.SearchedPackage{Name: pkg.Name, Version: pkg.evr(), Status: status})
+	}
+
+	repos, err := s.searchRepos(params.Repos)
+	if err != nil {
+		return nil, err
+	}
+	result := make(syspackage.SearchResult)
+	for _, repo := range repos {
+		for _, pkg := range repo.Packages {
+			if !match(pkg.Name) {
+				continue
+			}
+			status := "not-installed"
+			for _, inst := range s.installed {
+				if inst.Name == pkg.Name && inst.Arch == pkg.Arch {
+					status = "other-version"
+					if compareEVR(inst, pkg) == 0 {
+						status = "installed"
+						break
+					}
+				}
+			}
+			add(result, repo.ID, pkg, status)
+		}
+	}
+	if len(params.Repos) == 0 {
+		for _, pkg := range s.installed {
+			if match(pkg.Name) {
+				add(result, systemRepo, pkg, "installed")
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,249 @@
+// Package simulated implements a package manager backend which keeps its
+// packages, repositories and patches in memory. The state is read from a
+// YAML or JSON fixture and changed by the transactions, so that MCP clients
+// can be developed and demonstrated on systems without zypper, dnf or apt.
+package simulated
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+	"go.yaml.in/yaml/v3"
+)
+
+// Package is an installed or available package. Only the names of the
+// capabilities in the relations are used for resolving them, version
+// constraints are kept for display only.
+type Package struct {
+	Name        string    `yaml:"name"`
+	Epoch       int       `yaml:"epoch,omitempty"`
+	Version     string    `yaml:"version"`
+	Release     string    `yaml:"release,omitempty"`
+	Arch        string    `yaml:"arch,omitempty"`
+	Summary     string    `yaml:"summary,omitempty"`
+	Description string    `yaml:"description,omitempty"`
+	Vendor      string    `yaml:"vendor,omitempty"`
+	License     string    `yaml:"license,omitempty"`
+	Size        uint64    `yaml:"size,omitempty"`
+	Files       []string  `yaml:"files,omitempty"`
+	Requires    []string  `yaml:"requires,omitempty"`
+	Recommends  []string  `yaml:"recommends,omitempty"`
+	Provides    []string  `yaml:"provides,omitempty"`
+	Conflicts   []string  `yaml:"conflicts,omitempty"`
+	Obsoletes   []string  `yaml:"obsoletes,omitempty"`
+	Changelog   []string  `yaml:"changelog,omitempty"`
+	InstallTime time.Time `yaml:"install_time,omitempty"`
+	// Auto is set for packages which were only installed as dependency and
+	// are removed with RemoveDeps once nothing needs them anymore.
+	Auto bool `yaml:"auto,omitempty"`
+}
+
+// Repo is a repository with the packages available from it. Repositories
+// are enabled and checked with GPG unless set otherwise in the fixture.
+type Repo struct {
+	ID          string    `yaml:"id"`
+	Name        string    `yaml:"name,omitempty"`
+	URL         string    `yaml:"url,omitempty"`
+	Enabled     bool      `yaml:"enabled"`
+	GPGCheck    bool      `yaml:"gpgcheck"`
+	AutoRefresh bool      `yaml:"autorefresh"`
+	Priority    int       `yaml:"priority,omitempty"`
+	Packages    []Package `yaml:"packages,omitempty"`
+}
+
+func (repo *Repo) UnmarshalYAML(node *yaml.Node) error {
+	type plain Repo
+	defaults := plain{Enabled: true, GPGCheck: true, AutoRefresh: true, Priority: 99}
+	if err := node.Decode(&defaults); err != nil {
+		return err
+	}
+	*repo = Repo(defaults)
+	return nil
+}
+
+// Patch updates the installed packages to the versions of its packages.
+type Patch struct {
+	Name     string    `yaml:"name"`
+	Category string    `yaml:"category,omitempty"`
+	Severity string    `yaml:"severity,omitempty"`
+	Summary  string    `yaml:"summary,omitempty"`
+	Packages []Package `yaml:"packages"`
+}
+
+// Fixture is the state of the simulated system.
+type Fixture struct {
+	Installed []Package `yaml:"installed"`
+	Repos     []Repo    `yaml:"repos"`
+	Patches   []Patch   `yaml:"patches,omitempty"`
+	// OSRelease are the os-release fields reported for the system.
+	OSRelease map[string]string `yaml:"os_release,omitempty"`
+}
+
+//go:embed demo.yaml
+var demoFixture []byte
+
+// Simulated is the backend. It is safe for concurrent use, every call sees
+// the changes of the transactions before it.
+type Simulated struct {
+	mu        sync.Mutex
+	installed []Package
+	repos     []Repo
+	patches   []Patch
+	osRelease map[string]string
+}
+
+// New returns a backend with the state of the fixture.
+func New(fixture Fixture) *Simulated {
+	return &Simulated{
+		installed: slices.Clone(fixture.Installed),
+		repos:     slices.Clone(fixture.Repos),
+		patches:   slices.Clone(fixture.Patches),
+		osRelease: fixture.OSRelease,
+	}
+}
+
+// Load returns a backend with the state of the YAML or JSON fixture at
+// fixturePath, or of the built-in demo system if fixturePath is empty.
+func Load(fixturePath string) (*Simulated, error) {
+	content := demoFixture
+	if fixturePath != "" {
+		var err error
+		content, err = os.ReadFile(fixturePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+	}
+	var fixture Fixture
+	if err := yaml.Unmarshal(content, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", fixturePath, err)
+	}
+	return New(fixture), nil
+}
+
+func (s *Simulated) PkgType() string {
+	return "simulated"
+}
+
+func (s *Simulated) SystemInfoSysCall(ctx context.Context, request *mcp.CallToolRequest) (syspackage.SystemInfo, error) {
+	return syspackage.SystemInfo{
+		Backend:   "simulated",
+		OSRelease: s.osRelease,
+	}, nil
+}
+
+// Capabilities supports all operations, but only the relations kept in the
+// fixture.
+func (s *Simulated) Capabilities() syspackage.Capabilities {
+	caps := syspackage.AllCapabilities()
+	caps.Relations = slices.DeleteFunc(caps.Relations, func(rel string) bool {
+		_, ok := Package{}.relations(rel)
+		return !ok
+	})
+	caps.Solutions = false
+	return caps
+}
+
+// RepoConfigPaths returns no paths, as the repositories are only changed
+// through modify_repo.
+func (s *Simulated) RepoConfigPaths() []string {
+	return nil
+}
+
+// evr returns the version of the package as '[epoch:]version[-release]'.
+func (pkg Package) evr() string {
+	return pkg.info().EVR()
+}
+
+func (pkg Package) nevra() string {
+	return pkg.info().NEVRA()
+}
+
+func (pkg Package) packageInfo() syspackage.PackageInfo {
+	return syspackage.PackageInfo{Name: pkg.Name, Version: pkg.evr(), Arch: pkg.Arch}
+}
+
+func (pkg Package) info() syspackage.SysPackageInfo {
+	return syspackage.SysPackageInfo{
+		Name:        pkg.Name,
+		Epoch:       pkg.Epoch,
+		Version:     pkg.Version,
+		Release:     pkg.Release,
+		Arch:        pkg.Arch,
+		Vendor:      pkg.Vendor,
+		License:     pkg.License,
+		InstallTime: pkg.InstallTime,
+		Size:        pkg.Size,
+	}
+}
+
+// relations returns the relations of a kind, like 'requires'.
+func (pkg Package) relations(rel string) ([]string, bool) {
+	switch rel {
+	case "requires":
+		return pkg.Requires, true
+	case "recommends":
+		return pkg.Recommends, true
+	case "provides":
+		return pkg.Provides, true
+	case "conflicts":
+		return pkg.Conflicts, true
+	case "obsoletes":
+		return pkg.Obsoletes, true
+	}
+	return nil, false
+}
+
+// capName returns the name of a capability without version constraint.
+func capName(capability string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(capability), " ")
+	return name
+}
+
+// provides reports whether the package satisfies the capability, which can
+// be a package name, a provided capability or a file.
+func (pkg Package) provides(capability string) bool {
+	name := capName(capability)
+	if pkg.Name == name {
+		return true
+	}
+	for _, p := range pkg.Provides {
+		if capName(p) == name {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "/") && slices.Contains(pkg.Files, name)
+}
+
+func (pkg Package) conflictsWith(other Package) bool {
+	for _, c := range pkg.Conflicts {
+		if other.provides(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// limit returns the first lines of values, or all for lines <= 0.
+func limit(values []string, lines int) []string {
+	if lines > 0 && len(values) > lines {
+		return values[:lines]
+	}
+	return values
+}
+
+func matchName(pattern string, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
@@ -0,0 +1,320 @@
+package simulated
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/confirm"
+	"github.com/suse/managesw-mcp/internal/pkg/policy"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+func installedNames(t *testing.T, s *Simulated) []string {
+	t.Helper()
+	pkgs, err := s.ListInstalledPackagesSysCall(context.Background(), nil, syspackage.ListPackageParams{})
+	require.NoError(t, err)
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name+"-"+pkg.EVR())
+	}
+	return names
+}
+
+func TestVercmp(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"9.1.0836", "9.1.0330", 1},
+		{"1.0a", "1.0", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0.a", "1.0.1", -1},
+		{"007", "7", 0},
+	} {
+		assert.Equal(t, tc.want, vercmp(tc.a, tc.b), "%s <=> %s", tc.a, tc.b)
+		assert.Equal(t, -tc.want, vercmp(tc.b, tc.a), "%s <=> %s", tc.b, tc.a)
+	}
+}
+
+func TestSimulatedQueries(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+	ctx := context.Background()
+	assert.Equal(t, "simulated", s.PkgType())
+
+	sysInfo, err := s.SystemInfoSysCall(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "simulated", sysInfo.Backend)
+	assert.Equal(t, "opensuse-tumbleweed", sysInfo.OSRelease["ID"])
+	caps := s.Capabilities()
+	assert.Equal(t, syspackage.Operations(), caps.Operations())
+	assert.Equal(t, []string{"requires", "recommends", "provides", "conflicts", "obsoletes"}, caps.Relations)
+	assert.False(t, caps.Solutions)
+
+	pkgs, err := s.ListInstalledPackagesSysCall(ctx, nil, syspackage.ListPackageParams{Name: "vim*", Relations: []string{"requires"}, Changelog: 1})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 2)
+	assert.Equal(t, "9.1.0330-1.1", pkgs[0].EVR())
+	assert.Equal(t, map[string][]string{"requires": {"libc.so.6", "vim-data-common"}}, pkgs[0].Relations)
+	assert.Equal(t, "* Mon Apr 15 2024 maintainer@example.com", pkgs[0].Changelog)
+
+	info, err := s.QueryPackageSysCall(ctx, nil, "vim", syspackage.Info, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Vi IMproved", info["Summary"])
+	_, err = s.QueryPackageSysCall(ctx, nil, "emacs", syspackage.Requires, 0)
+	assert.ErrorContains(t, err, "package not found")
+
+	repos, err := s.ListReposSysCall(ctx, nil, "")
+	require.NoError(t, err)
+	require.Len(t, repos, 3)
+	assert.True(t, repos[0].Enabled)
+	assert.True(t, repos[0].GPGCheck)
+	assert.False(t, repos[2].Enabled)
+
+	result, err := s.SearchPackageSysCall(ctx, nil, syspackage.SearchPackageParams{Name: "vim"})
+	require.NoError(t, err)
+	assert.Equal(t, syspackage.SearchResult{
+		"repo-oss": {
+			"x86_64": {{Name: "vim", Version: "9.1.0836-1.1", Status: "other-version"}},
+			"noarch": {
+				{Name: "vim-data-common", Version: "9.1.0836-1.1", Status: "other-version"},
+				{Name: "vim-data", Version: "9.1.0836-1.1", Status: "not-installed"},
+			},
+		},
+		"System": {
+			"x86_64": {{Name: "vim", Version: "9.1.0330-1.1", Status: "installed"}},
+			"noarch": {{Name: "vim-data-common", Version: "9.1.0330-1.1", Status: "installed"}},
+		},
+	}, result)
+
+	// the disabled repository is only searched when given
+	result, err = s.SearchPackageSysCall(ctx, nil, syspackage.SearchPackageParams{Name: "unrar", Exact: true})
+	require.NoError(t, err)
+	assert.Empty(t, result)
+	result, err = s.SearchPackageSysCall(ctx, nil, syspackage.SearchPackageParams{Name: "unrar", Repos: []string{"repo-non-oss"}})
+	require.NoError(t, err)
+	assert.Len(t, result["repo-non-oss"]["x86_64"], 1)
+}
+
+func TestSimulatedInstallRemove(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+	ctx := context.Background()
+	before := installedNames(t, s)
+
+	res, err := s.InstallPackageSysCall(ctx, nil, syspackage.InstallPackageParams{Name: "nginx", ShowDetails: true})
+	require.NoError(t, err)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "nginx", Version: "1.27.2-1.1", Arch: "x86_64"}}, res.Installed)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "libpcre2-8-0", Version: "10.44-1.1", Arch: "x86_64"}}, res.Dependencies)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "nginx-source", Version: "1.27.2-1.1", Arch: "noarch"}}, res.Recommended)
+	assert.Equal(t, before, installedNames(t, s), "a dry run doesn't install")
+
+	res, err = s.InstallPackageSysCall(ctx, nil, syspackage.InstallPackageParams{Name: "nginx", NoRecommends: true})
+	require.NoError(t, err)
+	assert.Empty(t, res.Recommended)
+	assert.Contains(t, res.RawOutput, "Installing: nginx-1.27.2-1.1.x86_64")
+	assert.Contains(t, installedNames(t, s), "nginx-1.27.2-1.1")
+	assert.Contains(t, installedNames(t, s), "libpcre2-8-0-10.44-1.1")
+
+	res, err = s.InstallPackageSysCall(ctx, nil, syspackage.InstallPackageParams{Name: "nginx"})
+	require.NoError(t, err)
+	assert.Contains(t, res.RawOutput, "already installed")
+
+	_, err = s.InstallPackageSysCall(ctx, nil, syspackage.InstallPackageParams{Name: "apache2"})
+	assert.ErrorContains(t, err, "conflicts with")
+	_, err = s.InstallPackageSysCall(ctx, nil, syspackage.InstallPackageParams{Name: "unrar"})
+	assert.ErrorContains(t, err, "no provider of 'unrar' found")
+
+	reposChanged := 0
+	sysPkg := syspackage.SysPackage{SysPackageInterface: s, ReposChanged: func() { reposChanged++ }}
+	_, _, err = sysPkg.ModifyRepo(ctx, nil, syspackage.ModifyRepoParams{Name: "repo-non-oss"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, reposChanged)
+	_, err = s.InstallPackageSysCall(ctx, nil, syspackage.InstallPackageParams{Name: "unrar"})
+	require.NoError(t, err)
+
+	out, err := s.RemovePackageSysCall(ctx, nil, syspackage.RemovePackageParams{Name: "nginx", RemoveDeps: true})
+	require.NoError(t, err)
+	assert.Contains(t, out, "nginx libpcre2-8-0")
+	assert.NotContains(t, installedNames(t, s), "libpcre2-8-0-10.44-1.1")
+
+	// bash needs libreadline8, so it is removed with it
+	out, err = s.RemovePackageSysCall(ctx, nil, syspackage.RemovePackageParams{Name: "libreadline8", ShowDetails: true})
+	require.NoError(t, err)
+	assert.Contains(t, out, "The following 2 packages are going to be REMOVED:\n  bash libreadline8\n")
+	_, err = s.RemovePackageSysCall(ctx, nil, syspackage.RemovePackageParams{Name: "emacs"})
+	assert.ErrorContains(t, err, "not installed")
+}
+
+func TestSimulatedPatchesAndUpdate(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	patches, err := s.ListPatchesSysCall(ctx, nil, syspackage.ListPatchesParams{})
+	require.NoError(t, err)
+	assert.Len(t, patches, 3)
+
+	dryRun, err := s.InstallPatchesSysCall(ctx, nil, syspackage.InstallPatchesParams{Severity: "important", ShowDetails: true})
+	require.NoError(t, err)
+	require.Len(t, dryRun.Patches, 1)
+	assert.Equal(t, "needed", dryRun.Patches[0]["status"])
+	require.NotNil(t, dryRun.Changes)
+	assert.Contains(t, dryRun.Changes.Upgraded, syspackage.PackageInfo{Name: "vim", OldVersion: "9.1.0330-1.1", Version: "9.1.0836-1.1", Arch: "x86_64"})
+	assert.NotContains(t, installedNames(t, s), "vim-9.1.0836-1.1")
+
+	applied, err := s.InstallPatchesSysCall(ctx, nil, syspackage.InstallPatchesParams{Severity: "important"})
+	require.NoError(t, err)
+	require.Len(t, applied.Patches, 1)
+	assert.Equal(t, "openSUSE-SU-2024:14321-1", applied.Patches[0]["name"])
+	assert.Contains(t, installedNames(t, s), "vim-9.1.0836-1.1")
+	assert.Contains(t, installedNames(t, s), "vim-data-common-9.1.0836-1.1")
+
+	patches, err = s.ListPatchesSysCall(ctx, nil, syspackage.ListPatchesParams{Category: "security"})
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+	assert.Equal(t, "openSUSE-SU-2024:14400-1", patches[0]["name"])
+
+	res, err := s.UpdatePackageSysCall(ctx, nil, syspackage.UpdatePackageParams{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []syspackage.PackageInfo{
+		{Name: "glibc", OldVersion: "2.40-3.1", Version: "2.40-4.1", Arch: "x86_64"},
+		{Name: "zypper", OldVersion: "1.14.77-1.1", Version: "1.14.78-1.1", Arch: "x86_64"},
+		{Name: "libzypp", OldVersion: "17.35.12-1.1", Version: "17.35.14-1.1", Arch: "x86_64"},
+	}, res.Upgraded)
+	assert.Empty(t, res.New)
+
+	patches, err = s.ListPatchesSysCall(ctx, nil, syspackage.ListPatchesParams{})
+	require.NoError(t, err)
+	assert.Empty(t, patches)
+	res, err = s.UpdatePackageSysCall(ctx, nil, syspackage.UpdatePackageParams{})
+	require.NoError(t, err)
+	assert.Equal(t, "Nothing to do.\n", res.RawOutput)
+}
+
+func TestSimulatedPolicy(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+	ctx := context.Background()
+	sysPkg := syspackage.SysPackage{SysPackageInterface: s, Policy: &policy.Policy{
+		DenyPackages:       []string{"emacs*"},
+		ProtectedPackages:  []string{"bash", "glibc"},
+		AllowedRepoURLs:    []string{"https://download.opensuse.org/"},
+		RequireGPGCheck:    true,
+		MaxTransactionSize: 2,
+	}}
+	before := installedNames(t, s)
+
+	_, _, err = sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "emacs"})
+	assert.ErrorIs(t, err, policy.ErrViolation)
+	_, _, err = sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "nginx"})
+	assert.ErrorContains(t, err, "the transaction changes 3 packages, more than the maximum of 2")
+	// bash is removed along with libreadline8, found by a dry run
+	_, _, err = sysPkg.RemovePackage(ctx, nil, syspackage.RemovePackageParams{Name: "libreadline8"})
+	assert.ErrorContains(t, err, "package bash is protected")
+	_, _, err = sysPkg.UpdatePackage(ctx, nil, syspackage.UpdatePackageParams{Background: true})
+	assert.ErrorContains(t, err, "the transaction changes 5 packages")
+	// the packages of the patches are found by a dry run as well
+	_, _, err = sysPkg.InstallPatches(ctx, nil, syspackage.InstallPatchesParams{})
+	assert.ErrorContains(t, err, "the transaction changes 5 packages")
+	assert.Equal(t, before, installedNames(t, s), "denied transactions change nothing")
+
+	_, _, err = sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "nginx", NoRecommends: true})
+	require.NoError(t, err)
+	assert.Contains(t, installedNames(t, s), "nginx-1.27.2-1.1")
+	_, _, err = sysPkg.UpdatePackage(ctx, nil, syspackage.UpdatePackageParams{Name: "glibc"})
+	require.NoError(t, err)
+
+	_, _, err = sysPkg.ModifyRepo(ctx, nil, syspackage.ModifyRepoParams{Name: "local", Url: "http://example.com/repo"})
+	assert.ErrorContains(t, err, "repository URL http://example.com/repo isn't below one of the allowed URLs")
+	_, _, err = sysPkg.ModifyRepo(ctx, nil, syspackage.ModifyRepoParams{Name: "repo-oss", NoGPGCheck: true})
+	assert.ErrorContains(t, err, "GPG check")
+	_, _, err = sysPkg.ModifyRepo(ctx, nil, syspackage.ModifyRepoParams{Name: "repo-non-oss"})
+	require.NoError(t, err)
+}
+
+func TestSimulatedConfirm(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+	ctx := context.Background()
+	sysPkg := syspackage.SysPackage{SysPackageInterface: s, Confirm: confirm.NewStore(time.Minute)}
+	before := installedNames(t, s)
+
+	_, plan, err := sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "nginx", NoRecommends: true})
+	require.NoError(t, err)
+	require.NotNil(t, plan.Confirmation)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "libpcre2-8-0", Version: "10.44-1.1", Arch: "x86_64"}}, plan.Dependencies)
+	assert.Equal(t, before, installedNames(t, s), "the plan doesn't install")
+
+	_, _, err = sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "nginx", ConfirmToken: plan.Confirmation.Token})
+	assert.ErrorIs(t, err, confirm.ErrInvalidToken, "the token is only valid for the planned parameters")
+	_, plan, err = sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "nginx", NoRecommends: true})
+	require.NoError(t, err)
+	_, res, err := sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "nginx", NoRecommends: true, ConfirmToken: plan.Confirmation.Token})
+	require.NoError(t, err)
+	assert.Nil(t, res.Confirmation)
+	assert.Contains(t, installedNames(t, s), "nginx-1.27.2-1.1")
+
+	// the plan changes if bash is removed in between
+	_, removal, err := sysPkg.RemovePackage(ctx, nil, syspackage.RemovePackageParams{Name: "libreadline8"})
+	require.NoError(t, err)
+	require.NotNil(t, removal.Confirmation)
+	assert.Len(t, removal.Removed, 2)
+	_, err = s.RemovePackageSysCall(ctx, nil, syspackage.RemovePackageParams{Name: "bash"})
+	require.NoError(t, err)
+	_, _, err = sysPkg.RemovePackage(ctx, nil, syspackage.RemovePackageParams{Name: "libreadline8", ConfirmToken: removal.Confirmation.Token})
+	assert.ErrorIs(t, err, confirm.ErrPlanChanged)
+	assert.ErrorContains(t, err, "no longer planned: remove bash")
+	assert.Contains(t, installedNames(t, s), "libreadline8-8.2.13-1.1")
+
+	_, patches, err := sysPkg.InstallPatches(ctx, nil, syspackage.InstallPatchesParams{Category: "security"})
+	require.NoError(t, err)
+	require.NotNil(t, patches.Confirmation)
+	assert.Len(t, patches.Patches, 2)
+	require.NotNil(t, patches.Changes)
+	assert.Len(t, patches.Changes.Upgraded, 3)
+	// the plan holds the packages, updating one of them changes it
+	_, err = s.UpdatePackageSysCall(ctx, nil, syspackage.UpdatePackageParams{Name: "glibc"})
+	require.NoError(t, err)
+	_, _, err = sysPkg.InstallPatches(ctx, nil, syspackage.InstallPatchesParams{Category: "security", ConfirmToken: patches.Confirmation.Token})
+	assert.ErrorIs(t, err, confirm.ErrPlanChanged)
+	assert.ErrorContains(t, err, "upgrade glibc 2.40-3.1 -> 2.40-4.1")
+
+	_, patches, err = sysPkg.InstallPatches(ctx, nil, syspackage.InstallPatchesParams{Category: "security"})
+	require.NoError(t, err)
+	require.NotNil(t, patches.Confirmation)
+	assert.Len(t, patches.Patches, 1)
+	_, patches, err = sysPkg.InstallPatches(ctx, nil, syspackage.InstallPatchesParams{Category: "security", ConfirmToken: patches.Confirmation.Token})
+	require.NoError(t, err)
+	assert.Nil(t, patches.Confirmation)
+	assert.Len(t, patches.Patches, 1)
+	assert.Contains(t, installedNames(t, s), "vim-9.1.0836-1.1")
+}
+
+func TestSimulatedJSONFixture(t *testing.T) {
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(fixture, []byte(`{
+  "installed": [{"name": "foo", "version": "1.0", "arch": "noarch"}],
+  "repos": [{"id": "local", "url": "/srv/repo", "packages": [
+    {"name": "foo", "version": "1.1", "arch": "noarch", "requires": ["libbar"]},
+    {"name": "bar", "version": "2.0", "arch": "noarch", "provides": ["libbar"]}
+  ]}]
+}`), 0644))
+	s, err := Load(fixture)
+	require.NoError(t, err)
+	res, err := s.UpdatePackageSysCall(context.Background(), nil, syspackage.UpdatePackageParams{Name: "foo"})
+	require.NoError(t, err)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "foo", OldVersion: "1.0", Version: "1.1", Arch: "noarch"}}, res.Upgraded)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "bar", Version: "2.0", Arch: "noarch"}}, res.New)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,448 @@
+package simulated
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
+)
+
+// best returns the package accepted by the filter from the repository with
+// the highest priority, which is the lowest number, and the newest of them.
+func best(repos []Repo, accept func(Package) bool) (Package, bool) {
+	var found Package
+	priority := 0
+	ok := false
+	for _, repo := range repos {
+		for _, pkg := range repo.Packages {
+			if !accept(pkg) {
+				continue
+			}
+			if !ok || repo.Priority < priority || (repo.Priority == priority && compareEVR(pkg, found) > 0) {
+				found, priority, ok = pkg, repo.Priority, true
+			}
+		}
+	}
+	return found, ok
+}
+
+func replaces(pkg Package, inst Package) bool {
+	return pkg.Name == inst.Name && pkg.Arch == inst.Arch
+}
+
+func obsoletes(pkg Package, inst Package) bool {
+	return slices.ContainsFunc(pkg.Obsoletes, func(o string) bool {
+		return capName(o) == inst.Name
+	})
+}
+
+// remaining returns the installed packages which are neither replaced nor
+// obsoleted by the selected packages, and the obsoleted ones.
+func (s *Simulated) remaining(selected []Package) ([]Package, []Package) {
+	var kept, obsoleted []Package
+	for _, inst := range s.installed {
+		switch {
+		case slices.ContainsFunc(selected, func(pkg Package) bool { return replaces(pkg, inst) }):
+		case slices.ContainsFunc(selected, func(pkg Package) bool { return obsoletes(pkg, inst) }):
+			obsoleted = append(obsoleted, inst)
+		default:
+			kept = append(kept, inst)
+		}
+	}
+	return kept, obsoleted
+}
+
+func satisfied(pkgs []Package, capability string) bool {
+	return slices.ContainsFunc(pkgs, func(pkg Package) bool { return pkg.provides(capability) })
+}
+
+// resolve returns the packages which have to be installed together with the
+// selected ones to satisfy their requirements, and the recommended ones
+// unless noRecommends is set. Conflicts with installed packages are
+// returned as error.
+func (s *Simulated) resolve(repos []Repo, selected []Package, noRecommends bool) ([]Package, []Package, error) {
+	var deps, recommended []Package
+	kept, _ := s.remaining(selected)
+	all := slices.Clone(selected)
+	available := func(capability string) bool {
+		return satisfied(kept, capability) || satisfied(all, capability)
+	}
+	for queue := slices.Clone(selected); len(queue) > 0; queue = queue[1:] {
+		pkg := queue[0]
+		for _, req := range pkg.Requires {
+			if available(req) {
+				continue
+			}
+			dep, ok := best(repos, func(p Package) bool { return p.provides(req) })
+			if !ok {
+				return nil, nil, fmt.Errorf("nothing provides '%s' needed by %s", req, pkg.nevra())
+			}
+			dep.Auto = true
+			all = append(all, dep)
+			deps = append(deps, dep)
+			queue = append(queue, dep)
+		}
+		if noRecommends {
+			continue
+		}
+		for _, rec := range pkg.Recommends {
+			if available(rec) {
+				continue
+			}
+			if dep, ok := best(repos, func(p Package) bool { return p.provides(rec) }); ok {
+				dep.Auto = true
+				all = append(all, dep)
+				recommended = append(recommended, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	kept, _ = s.remaining(all)
+	for _, pkg := range all {
+		for _, other := range slices.Concat(kept, all) {
+			if pkg.conflictsWith(other) || other.conflictsWith(pkg) {
+				return nil, nil, fmt.Errorf("%s conflicts with %s", pkg.nevra(), other.nevra())
+			}
+		}
+	}
+	return deps, recommended, nil
+}
+
+// commit installs the selected packages, replacing the installed packages
+// of the same name and architecture and removing the obsoleted ones.
+func (s *Simulated) commit(selected []Package) {
+	kept, _ := s.remaining(selected)
+	now := time.Now()
+	for _, pkg := range selected {
+		pkg.InstallTime = now
+		kept = append(kept, pkg)
+	}
+	s.installed = kept
+}
+
+func packageInfos(pkgs []Package) []syspackage.PackageInfo {
+	infos := []syspackage.PackageInfo{}
+	for _, pkg := range pkgs {
+		infos = append(infos, pkg.packageInfo())
+	}
+	return infos
+}
+
+func names(pkgs []Package) string {
+	var lst []string
+	for _, pkg := range pkgs {
+		lst = append(lst, pkg.Name)
+	}
+	return strings.Join(lst, " ")
+}
+
+// output collects the output of a transaction, which is reported as
+// progress as well.
+type output struct {
+	strings.Builder
+	progress func(string)
+}
+
+func newOutput(ctx context.Context, request *mcp.CallToolRequest) *output {
+	return &output{progress: syspackage.Progress(ctx, request)}
+}
+
+func (out *output) line(format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	out.WriteString(line + "\n")
+	out.progress(line)
+}
+
+func (out *output) summary(what string, pkgs []Package) {
+	if len(pkgs) > 0 {
+		out.line("The following %d packages are going to be %s:", len(pkgs), what)
+		out.line("  %s", names(pkgs))
+	}
+}
+
+func (out *output) steps(action string, pkgs []Package) {
+	for i, pkg := range pkgs {
+		out.line("(%d/%d) %s: %s ...[done]", i+1, len(pkgs), action, pkg.nevra())
+	}
+}
+
+func (s *Simulated) InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPackageParams) (syspackage.InstallResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fromRepos []string
+	if params.FromRepo != "" {
+		fromRepos = []string{params.FromRepo}
+	}
+	repos, err := s.searchRepos(fromRepos)
+	if err != nil {
+		return syspackage.InstallResult{}, err
+	}
+	pkg, ok := best(repos, func(p Package) bool {
+		return p.Name == params.Name && (params.Version == "" || params.Version == p.Version || params.Version == p.evr())
+	})
+	if !ok {
+		if params.Version != "" {
+			return syspackage.InstallResult{}, fmt.Errorf("no provider of '%s=%s' found", params.Name, params.Version)
+		}
+		return syspackage.InstallResult{}, fmt.Errorf("no provider of '%s' found", params.Name)
+	}
+	result := syspackage.InstallResult{
+		Installed:    []syspackage.PackageInfo{},
+		Dependencies: []syspackage.PackageInfo{},
+		Recommended:  []syspackage.PackageInfo{},
+	}
+	out := newOutput(ctx, request)
+	if slices.ContainsFunc(s.installed, func(inst Package) bool { return replaces(pkg, inst) && compareEVR(pkg, inst) == 0 }) {
+		out.line("'%s' is already installed.", pkg.nevra())
+		out.line("Nothing to do.")
+		result.RawOutput = out.String()
+		return result, nil
+	}
+
+	enabled, _ := s.searchRepos(nil)
+	deps, recommended, err := s.resolve(enabled, []Package{pkg}, params.NoRecommends)
+	if err != nil {
+		return syspackage.InstallResult{}, err
+	}
+	selected := slices.Concat([]Package{pkg}, deps, recommended)
+	result.Installed = packageInfos([]Package{pkg})
+	result.Dependencies = packageInfos(deps)
+	result.Recommended = packageInfos(recommended)
+	out.summary("installed", selected)
+	if params.ShowDetails {
+		out.line("Dry run, nothing was installed.")
+		result.RawOutput = out.String()
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return syspackage.InstallResult{}, err
+	}
+	out.steps("Installing", selected)
+	s.commit(selected)
+	result.RawOutput = out.String()
+	return result, nil
+}
+
+func (s *Simulated) RemovePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.RemovePackageParams) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.ContainsFunc(s.installed, func(pkg Package) bool { return pkg.Name == params.Name }) {
+		return "", fmt.Errorf("package '%s' is not installed", params.Name)
+	}
+	removed := make([]bool, len(s.installed))
+	kept := func(skip int) []Package {
+		var lst []Package
+		for i, pkg := range s.installed {
+			if !removed[i] && i != skip {
+				lst = append(lst, pkg)
+			}
+		}
+		return lst
+	}
+	for i, pkg := range s.installed {
+		removed[i] = pkg.Name == params.Name
+	}
+	// the packages requiring a removed one are removed as well
+	for changed := true; changed; {
+		changed = false
+		for i, pkg := range s.installed {
+			if removed[i] {
+				continue
+			}
+			for _, req := range pkg.Requires {
+				if !satisfied(kept(-1), req) {
+					removed[i], changed = true, true
+					break
+				}
+			}
+		}
+	}
+	// and the dependencies nothing needs anymore
+	for changed := params.RemoveDeps; changed; {
+		changed = false
+		for i, pkg := range s.installed {
+			if removed[i] || !pkg.Auto {
+				continue
+			}
+			needed := slices.ContainsFunc(kept(i), func(other Package) bool {
+				return slices.ContainsFunc(slices.Concat(other.Requires, other.Recommends), pkg.provides)
+			})
+			if !needed {
+				removed[i], changed = true, true
+			}
+		}
+	}
+
+	var remove, keep []Package
+	for i, pkg := range s.installed {
+		if removed[i] {
+			remove = append(remove, pkg)
+		} else {
+			keep = append(keep, pkg)
+		}
+	}
+	out := newOutput(ctx, request)
+	out.summary("REMOVED", remove)
+	if params.ShowDetails {
+		out.line("Dry run, nothing was removed.")
+		return out.String(), nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	out.steps("Removing", remove)
+	s.installed = keep
+	return out.String(), nil
+}
+
+func (s *Simulated) UpdatePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.UpdatePackageParams) (syspackage.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repos, err := s.searchRepos(params.Repos)
+	if err != nil {
+		return syspackage.UpdateResult{}, err
+	}
+	if params.Name != "" && s.findInstalled(params.Name) < 0 {
+		return syspackage.UpdateResult{}, fmt.Errorf("package '%s' is not installed", params.Name)
+	}
+	var upgraded, downgraded []Package
+	for _, inst := range s.installed {
+		if !matchName(params.Name, inst.Name) {
+			continue
+		}
+		candidate, ok := best(repos, func(p Package) bool { return replaces(p, inst) })
+		if !ok {
+			continue
+		}
+		candidate.Auto = inst.Auto
+		switch c := compareEVR(candidate, inst); {
+		case c > 0:
+			upgraded = append(upgraded, candidate)
+		case c < 0 && params.Upgrade:
+			// a distribution upgrade switches to the versions of the
+			// repositories
+			downgraded = append(downgraded, candidate)
+		}
+	}
+	selected := slices.Concat(upgraded, downgraded)
+	enabled, _ := s.searchRepos(nil)
+	deps, _, err := s.resolve(enabled, selected, true)
+	if err != nil {
+		return syspackage.UpdateResult{}, err
+	}
+	selected = append(selected, deps...)
+	_, obsoleted := s.remaining(selected)
+
+	result := syspackage.UpdateResult{
+		Upgraded:   s.changes(upgraded),
+		Downgraded: s.changes(downgraded),
+		New:        packageInfos(deps),
+		Removed:    packageInfos(obsoleted),
+	}
+	out := newOutput(ctx, request)
+	if len(selected) == 0 {
+		out.line("Nothing to do.")
+		result.RawOutput = out.String()
+		return result, nil
+	}
+	out.summary("upgraded", upgraded)
+	out.summary("downgraded", downgraded)
+	out.summary("installed", deps)
+	out.summary("REMOVED", obsoleted)
+	if params.ShowDetails {
+		out.line("Dry run, nothing was updated.")
+		result.RawOutput = out.String()
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return syspackage.UpdateResult{}, err
+	}
+	out.steps("Installing", selected)
+	s.commit(selected)
+	result.RawOutput = out.String()
+	return result, nil
+}
+
+// changes returns the packages with the version of the installed package
+// they replace.
+func (s *Simulated) changes(pkgs []Package) []syspackage.PackageInfo {
+	infos := packageInfos(pkgs)
+	for i, pkg := range pkgs {
+		if j := slices.IndexFunc(s.installed, func(inst Package) bool { return replaces(pkg, inst) }); j >= 0 {
+			infos[i].OldVersion = s.installed[j].evr()
+		}
+	}
+	return infos
+}
+
+func (s *Simulated) InstallPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.InstallPatchesParams) (syspackage.InstallPatchesResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enabled, _ := s.searchRepos(nil)
+	status := "applied"
+	if params.ShowDetails {
+		status = "needed"
+	}
+	result := syspackage.InstallPatchesResult{Patches: []map[string]any{}}
+	var selected []Package
+	for _, patch := range s.patches {
+		if !patch.matches(params.Category, params.Severity) || s.patchStatus(patch) != "needed" {
+			continue
+		}
+		for _, fixed := range patch.Packages {
+			for _, inst := range s.installed {
+				if inst.Name != fixed.Name || compareEVR(inst, fixed) >= 0 {
+					continue
+				}
+				// the package of the repositories has all the details, the
+				// patch may only give the version
+				pkg, ok := best(enabled, func(p Package) bool { return replaces(p, inst) && compareEVR(p, fixed) == 0 })
+				if !ok {
+					pkg = inst
+					pkg.Epoch, pkg.Version, pkg.Release = fixed.Epoch, fixed.Version, fixed.Release
+				}
+				pkg.Auto = inst.Auto
+				i := slices.IndexFunc(selected, func(p Package) bool { return replaces(p, pkg) })
+				if i < 0 {
+					selected = append(selected, pkg)
+				} else if compareEVR(pkg, selected[i]) > 0 {
+					selected[i] = pkg
+				}
+			}
+		}
+		result.Patches = append(result.Patches, patch.toMap(status))
+	}
+	deps, _, err := s.resolve(enabled, selected, true)
+	if err != nil {
+		return syspackage.InstallPatchesResult{}, err
+	}
+	upgraded := selected
+	selected = slices.Concat(selected, deps)
+	out := newOutput(ctx, request)
+	if params.ShowDetails {
+		_, obsoleted := s.remaining(selected)
+		out.summary("upgraded", upgraded)
+		out.summary("installed", deps)
+		out.summary("REMOVED", obsoleted)
+		out.line("Dry run, nothing was installed.")
+		result.Changes = &syspackage.UpdateResult{
+			Upgraded:   s.changes(upgraded),
+			Downgraded: []syspackage.PackageInfo{},
+			New:        packageInfos(deps),
+			Removed:    packageInfos(obsoleted),
+			RawOutput:  out.String(),
+		}
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return syspackage.InstallPatchesResult{}, err
+	}
+	out.steps("Installing", selected)
+	s.commit(selected)
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package simulated
+
+import (
+	"cmp"
+	"strings"
+	"unicode"
+)
+
+// vercmp compares two versions like rpm does: the versions are split into
+// numeric and alphabetic segments, numeric segments are compared as numbers
+// and are newer than alphabetic ones, separators are ignored.
+func vercmp(a, b string) int {
+	isDigit := func(r rune) bool { return r >= '0' && r <= '9' }
+	isAlpha := func(r rune) bool { return r < unicode.MaxASCII && unicode.IsLetter(r) }
+	isSep := func(r rune) bool { return !isDigit(r) && !isAlpha(r) }
+	for {
+		a = strings.TrimLeftFunc(a, isSep)
+		b = strings.TrimLeftFunc(b, isSep)
+		if a == "" || b == "" {
+			break
+		}
+		class := isAlpha
+		if isDigit(rune(a[0])) {
+			class = isDigit
+		}
+		segA, restA := span(a, class)
+		segB, restB := span(b, class)
+		if segB == "" {
+			// numeric segments are newer than alphabetic ones
+			if isDigit(rune(a[0])) {
+				return 1
+			}
+			return -1
+		}
+		var c int
+		if isDigit(rune(a[0])) {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			c = cmp.Or(cmp.Compare(len(segA), len(segB)), strings.Compare(segA, segB))
+		} else {
+			c = strings.Compare(segA, segB)
+		}
+		if c != 0 {
+			return c
+		}
+		a, b = restA, restB
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func span(s string, class func(rune) bool) (string, string) {
+	i := strings.IndexFunc(s, func(r rune) bool { return !class(r) })
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// compareEVR compares the epoch, version and release of two packages.
+func compareEVR(a, b Package) int {
+	return cmp.Or(cmp.Compare(a.Epoch, b.Epoch), vercmp(a.Version, b.Version), vercmp(a.Release, b.Release))
+}
@@ -0,0 +1,77 @@
+package syspackage
+
+import (
+	"slices"
+)
+
+// Capabilities are the operations and schema options a backend supports.
+// The tools of unsupported operations aren't registered, the enums of the
+// input schemas only offer the supported query modes and relations, and
+// the options of unsupported features are left out.
+type Capabilities struct {
+	// Unsupported maps the tool names of the unsupported operations, see
+	// Operations, to the reason why they aren't supported.
+	Unsupported map[string]string
+	// QueryModes are the supported modes of query_package.
+	QueryModes []string
+	// Relations are the relations list_packages can display.
+	Relations []string
+	// Solutions reports whether install_package can apply the chosen
+	// solutions of dependency problems.
+	Solutions bool
+}
+
+// ValidRelations returns the relations of packages known to list_packages.
+func ValidRelations() []string {
+	return []string{"requires", "recommends", "suggests", "supplements", "enhances", "provides", "conflicts", "obsoletes"}
+}
+
+// AllCapabilities returns the capabilities of a backend which supports all
+// operations, query modes, relations and features.
+func AllCapabilities() Capabilities {
+	return Capabilities{
+		Unsupported: map[string]string{},
+		QueryModes:  ValidQueryModes(),
+		Relations:   ValidRelations(),
+		Solutions:   true,
+	}
+}
+
+// NoCapabilities returns the capabilities of a backend which supports no
+// operation at all, giving reason for every one.
+func NoCapabilities(reason string) Capabilities {
+	caps := Capabilities{Unsupported: map[string]string{}}
+	for _, op := range Operations() {
+		caps.Unsupported[op] = reason
+	}
+	return caps
+}
+
+// Supports reports whether the tool is supported, and if not, why. Tools
+// which aren't package operations, like the ones of the jobs, are always
+// supported.
+func (caps Capabilities) Supports(tool string) (bool, string) {
+	reason, unsupported := caps.Unsupported[tool]
+	return !unsupported, reason
+}
+
+// Operations returns the tool names of the supported operations.
+func (caps Capabilities) Operations() []string {
+	return slices.DeleteFunc(Operations(), func(op string) bool {
+		_, unsupported := caps.Unsupported[op]
+		return unsupported
+	})
+}
+
+// SupportsQueryMode reports whether query_package supports the mode.
+func (caps Capabilities) SupportsQueryMode(mode string) bool {
+	return slices.Contains(caps.QueryModes, mode)
+}
+
+func toEnum(values []string) []any {
+	enum := []any{}
+	for _, value := range values {
+		enum = append(enum, value)
+	}
+	return enum
+}
@@ -0,0 +1,177 @@
+package syspackage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/confirm"
+)
+
+func (sysPkg SysPackage) dryRunInstall(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) (InstallResult, error) {
+	params.ShowDetails = true
+	params.Background = false
+	return sysPkg.InstallPackageSysCall(ctx, request, params)
+}
+
+func (sysPkg SysPackage) dryRunRemove(ctx context.Context, request *mcp.CallToolRequest, params RemovePackageParams) (string, error) {
+	params.ShowDetails = true
+	return sysPkg.RemovePackageSysCall(ctx, request, params)
+}
+
+func (sysPkg SysPackage) dryRunUpdate(ctx context.Context, request *mcp.CallToolRequest, params UpdatePackageParams) (UpdateResult, error) {
+	params.ShowDetails = true
+	params.Background = false
+	return sysPkg.UpdatePackageSysCall(ctx, request, params)
+}
+
+func (sysPkg SysPackage) dryRunPatches(ctx context.Context, request *mcp.CallToolRequest, params InstallPatchesParams) (InstallPatchesResult, error) {
+	params.ShowDetails = true
+	params.Background = false
+	return sysPkg.InstallPatchesSysCall(ctx, request, params)
+}
+
+// planSteps returns the steps of a plan, like 'install vim 9.1-1.1'.
+func planSteps(action string, pkgs []PackageInfo) []string {
+	var steps []string
+	for _, pkg := range pkgs {
+		step := fmt.Sprintf("%s %s %s", action, pkg.Name, pkg.Version)
+		if pkg.OldVersion != "" {
+			step = fmt.Sprintf("%s %s %s -> %s", action, pkg.Name, pkg.OldVersion, pkg.Version)
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func installPlan(result InstallResult) []string {
+	return slices.Concat(
+		planSteps("install", slices.Concat(result.Installed, result.Dependencies, result.Recommended)),
+		planSteps("remove", ParseRemovedPackages(result.RawOutput)))
+}
+
+func updatePlan(result UpdateResult) []string {
+	return slices.Concat(
+		planSteps("upgrade", result.Upgraded),
+		planSteps("downgrade", result.Downgraded),
+		planSteps("install", result.New),
+		planSteps("remove", result.Removed))
+}
+
+// patchesPlan returns the patches and the package changes of a dry run of
+// install_patches, as the same patches may change other packages later on.
+func patchesPlan(result InstallPatchesResult) []string {
+	var steps []string
+	for _, patch := range result.Patches {
+		steps = append(steps, fmt.Sprintf("patch %v", patch["name"]))
+	}
+	if result.Changes != nil {
+		steps = append(steps, updatePlan(*result.Changes)...)
+	}
+	return steps
+}
+
+// confirmed redeems the token of the call and checks the plan it was issued
+// for against the current one.
+func (sysPkg SysPackage) confirmed(tool string, token string, params any, plan func() ([]string, error)) error {
+	confirmedPlan, err := sysPkg.Confirm.Redeem(token, tool, params)
+	if err != nil {
+		return err
+	}
+	current, err := plan()
+	if err != nil {
+		return fmt.Errorf("failed to check the plan: %w", err)
+	}
+	return confirm.CheckPlan(confirmedPlan, current)
+}
+
+// planInstall returns the dry run of install_package as plan.
+func (sysPkg SysPackage) planInstall(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) (InstallResult, error) {
+	// the confirmed transaction may run in the background
+	params.Background = false
+	result, err := sysPkg.dryRunInstall(ctx, request, params)
+	if err != nil {
+		return InstallResult{}, err
+	}
+	result.Confirmation, err = sysPkg.Confirm.Issue("install_package", params, installPlan(result))
+	return result, err
+}
+
+func (sysPkg SysPackage) confirmInstall(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) error {
+	token := params.ConfirmToken
+	params.ConfirmToken = ""
+	params.Background = false
+	return sysPkg.confirmed("install_package", token, params, func() ([]string, error) {
+		result, err := sysPkg.dryRunInstall(ctx, request, params)
+		return installPlan(result), err
+	})
+}
+
+// planRemove returns the dry run of remove_package as plan.
+func (sysPkg SysPackage) planRemove(ctx context.Context, request *mcp.CallToolRequest, params RemovePackageParams) (RemovePackageResult, error) {
+	output, err := sysPkg.dryRunRemove(ctx, request, params)
+	if err != nil {
+		return RemovePackageResult{}, err
+	}
+	result := RemovePackageResult{Removed: ParseRemovedPackages(output), RawOutput: output}
+	if result.Removed == nil {
+		result.Removed = []PackageInfo{}
+	}
+	result.Confirmation, err = sysPkg.Confirm.Issue("remove_package", params, planSteps("remove", result.Removed))
+	return result, err
+}
+
+func (sysPkg SysPackage) confirmRemove(ctx context.Context, request *mcp.CallToolRequest, params RemovePackageParams) error {
+	token := params.ConfirmToken
+	params.ConfirmToken = ""
+	return sysPkg.confirmed("remove_package", token, params, func() ([]string, error) {
+		output, err := sysPkg.dryRunRemove(ctx, request, params)
+		return planSteps("remove", ParseRemovedPackages(output)), err
+	})
+}
+
+// planUpdate returns the dry run of update_package as plan.
+func (sysPkg SysPackage) planUpdate(ctx context.Context, request *mcp.CallToolRequest, params UpdatePackageParams) (UpdateResult, error) {
+	params.Background = false
+	result, err := sysPkg.dryRunUpdate(ctx, request, params)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	result.Confirmation, err = sysPkg.Confirm.Issue("update_package", params, updatePlan(result))
+	return result, err
+}
+
+func (sysPkg SysPackage) confirmUpdate(ctx context.Context, request *mcp.CallToolRequest, params UpdatePackageParams) error {
+	token := params.ConfirmToken
+	params.ConfirmToken = ""
+	params.Background = false
+	return sysPkg.confirmed("update_package", token, params, func() ([]string, error) {
+		result, err := sysPkg.dryRunUpdate(ctx, request, params)
+		return updatePlan(result), err
+	})
+}
+
+// planPatches returns the dry run of install_patches as plan.
+func (sysPkg SysPackage) planPatches(ctx context.Context, request *mcp.CallToolRequest, params InstallPatchesParams) (InstallPatchesResult, error) {
+	params.Background = false
+	result, err := sysPkg.dryRunPatches(ctx, request, params)
+	if err != nil {
+		return InstallPatchesResult{}, err
+	}
+	if result.Patches == nil {
+		result.Patches = []map[string]any{}
+	}
+	result.Confirmation, err = sysPkg.Confirm.Issue("install_patches", params, patchesPlan(result))
+	return result, err
+}
+
+func (sysPkg SysPackage) confirmPatches(ctx context.Context, request *mcp.CallToolRequest, params InstallPatchesParams) error {
+	token := params.ConfirmToken
+	params.ConfirmToken = ""
+	params.Background = false
+	return sysPkg.confirmed("install_patches", token, params, func() ([]string, error) {
+		result, err := sysPkg.dryRunPatches(ctx, request, params)
+		return patchesPlan(result), err
+	})
+}
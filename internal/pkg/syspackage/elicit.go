@@ -0,0 +1,209 @@
+package syspackage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ErrDeclined is returned if the user declined a question asked through
+// elicitation.
+var ErrDeclined = errors.New("declined by the user")
+
+// CanElicit reports whether the user can be asked through the client of the
+// request. Background jobs have no request, so they can't ask.
+func CanElicit(request *mcp.CallToolRequest) bool {
+	if request == nil || request.Session == nil {
+		return false
+	}
+	init := request.Session.InitializeParams()
+	return init != nil && init.Capabilities != nil && init.Capabilities.Elicitation != nil
+}
+
+// ElicitChoice asks the user to choose one of the choices and returns the
+// index of the chosen one.
+func ElicitChoice(ctx context.Context, request *mcp.CallToolRequest, message string, choices []string) (int, error) {
+	schema := &jsonschema.Schema{
+		Type: "object",
+		Properties: map[string]*jsonschema.Schema{
+			"choice": {Type: "string", Enum: toEnum(choices)},
+		},
+		Required: []string{"choice"},
+	}
+	res, err := request.Session.Elicit(ctx, &mcp.ElicitParams{Message: message, RequestedSchema: schema})
+	if err != nil {
+		return 0, fmt.Errorf("failed to ask the user: %w", err)
+	}
+	if res.Action != "accept" {
+		return 0, fmt.Errorf("%w: %s", ErrDeclined, message)
+	}
+	choice, _ := res.Content["choice"].(string)
+	index := slices.Index(choices, choice)
+	if index < 0 {
+		return 0, fmt.Errorf("invalid choice: %s", choice)
+	}
+	return index, nil
+}
+
+// ElicitConfirm asks the user to confirm the message and returns ErrDeclined
+// unless confirmed.
+func ElicitConfirm(ctx context.Context, request *mcp.CallToolRequest, message string) error {
+	schema := &jsonschema.Schema{
+		Type: "object",
+		Properties: map[string]*jsonschema.Schema{
+			"confirm": {Type: "boolean", Description: "Continue with the transaction."},
+		},
+		Required: []string{"confirm"},
+	}
+	res, err := request.Session.Elicit(ctx, &mcp.ElicitParams{Message: message, RequestedSchema: schema})
+	if err != nil {
+		return fmt.Errorf("failed to ask the user: %w", err)
+	}
+	if confirmed, _ := res.Content["confirm"].(bool); res.Action != "accept" || !confirmed {
+		return fmt.Errorf("%w: %s", ErrDeclined, message)
+	}
+	return nil
+}
+
+// SolverProblem is a dependency problem zypper can't solve on its own, along
+// with the solutions it offers.
+type SolverProblem struct {
+	ID          int              `json:"id" jsonschema:"The number of the problem, in the order the problems are asked."`
+	Description string           `json:"description"`
+	Solutions   []SolverSolution `json:"solutions"`
+}
+
+// SolverSolution is one of the solutions of a SolverProblem.
+type SolverSolution struct {
+	ID          int    `json:"id" jsonschema:"The id of the solution, to be passed in solutions to apply it."`
+	Description string `json:"description"`
+}
+
+// SolverProblemsError is returned if a transaction failed on dependency
+// problems, which can be solved by calling it again with the ids of the
+// chosen solutions.
+type SolverProblemsError struct {
+	Problems []SolverProblem
+	// Output is the output of the failed transaction.
+	Output string
+}
+
+func (e *SolverProblemsError) Error() string {
+	var descs []string
+	for _, problem := range e.Problems {
+		descs = append(descs, fmt.Sprintf("problem %d: %s", problem.ID, problem.Description))
+	}
+	return "the dependencies can't be solved, " + strings.Join(descs, "; ")
+}
+
+var (
+	zypperProblemRe  = regexp.MustCompile(`^Problem: (?:\d+: )?(.*)$`)
+	zypperSolutionRe = regexp.MustCompile(`^\s+Solution (\d+): (.*)$`)
+)
+
+// ParseZypperProblems returns the problems zypper asked to solve, numbered
+// in the order they were asked. Problems listed without solutions, like in
+// the overview of several problems, are skipped.
+func ParseZypperProblems(output string) []SolverProblem {
+	var problems []SolverProblem
+	var current *SolverProblem
+	flush := func() {
+		if current != nil && len(current.Solutions) > 0 {
+			current.ID = len(problems) + 1
+			problems = append(problems, *current)
+		}
+		current = nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch match := zypperProblemRe.FindStringSubmatch(line); {
+		case match != nil:
+			flush()
+			current = &SolverProblem{Description: match[1]}
+		case current == nil:
+		case zypperSolutionRe.MatchString(line):
+			match := zypperSolutionRe.FindStringSubmatch(line)
+			id, _ := strconv.Atoi(match[1])
+			current.Solutions = append(current.Solutions, SolverSolution{ID: id, Description: match[2]})
+		case trimmed != "" && strings.HasPrefix(line, " "):
+			// details of the problem or the actions of the solution
+			if n := len(current.Solutions); n > 0 {
+				current.Solutions[n-1].Description += "; " + trimmed
+			} else {
+				current.Description += "; " + trimmed
+			}
+		default:
+			flush()
+		}
+	}
+	flush()
+	return problems
+}
+
+// ParseZypperVendorChanges returns the packages changing their vendor in a
+// transaction of zypper.
+func ParseZypperVendorChanges(output string) []string {
+	var pkgs []string
+	inSection := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.Contains(line, "going to change vendor:"):
+			inSection = true
+		case !strings.HasPrefix(line, " "):
+			inSection = false
+		case inSection:
+			// with --details every package has its own line, otherwise
+			// the names are listed on one line
+			fields := strings.Fields(line)
+			if strings.Contains(line, "->") {
+				fields = fields[:1]
+			}
+			pkgs = append(pkgs, fields...)
+		}
+	}
+	return pkgs
+}
+
+// License is a license zypper asks to agree to.
+type License struct {
+	Package string `json:"package"`
+	Text    string `json:"text"`
+}
+
+var zypperLicenseRe = regexp.MustCompile(`^In order to install '([^']+)'.* you must agree to terms of the following license agreement:`)
+
+// ParseZypperLicenses returns the licenses zypper asked to agree to.
+func ParseZypperLicenses(output string) []License {
+	var licenses []License
+	var current *License
+	var text []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch match := zypperLicenseRe.FindStringSubmatch(line); {
+		case match != nil:
+			current = &License{Package: match[1]}
+			text = nil
+		case current == nil:
+		case strings.HasPrefix(line, "Do you agree with the terms of the license?"):
+			current.Text = strings.TrimSpace(strings.Join(text, "\n"))
+			licenses = append(licenses, *current)
+			current = nil
+		default:
+			text = append(text, line)
+		}
+	}
+	return licenses
+}
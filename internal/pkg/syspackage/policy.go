@@ -0,0 +1,113 @@
+package syspackage
+
+import (
+	"context"
+	"slices"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/policy"
+)
+
+// ParseRemovedPackages returns the packages removed by a transaction, as
+// printed by zypper, dnf or apt, whose formats don't overlap.
+func ParseRemovedPackages(output string) []PackageInfo {
+	for _, parse := range []func(string) UpdateResult{ParseZypperUpdateOutput, ParseDnfUpdateOutput, ParseAptUpdateOutput} {
+		if removed := parse(output).Removed; len(removed) > 0 {
+			return removed
+		}
+	}
+	return nil
+}
+
+func policyPackages(pkgs ...[]PackageInfo) []policy.Package {
+	var result []policy.Package
+	for _, pkg := range slices.Concat(pkgs...) {
+		result = append(result, policy.Package{Name: pkg.Name, Version: pkg.Version})
+	}
+	return result
+}
+
+// checkInstall evaluates the policy for install_package. The packages pulled
+// in and removed are found by a dry run.
+func (sysPkg SysPackage) checkInstall(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) error {
+	if err := sysPkg.Policy.CheckPackage(policy.Package{Name: params.Name, Version: params.Version}); err != nil {
+		return err
+	}
+	if params.ShowDetails || !sysPkg.Policy.HasPackageRules() {
+		return nil
+	}
+	result, err := sysPkg.dryRunInstall(ctx, request, params)
+	if err != nil {
+		return err
+	}
+	return sysPkg.Policy.CheckTransaction(policy.Transaction{
+		Changed: policyPackages(result.Installed, result.Dependencies, result.Recommended),
+		Removed: policyPackages(ParseRemovedPackages(result.RawOutput)),
+	})
+}
+
+// checkRemove evaluates the policy for remove_package, including the packages
+// removed along with the package.
+func (sysPkg SysPackage) checkRemove(ctx context.Context, request *mcp.CallToolRequest, params RemovePackageParams) error {
+	if err := sysPkg.Policy.CheckRemove(policy.Package{Name: params.Name}); err != nil {
+		return err
+	}
+	if params.ShowDetails || !sysPkg.Policy.HasPackageRules() {
+		return nil
+	}
+	output, err := sysPkg.dryRunRemove(ctx, request, params)
+	if err != nil {
+		return err
+	}
+	return sysPkg.Policy.CheckTransaction(policy.Transaction{
+		Removed: policyPackages(ParseRemovedPackages(output)),
+	})
+}
+
+// checkUpdate evaluates the policy for update_package with a dry run.
+func (sysPkg SysPackage) checkUpdate(ctx context.Context, request *mcp.CallToolRequest, params UpdatePackageParams) error {
+	if params.Name != "" {
+		if err := sysPkg.Policy.CheckPackage(policy.Package{Name: params.Name}); err != nil {
+			return err
+		}
+	}
+	if params.ShowDetails || !sysPkg.Policy.HasPackageRules() {
+		return nil
+	}
+	result, err := sysPkg.dryRunUpdate(ctx, request, params)
+	if err != nil {
+		return err
+	}
+	return sysPkg.Policy.CheckTransaction(policy.Transaction{
+		Changed: policyPackages(result.Upgraded, result.Downgraded, result.New),
+		Removed: policyPackages(result.Removed),
+	})
+}
+
+// checkPatches evaluates the policy for install_patches with a dry run, as
+// the packages changed by the patches are only known to the package manager.
+func (sysPkg SysPackage) checkPatches(ctx context.Context, request *mcp.CallToolRequest, params InstallPatchesParams) error {
+	if params.ShowDetails || !sysPkg.Policy.HasPackageRules() {
+		return nil
+	}
+	result, err := sysPkg.dryRunPatches(ctx, request, params)
+	if err != nil {
+		return err
+	}
+	if result.Changes == nil {
+		return nil
+	}
+	return sysPkg.Policy.CheckTransaction(policy.Transaction{
+		Changed: policyPackages(result.Changes.Upgraded, result.Changes.Downgraded, result.Changes.New),
+		Removed: policyPackages(result.Changes.Removed),
+	})
+}
+
+// checkModifyRepo evaluates the policy for modify_repo. Removing a
+// repository is always allowed.
+func (sysPkg SysPackage) checkModifyRepo(params ModifyRepoParams) error {
+	if params.RemoveRepos {
+		return nil
+	}
+	return sysPkg.Policy.CheckRepo(params.Url, !params.NoGPGCheck)
+}
@@ -0,0 +1,40 @@
+package syspackage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
+	"github.com/suse/managesw-mcp/internal/pkg/jobs"
+)
+
+// RunWithProgress runs cmd and reports every output line with Progress. The
+// combined output is returned together with the error of the command.
+func RunWithProgress(ctx context.Context, request *mcp.CallToolRequest, runner cmdrunner.Runner, cmd cmdrunner.Cmd) (string, error) {
+	out, err := runner.Stream(ctx, cmd, Progress(ctx, request))
+	return string(out), err
+}
+
+// Progress returns the function reporting the progress of a transaction
+// line by line. The lines are sent as progress notifications to the client,
+// if the request carries a progress token. Within background jobs they are
+// written to the log of the job instead.
+func Progress(ctx context.Context, request *mcp.CallToolRequest) func(line string) {
+	var progressToken any
+	if request != nil && request.Params != nil {
+		progressToken = request.Params.GetProgressToken()
+	}
+	jobLog := jobs.Log(ctx)
+	return func(line string) {
+		if jobLog != nil {
+			fmt.Fprintln(jobLog, line)
+		}
+		if progressToken != nil && request.Session != nil {
+			_ = request.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+				ProgressToken: progressToken,
+				Message:       line,
+			})
+		}
+	}
+}
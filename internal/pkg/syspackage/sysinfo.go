@@ -0,0 +1,118 @@
+package syspackage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
+)
+
+// SystemInfo describes the backend and the system it manages.
+type SystemInfo struct {
+	Backend    string            `json:"backend" jsonschema:"The package manager backend, one of zypper, dnf, apt, simulated or none."`
+	Versions   map[string]string `json:"versions,omitempty" jsonschema:"The versions of the package manager tools."`
+	OSRelease  map[string]string `json:"os_release,omitempty" jsonschema:"The fields of the os-release file of the managed system."`
+	Root       string            `json:"root,omitempty" jsonschema:"The root directory of the managed system, if it isn't the running system."`
+	Operations []string          `json:"operations" jsonschema:"The operations supported by the backend, named like their tools."`
+	// Unsupported are the operations whose tools aren't registered.
+	Unsupported map[string]string `json:"unsupported,omitempty" jsonschema:"The operations not supported by the backend with the reason why."`
+}
+
+// Operations returns the names of the tools of the package operations. The
+// ones supported by a backend are given by its Capabilities.
+func Operations() []string {
+	return []string{
+		"list_packages",
+		"query_package",
+		"list_repos",
+		"modify_repo",
+		"refresh_repos",
+		"list_patches",
+		"install_patches",
+		"search_package",
+		"install_package",
+		"remove_package",
+		"update_package",
+	}
+}
+
+// NewSystemInfo returns the information about a backend managing the system
+// at root. The operations are filled in from the Capabilities.
+func NewSystemInfo(backend string, root string) SystemInfo {
+	return SystemInfo{
+		Backend:   backend,
+		Versions:  make(map[string]string),
+		OSRelease: ReadOSRelease(root),
+		Root:      root,
+	}
+}
+
+// ReadOSRelease reads the os-release file of the system at root, see
+// os-release(5). Missing files result in an empty map.
+func ReadOSRelease(root string) map[string]string {
+	fields := make(map[string]string)
+	for _, name := range []string{"etc/os-release", "usr/lib/os-release"} {
+		content, err := os.ReadFile(filepath.Join("/", root, name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			key, value, ok := strings.Cut(line, "=")
+			if !ok || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(value, `'"`)
+			}
+			fields[key] = value
+		}
+		break
+	}
+	return fields
+}
+
+// ToolVersion returns the version printed by 'name --version', which is the
+// first word starting with a digit, like in 'zypper 1.14.77' or 'RPM version
+// 4.20.0'. Failures result in an empty version.
+func ToolVersion(ctx context.Context, runner cmdrunner.Runner, name string) string {
+	if name == "" {
+		return ""
+	}
+	out, err := runner.Run(ctx, cmdrunner.New(name, "--version"))
+	if err != nil {
+		return ""
+	}
+	firstLine, _, _ := strings.Cut(string(out), "\n")
+	for _, word := range strings.Fields(firstLine) {
+		if unicode.IsDigit(rune(word[0])) {
+			return strings.TrimRight(word, ".,")
+		}
+	}
+	return ""
+}
+
+type SystemInfoParams struct{}
+
+func (sysPkg SysPackage) SystemInfo(ctx context.Context, request *mcp.CallToolRequest, params SystemInfoParams) (*mcp.CallToolResult, SystemInfo, error) {
+	info, err := sysPkg.SystemInfoSysCall(ctx, request)
+	if err != nil {
+		return nil, SystemInfo{}, err
+	}
+	caps := sysPkg.Capabilities()
+	info.Operations = caps.Operations()
+	if len(caps.Unsupported) > 0 {
+		info.Unsupported = caps.Unsupported
+	}
+	return nil, info, nil
+}
@@ -2,69 +2,139 @@ package syspackage
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/suse/managesw-mcp/internal/pkg/confirm"
+	"github.com/suse/managesw-mcp/internal/pkg/jobs"
+	"github.com/suse/managesw-mcp/internal/pkg/policy"
 )
 
 type SysPackageInfo struct {
-	Name        string              `json:"name"`
-	Version     string              `json:"vers"`
-	Size        uint64              `json:"size"`
-	FileList    []string            `json:"file_list,omitempty"`
-	Relations   map[string][]string `json:"relations,omitempty"`
-	Description string              `json:"description,omitempty"`
-	Changelog   string              `json:"changelog,omitempty"`
+	Name          string              `json:"name"`
+	Epoch         int                 `json:"epoch,omitempty"`
+	Version       string              `json:"vers"`
+	Release       string              `json:"release,omitempty"`
+	Arch          string              `json:"arch,omitempty"`
+	Vendor        string              `json:"vendor,omitempty"`
+	License       string              `json:"license,omitempty"`
+	SourcePackage string              `json:"source_package,omitempty" jsonschema:"The source package this package was built from."`
+	InstallTime   time.Time           `json:"install_time,omitzero"`
+	BuildTime     time.Time           `json:"build_time,omitzero"`
+	Size          uint64              `json:"size"`
+	FileList      []string            `json:"file_list,omitempty"`
+	Relations     map[string][]string `json:"relations,omitempty"`
+	Description   string              `json:"description,omitempty"`
+	Changelog     string              `json:"changelog,omitempty"`
 }
+
+// EVR returns the full version of the package as '[epoch:]version[-release]'.
+func (pkg SysPackageInfo) EVR() string {
+	evr := pkg.Version
+	if pkg.Epoch > 0 {
+		evr = fmt.Sprintf("%d:%s", pkg.Epoch, evr)
+	}
+	if pkg.Release != "" {
+		evr += "-" + pkg.Release
+	}
+	return evr
+}
+
+// NEVRA returns the package as 'name-[epoch:]version-release.arch', which
+// identifies an installed package uniquely.
+func (pkg SysPackageInfo) NEVRA() string {
+	nevra := pkg.Name + "-" + pkg.EVR()
+	if pkg.Arch != "" {
+		nevra += "." + pkg.Arch
+	}
+	return nevra
+}
+
 type SearchedPackage struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
 	Status  string `json:"status"`
 }
+
+// SearchResult holds the found packages grouped by repository and
+// architecture.
+type SearchResult map[string]map[string][]SearchedPackage
+
 type SysPackageInterface interface {
-	ListInstalledPackagesSysCall(params ListPackageParams) ([]SysPackageInfo, error)
-	QueryPackageSysCall(name string, mode QueryMode, lines int) (ret map[string]any, err error)
-	ListReposSysCall(name string) (ret []map[string]any, err error)
-	RefreshReposSysCall(name string) error
-	ModifyRepoSysCall(params ModifyRepoParams) (ret map[string]any, err error)
-	ListPatchesSysCall(params ListPatchesParams) ([]map[string]any, error)
-	InstallPatchesSysCall(params InstallPatchesParams) ([]map[string]any, error)
-	SearchPackageSysCall(params SearchPackageParams) (any, error)
-	InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) (string, error)
-	RemovePackageSysCall(params RemovePackageParams) (string, error)
-	UpdatePackageSysCall(params UpdatePackageParams) (string, error)
+	ListInstalledPackagesSysCall(ctx context.Context, request *mcp.CallToolRequest, params ListPackageParams) ([]SysPackageInfo, error)
+	QueryPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, name string, mode QueryMode, lines int) (ret map[string]any, err error)
+	ListReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) (ret []Repository, err error)
+	RefreshReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) error
+	ModifyRepoSysCall(ctx context.Context, request *mcp.CallToolRequest, params ModifyRepoParams) (ret *Repository, err error)
+	ListPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params ListPatchesParams) ([]map[string]any, error)
+	InstallPatchesSysCall(ctx context.Context, request *mcp.CallToolRequest, params InstallPatchesParams) (InstallPatchesResult, error)
+	SearchPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params SearchPackageParams) (SearchResult, error)
+	InstallPackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) (InstallResult, error)
+	RemovePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params RemovePackageParams) (string, error)
+	UpdatePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params UpdatePackageParams) (UpdateResult, error)
+	SystemInfoSysCall(ctx context.Context, request *mcp.CallToolRequest) (SystemInfo, error)
+	Capabilities() Capabilities
+	// RepoConfigPaths returns the files and directories with the repository
+	// configuration, which are watched for changes.
+	RepoConfigPaths() []string
 	PkgType() string
 }
 
 type SysPackage struct {
 	SysPackageInterface
+	// Jobs runs the transactions requested with 'background', which aren't
+	// available if it is nil.
+	Jobs *jobs.Manager
+	// ReposChanged is called after modify_repo changed the repositories,
+	// if it is set.
+	ReposChanged func()
+	// Policy is evaluated before the package manager is called, nil allows
+	// everything.
+	Policy *policy.Policy
+	// Confirm requires the mutating package tools to be confirmed with a
+	// token, see package confirm, if it is set.
+	Confirm *confirm.Store
 }
 
-func (sysPkg SysPackage) List(ctx context.Context, request *mcp.CallToolRequest, params ListPackageParams) (*mcp.CallToolResult, any, error) {
-	list, err := sysPkg.ListInstalledPackagesSysCall(params)
-	if err != nil {
-		return nil, nil, err
+// startJob runs a SysCall as background job of the tool call of request.
+// The SysCall gets no request, as progress can't be reported after the tool
+// call returned.
+func (sysPkg SysPackage) startJob(request *mcp.CallToolRequest, tool string, params any, fn jobs.Func) (*jobs.Job, error) {
+	if sysPkg.Jobs == nil {
+		return nil, fmt.Errorf("background jobs are not available")
 	}
-	txtContentList := []mcp.Content{}
-	for _, pkg := range list {
-		jsonByte, err := json.Marshal(pkg)
-		if err != nil {
-			return nil, nil, fmt.Errorf("could not unmarshal packageInfo: %w", err)
-		}
-		txtContentList = append(txtContentList, &mcp.TextContent{
-			Text: string(jsonByte),
-		})
-
+	job, err := sysPkg.Jobs.Start(request, tool, params, fn)
+	if err != nil {
+		return nil, err
 	}
+	return &job, nil
+}
 
-	return &mcp.CallToolResult{
-		Content: txtContentList,
-	}, nil, nil
+type ListPackagesResult struct {
+	Packages []SysPackageInfo `json:"packages"`
+}
 
+func (sysPkg SysPackage) List(ctx context.Context, request *mcp.CallToolRequest, params ListPackageParams) (*mcp.CallToolResult, ListPackagesResult, error) {
+	relations := sysPkg.Capabilities().Relations
+	for _, rel := range params.Relations {
+		if !slices.Contains(relations, rel) {
+			return nil, ListPackagesResult{}, fmt.Errorf("unsupported relation: %s valid relations: %v", rel, relations)
+		}
+	}
+	list, err := sysPkg.ListInstalledPackagesSysCall(ctx, request, params)
+	if err != nil {
+		return nil, ListPackagesResult{}, err
+	}
+	SortPackages(list, params.Sort)
+	return nil, ListPackagesResult{Packages: list}, nil
 }
 
 type QueryMode int
@@ -101,73 +171,102 @@ func ValidQueryModes() []string {
 	return []string{"info", "requires", "recommends", "obsoletes"}
 }
 
-func GetQueryPackageParamsSchema() (*jsonschema.Schema, error) {
+func (sysPkg SysPackage) CreateQueryPackageSchema() (*jsonschema.Schema, error) {
 	schema, err := jsonschema.For[QueryPackageParams](nil)
 	if err != nil {
 		return nil, err
 	}
-	validList := []any{}
-	for _, s := range ValidQueryModes() {
-		validList = append(validList, any(s))
-	}
-	schema.Properties["mode"].Enum = validList
+	schema.Properties["mode"].Enum = toEnum(sysPkg.Capabilities().QueryModes)
 	schema.Properties["mode"].Default = json.RawMessage("\"info\"")
 	return schema, nil
 }
 
-func (sysPkg SysPackage) Query(ctx context.Context, request *mcp.CallToolRequest, params QueryPackageParams) (*mcp.CallToolResult, any, error) {
+type QueryPackageResult struct {
+	Name   string         `json:"name"`
+	Mode   string         `json:"mode"`
+	Result map[string]any `json:"result"`
+}
+
+func (sysPkg SysPackage) Query(ctx context.Context, request *mcp.CallToolRequest, params QueryPackageParams) (*mcp.CallToolResult, QueryPackageResult, error) {
 	if params.Name == "" {
-		return nil, nil, fmt.Errorf("name for package to query is mandatory")
+		return nil, QueryPackageResult{}, fmt.Errorf("name for package to query is mandatory")
 	}
 	mode := getQueryModeFromString(params.Mode)
-	if mode == -1 {
-		return nil, nil, fmt.Errorf("invalid mode: %s valid modes: %v", params.Mode, ValidQueryModes())
-	}
-	result, err := sysPkg.QueryPackageSysCall(params.Name, mode, params.Lines)
-	if err != nil {
-		return nil, nil, err
+	if caps := sysPkg.Capabilities(); mode == -1 || !caps.SupportsQueryMode(params.Mode) {
+		return nil, QueryPackageResult{}, fmt.Errorf("invalid mode: %s valid modes: %v", params.Mode, caps.QueryModes)
 	}
-	jsonByte, err := json.Marshal(result)
+	result, err := sysPkg.QueryPackageSysCall(ctx, request, params.Name, mode, params.Lines)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error on query, couldn't marshal result: %v", err)
+		return nil, QueryPackageResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonByte),
-			},
-		},
-	}, nil, nil
+	return nil, QueryPackageResult{Name: params.Name, Mode: params.Mode, Result: result}, nil
 }
 
 type ListPackageParams struct {
 	Name        string   `json:"name,omitempty" jsonschema:"Name pattern of the packages to be listed. Using an empty string will result in a list of all packages installed on the system."`
-	Filelist    bool     `json:"file_list,omitempty" jsonschema: "List the of the files installed by this package"`
+	Filelist    bool     `json:"file_list,omitempty" jsonschema:"List the of the files installed by this package"`
 	Relations   []string `json:"relations,omitempty" jsonschema:"Relationship which should be displayed."`
 	Description bool     `json:"description,omitempty" jsonschema:"Display also the description of the package"`
 	Changelog   uint     `json:"changelog,0" jsonschema:"Show the given number of lines of the changelog."`
+	Sort        string   `json:"sort,omitempty" jsonschema:"Sort the packages by 'name', 'install_time' (newest first) or 'size' (largest first)."`
+}
+
+func ValidSortOrders() []string {
+	return []string{"name", "install_time", "size"}
+}
+
+// SortPackages sorts the list in place by the given order, see
+// ValidSortOrders. An empty or unknown order keeps the order of the backend.
+func SortPackages(list []SysPackageInfo, order string) {
+	switch order {
+	case "name":
+		slices.SortStableFunc(list, func(a, b SysPackageInfo) int {
+			return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Arch, b.Arch))
+		})
+	case "install_time":
+		slices.SortStableFunc(list, func(a, b SysPackageInfo) int {
+			return b.InstallTime.Compare(a.InstallTime)
+		})
+	case "size":
+		slices.SortStableFunc(list, func(a, b SysPackageInfo) int {
+			return cmp.Compare(b.Size, a.Size)
+		})
+	}
+}
+
+// Repository is the package manager independent description of a
+// configured repository. Fields the backend reports but which have no
+// counterpart here are kept in Extras.
+type Repository struct {
+	ID          string            `json:"id" jsonschema:"Identifier of the repository, which is the alias for zypper, the repo id for dnf and the name of the sources file for apt, followed by ':N' for the entries of files with several entries."`
+	Name        string            `json:"name"`
+	URLs        []string          `json:"urls,omitempty"`
+	Enabled     bool              `json:"enabled"`
+	GPGCheck    bool              `json:"gpgcheck"`
+	Priority    int               `json:"priority,omitempty"`
+	AutoRefresh bool              `json:"autorefresh"`
+	Type        string            `json:"type,omitempty"`
+	Keys        []string          `json:"keys,omitempty" jsonschema:"The GPG keys used to verify the repository."`
+	SourceFile  string            `json:"source_file,omitempty" jsonschema:"The file the repository is configured in."`
+	Suites      []string          `json:"suites,omitempty" jsonschema:"The suites of an apt repository."`
+	Components  []string          `json:"components,omitempty" jsonschema:"The components of an apt repository."`
+	Extras      map[string]string `json:"extras,omitempty" jsonschema:"Additional backend specific fields."`
 }
 
 type ListReposParam struct {
 	Name string `json:"name,omitempty" jsonschema:"Name of the repository to list. When omitted all repos are listed."`
 }
 
-func (sysPkg SysPackage) ListRepo(ctx context.Context, request *mcp.CallToolRequest, params ListReposParam) (*mcp.CallToolResult, any, error) {
-	result, err := sysPkg.ListReposSysCall(params.Name)
-	if err != nil {
-		return nil, nil, err
-	}
-	jsonByte, err := json.Marshal(result)
+type ListReposResult struct {
+	Repos []Repository `json:"repos"`
+}
+
+func (sysPkg SysPackage) ListRepo(ctx context.Context, request *mcp.CallToolRequest, params ListReposParam) (*mcp.CallToolResult, ListReposResult, error) {
+	result, err := sysPkg.ListReposSysCall(ctx, request, params.Name)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error on query, couldn't marshal result: %v", err)
+		return nil, ListReposResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonByte),
-			},
-		},
-	}, nil, nil
+	return nil, ListReposResult{Repos: result}, nil
 }
 
 type ModifyRepoParams struct {
@@ -182,82 +281,96 @@ type RefreshReposParams struct {
 	Name string `json:"name,omitempty" jsonschema:"Name of the repository to refresh. When omitted all repos are refreshed."`
 }
 
-func (sysPkg SysPackage) ModifyRepo(ctx context.Context, request *mcp.CallToolRequest, params ModifyRepoParams) (*mcp.CallToolResult, any, error) {
-	result, err := sysPkg.ModifyRepoSysCall(params)
-	if err != nil {
-		return nil, nil, err
+type ModifyRepoResult struct {
+	Repo    *Repository `json:"repo,omitempty" jsonschema:"The repository after the modification."`
+	Removed bool        `json:"removed,omitempty"`
+}
+
+func (sysPkg SysPackage) ModifyRepo(ctx context.Context, request *mcp.CallToolRequest, params ModifyRepoParams) (*mcp.CallToolResult, ModifyRepoResult, error) {
+	if err := sysPkg.checkModifyRepo(params); err != nil {
+		return nil, ModifyRepoResult{}, err
 	}
-	jsonByte, err := json.Marshal(result)
+	result, err := sysPkg.ModifyRepoSysCall(ctx, request, params)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error on query, couldn't marshal result: %v", err)
+		return nil, ModifyRepoResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonByte),
-			},
-		},
-	}, nil, nil
+	if sysPkg.ReposChanged != nil {
+		sysPkg.ReposChanged()
+	}
+	return nil, ModifyRepoResult{Repo: result, Removed: params.RemoveRepos}, nil
+}
+
+type RefreshReposResult struct {
+	Message string `json:"message"`
 }
 
-func (sysPkg SysPackage) RefreshRepos(ctx context.Context, request *mcp.CallToolRequest, params RefreshReposParams) (*mcp.CallToolResult, any, error) {
-	err := sysPkg.RefreshReposSysCall(params.Name)
+func (sysPkg SysPackage) RefreshRepos(ctx context.Context, request *mcp.CallToolRequest, params RefreshReposParams) (*mcp.CallToolResult, RefreshReposResult, error) {
+	err := sysPkg.RefreshReposSysCall(ctx, request, params.Name)
 	if err != nil {
-		return nil, nil, err
+		return nil, RefreshReposResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: "Repositories refreshed successfully.",
-			},
-		},
-	}, nil, nil
+	return nil, RefreshReposResult{Message: "Repositories refreshed successfully."}, nil
 }
 
 type ListPatchesParams struct {
-	Category string `json:"category,omitempty" jsonschema:"Category of the patches to be listed."`
-	Severity string `json:"severity,omitempty" jsonschema:"Severity of the patches to be listed."`
+	Category string `json:"category,omitempty" jsonschema:"Category of the patches to be listed, like security, recommended, feature or optional."`
+	Severity string `json:"severity,omitempty" jsonschema:"Severity of the patches to be listed, like critical, important, moderate or low."`
 }
 
-func (sysPkg SysPackage) ListPatches(ctx context.Context, request *mcp.CallToolRequest, params ListPatchesParams) (*mcp.CallToolResult, any, error) {
-	result, err := sysPkg.ListPatchesSysCall(params)
-	if err != nil {
-		return nil, nil, err
-	}
-	jsonByte, err := json.Marshal(result)
+type ListPatchesResult struct {
+	Patches []map[string]any `json:"patches"`
+}
+
+func (sysPkg SysPackage) ListPatches(ctx context.Context, request *mcp.CallToolRequest, params ListPatchesParams) (*mcp.CallToolResult, ListPatchesResult, error) {
+	result, err := sysPkg.ListPatchesSysCall(ctx, request, params)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error on query, couldn't marshal result: %v", err)
+		return nil, ListPatchesResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonByte),
-			},
-		},
-	}, nil, nil
+	return nil, ListPatchesResult{Patches: result}, nil
 }
 
 type InstallPatchesParams struct {
-	Category string `json:"category,omitempty" jsonschema:"Category of the patches to be installed."`
-	Severity string `json:"severity,omitempty" jsonschema:"Severity of the patches to be installed."`
+	Category     string `json:"category,omitempty" jsonschema:"Category of the patches to be installed, like security, recommended, feature or optional."`
+	Severity     string `json:"severity,omitempty" jsonschema:"Severity of the patches to be installed, like critical, important, moderate or low."`
+	ShowDetails  bool   `json:"show_details,omitempty" jsonschema:"Show which packages the patches would upgrade, install or remove. Doesn't install any patch."`
+	Background   bool   `json:"background,omitempty" jsonschema:"Run the installation as background job and return the job right away. Use job_status and job_output to follow it."`
+	ConfirmToken string `json:"confirm_token,omitempty" jsonschema:"The token returned with the plan of the transaction, if the server requires a confirmation."`
 }
 
-func (sysPkg SysPackage) InstallPatches(ctx context.Context, request *mcp.CallToolRequest, params InstallPatchesParams) (*mcp.CallToolResult, any, error) {
-	result, err := sysPkg.InstallPatchesSysCall(params)
-	if err != nil {
-		return nil, nil, err
+type InstallPatchesResult struct {
+	Patches      []map[string]any      `json:"patches"`
+	Changes      *UpdateResult         `json:"changes,omitempty" jsonschema:"The packages the patches change, set for show_details."`
+	Job          *jobs.Job             `json:"job,omitempty" jsonschema:"The job running the installation in the background."`
+	Confirmation *confirm.Confirmation `json:"confirmation,omitempty" jsonschema:"Set if the patches are only the plan of the installation, which has to be confirmed."`
+}
+
+func (sysPkg SysPackage) InstallPatches(ctx context.Context, request *mcp.CallToolRequest, params InstallPatchesParams) (*mcp.CallToolResult, InstallPatchesResult, error) {
+	if err := sysPkg.checkPatches(ctx, request, params); err != nil {
+		return nil, InstallPatchesResult{}, err
 	}
-	jsonByte, err := json.Marshal(result)
+	if sysPkg.Confirm != nil && !params.ShowDetails {
+		if params.ConfirmToken == "" {
+			result, err := sysPkg.planPatches(ctx, request, params)
+			return nil, result, err
+		}
+		if err := sysPkg.confirmPatches(ctx, request, params); err != nil {
+			return nil, InstallPatchesResult{}, err
+		}
+	}
+	if params.Background {
+		job, err := sysPkg.startJob(request, "install_patches", params, func(ctx context.Context) (any, error) {
+			return sysPkg.InstallPatchesSysCall(ctx, nil, params)
+		})
+		return nil, InstallPatchesResult{Patches: []map[string]any{}, Job: job}, err
+	}
+	result, err := sysPkg.InstallPatchesSysCall(ctx, request, params)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error on query, couldn't marshal result: %v", err)
+		return nil, InstallPatchesResult{}, err
+	}
+	if result.Patches == nil {
+		result.Patches = []map[string]any{}
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonByte),
-			},
-		},
-	}, nil, nil
+	return nil, result, nil
 }
 
 type SearchPackageParams struct {
@@ -266,40 +379,50 @@ type SearchPackageParams struct {
 	Exact bool     `json:"exact,omitempty" jsonschema:"Match the package name exactly, if not set substrings will also be matched."`
 }
 
-func (sysPkg SysPackage) CreateSearchPackageSchema() (*jsonschema.Schema, error) {
-	inputSchema, err := jsonschema.For[SearchPackageParams](nil)
-	if err != nil {
-		return nil, err
-	}
-	repos, err := sysPkg.ListReposSysCall("")
+// RepoIDs returns the identifiers of all configured repositories, which are
+// used as enum values in the input schemas. Errors are swallowed as the
+// schemas are still usable without the enum.
+func (sysPkg SysPackage) RepoIDs() []string {
+	repos, err := sysPkg.ListReposSysCall(context.Background(), nil, "")
 	if err != nil || len(repos) == 0 {
-		return inputSchema, nil
+		return nil
 	}
 
-	var validList []any
+	var ids []string
 	for _, repo := range repos {
-		var id string
-		if v, ok := repo["alias"].(string); ok {
-			id = v
-		} else if v, ok := repo["Repo-id"].(string); ok {
-			id = v
-		} else if v, ok := repo["id"].(string); ok {
-			id = v
-		}
-		if id != "" {
-			validList = append(validList, id)
+		if repo.ID != "" {
+			ids = append(ids, repo.ID)
 		}
 	}
+	return ids
+}
 
-	if len(validList) > 0 {
-		if inputSchema.Properties["repos"] != nil {
-			if inputSchema.Properties["repos"].Items == nil {
-				inputSchema.Properties["repos"].Items = &jsonschema.Schema{Type: "string"}
-			}
-			inputSchema.Properties["repos"].Items.Enum = validList
-		}
+// setRepoListEnum restricts the items of the array property prop to the given
+// repositories.
+func setRepoListEnum(inputSchema *jsonschema.Schema, prop string, validList []any) {
+	if len(validList) == 0 || inputSchema.Properties[prop] == nil {
+		return
+	}
+	if inputSchema.Properties[prop].Items == nil {
+		inputSchema.Properties[prop].Items = &jsonschema.Schema{Type: "string"}
+	}
+	inputSchema.Properties[prop].Items.Enum = validList
+}
+
+// setRepoEnum restricts the string property prop to the given repositories.
+func setRepoEnum(inputSchema *jsonschema.Schema, prop string, validList []any) {
+	if len(validList) == 0 || inputSchema.Properties[prop] == nil {
+		return
 	}
+	inputSchema.Properties[prop].Enum = validList
+}
 
+func (sysPkg SysPackage) CreateSearchPackageSchema() (*jsonschema.Schema, error) {
+	inputSchema, err := jsonschema.For[SearchPackageParams](nil)
+	if err != nil {
+		return nil, err
+	}
+	setRepoListEnum(inputSchema, "repos", toEnum(sysPkg.RepoIDs()))
 	return inputSchema, nil
 }
 
@@ -308,32 +431,28 @@ func (sysPkg SysPackage) CreateInstallPackageSchema() (*jsonschema.Schema, error
 	if err != nil {
 		return nil, err
 	}
-	repos, err := sysPkg.ListReposSysCall("")
-	if err != nil || len(repos) == 0 {
-		return inputSchema, nil
+	setRepoEnum(inputSchema, "repo", toEnum(sysPkg.RepoIDs()))
+	if !sysPkg.Capabilities().Solutions {
+		delete(inputSchema.Properties, "solutions")
 	}
+	return inputSchema, nil
+}
 
-	var validList []any
-	for _, repo := range repos {
-		var id string
-		if v, ok := repo["alias"].(string); ok {
-			id = v
-		} else if v, ok := repo["Repo-id"].(string); ok {
-			id = v
-		} else if v, ok := repo["id"].(string); ok {
-			id = v
-		}
-		if id != "" {
-			validList = append(validList, id)
-		}
+func (sysPkg SysPackage) CreateUpdatePackageSchema() (*jsonschema.Schema, error) {
+	inputSchema, err := jsonschema.For[UpdatePackageParams](nil)
+	if err != nil {
+		return nil, err
 	}
+	setRepoListEnum(inputSchema, "repos", toEnum(sysPkg.RepoIDs()))
+	return inputSchema, nil
+}
 
-	if len(validList) > 0 {
-		if inputSchema.Properties["repo"] != nil {
-			inputSchema.Properties["repo"].Enum = validList
-		}
+func (sysPkg SysPackage) CreateRefreshReposSchema() (*jsonschema.Schema, error) {
+	inputSchema, err := jsonschema.For[RefreshReposParams](nil)
+	if err != nil {
+		return nil, err
 	}
-
+	setRepoEnum(inputSchema, "name", toEnum(sysPkg.RepoIDs()))
 	return inputSchema, nil
 }
 
@@ -342,7 +461,7 @@ func (sysPkg SysPackage) CreateListPackageSchema() (*jsonschema.Schema, error) {
 	if err != nil {
 		return nil, err
 	}
-	validList := []any{"requires", "recommends", "suggests", "supplements", "enhances", "provides", "conflicts", "obsoletes"}
+	validList := toEnum(sysPkg.Capabilities().Relations)
 
 	if inputSchema.Properties["relations"] != nil {
 		if inputSchema.Properties["relations"].Items == nil {
@@ -350,26 +469,25 @@ func (sysPkg SysPackage) CreateListPackageSchema() (*jsonschema.Schema, error) {
 		}
 		inputSchema.Properties["relations"].Items.Enum = validList
 	}
+	if inputSchema.Properties["sort"] != nil {
+		for _, order := range ValidSortOrders() {
+			inputSchema.Properties["sort"].Enum = append(inputSchema.Properties["sort"].Enum, order)
+		}
+	}
 
 	return inputSchema, nil
 }
 
-func (sysPkg SysPackage) SearchPackage(ctx context.Context, request *mcp.CallToolRequest, params SearchPackageParams) (*mcp.CallToolResult, any, error) {
-	result, err := sysPkg.SysPackageInterface.SearchPackageSysCall(params)
-	if err != nil {
-		return nil, nil, err
-	}
-	jsonByte, err := json.Marshal(result)
+type SearchPackageResult struct {
+	Repos SearchResult `json:"repos" jsonschema:"The found packages grouped by repository and architecture."`
+}
+
+func (sysPkg SysPackage) SearchPackage(ctx context.Context, request *mcp.CallToolRequest, params SearchPackageParams) (*mcp.CallToolResult, SearchPackageResult, error) {
+	result, err := sysPkg.SysPackageInterface.SearchPackageSysCall(ctx, request, params)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error on query, couldn't marshal result: %v", err)
+		return nil, SearchPackageResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonByte),
-			},
-		},
-	}, nil, nil
+	return nil, SearchPackageResult{Repos: result}, nil
 }
 
 type InstallPackageParams struct {
@@ -378,73 +496,324 @@ type InstallPackageParams struct {
 	FromRepo     string `json:"repo,omitempty" jsonschema:"Repository to install from."`
 	NoRecommends bool   `json:"no_recommends,omitempty" jsonschema:"Do not install recommended packages."`
 	ShowDetails  bool   `json:"show_details,omitempty" jsonschema:"Show which additional packages would be installed, which gives an overview of how much space will consumed. Doesn't install the package."`
+	Background   bool   `json:"background,omitempty" jsonschema:"Run the installation as background job and return the job right away. Use job_status and job_output to follow it."`
+	ConfirmToken string `json:"confirm_token,omitempty" jsonschema:"The token returned with the plan of the transaction, if the server requires a confirmation."`
+	Solutions    []int  `json:"solutions,omitempty" jsonschema:"The ids of the solutions to apply to the dependency problems returned by a failed installation, one for every problem in the order of the problems."`
+}
+
+// InstallPackage installs a package. If the dependencies can't be solved,
+// the problems are returned as error result along with their solutions, so
+// that the installation can be called again with the chosen ones.
+func (sysPkg SysPackage) InstallPackage(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) (*mcp.CallToolResult, InstallResult, error) {
+	res, result, err := sysPkg.installPackage(ctx, request, params)
+	var problemsErr *SolverProblemsError
+	if !errors.As(err, &problemsErr) {
+		return res, result, err
+	}
+	res = &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{
+		Text: fmt.Sprintf("%s; call install_package again with the id of the chosen solution of every problem in solutions", problemsErr),
+	}}}
+	return res, InstallResult{
+		Installed:    []PackageInfo{},
+		Dependencies: []PackageInfo{},
+		Recommended:  []PackageInfo{},
+		RawOutput:    problemsErr.Output,
+		Problems:     problemsErr.Problems,
+	}, nil
 }
 
-func (sysPkg SysPackage) InstallPackage(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) (*mcp.CallToolResult, any, error) {
-	output, err := sysPkg.SysPackageInterface.InstallPackageSysCall(ctx, request, params)
+func (sysPkg SysPackage) installPackage(ctx context.Context, request *mcp.CallToolRequest, params InstallPackageParams) (*mcp.CallToolResult, InstallResult, error) {
+	if len(params.Solutions) > 0 && !sysPkg.Capabilities().Solutions {
+		return nil, InstallResult{}, fmt.Errorf("solutions aren't supported by %s", sysPkg.PkgType())
+	}
+	if err := sysPkg.checkInstall(ctx, request, params); err != nil {
+		return nil, InstallResult{}, err
+	}
+	if sysPkg.Confirm != nil && !params.ShowDetails {
+		if params.ConfirmToken == "" {
+			result, err := sysPkg.planInstall(ctx, request, params)
+			return nil, result, err
+		}
+		if err := sysPkg.confirmInstall(ctx, request, params); err != nil {
+			return nil, InstallResult{}, err
+		}
+	}
+	if params.Background {
+		job, err := sysPkg.startJob(request, "install_package", params, func(ctx context.Context) (any, error) {
+			return sysPkg.SysPackageInterface.InstallPackageSysCall(ctx, nil, params)
+		})
+		return nil, InstallResult{Installed: []PackageInfo{}, Dependencies: []PackageInfo{}, Recommended: []PackageInfo{}, Job: job}, err
+	}
+	result, err := sysPkg.SysPackageInterface.InstallPackageSysCall(ctx, request, params)
 	if err != nil {
-		return nil, nil, err
+		return nil, InstallResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: output,
-			},
-		},
-	}, nil, nil
+	return nil, result, nil
 }
 
 type RemovePackageParams struct {
-	Name        string `json:"name" jsonschema:"Name of the package to remove."`
-	Purge       bool   `json:"purge,omitempty" jsonschema:"Delete configuration files, etc."`
-	RemoveDeps  bool   `json:"removedeps,omitempty" jsonschema:"Automatically remove unneeded dependencies."`
-	ShowDetails bool   `json:"show_details,omitempty" jsonschema:"Show which additional packages would be removed."`
+	Name         string `json:"name" jsonschema:"Name of the package to remove."`
+	Purge        bool   `json:"purge,omitempty" jsonschema:"Delete configuration files, etc."`
+	RemoveDeps   bool   `json:"removedeps,omitempty" jsonschema:"Automatically remove unneeded dependencies."`
+	ShowDetails  bool   `json:"show_details,omitempty" jsonschema:"Show which additional packages would be removed."`
+	ConfirmToken string `json:"confirm_token,omitempty" jsonschema:"The token returned with the plan of the transaction, if the server requires a confirmation."`
+}
+
+type RemovePackageResult struct {
+	Removed      []PackageInfo         `json:"removed" jsonschema:"The packages removed, or which would be removed with show_details."`
+	RawOutput    string                `json:"raw_output"`
+	Confirmation *confirm.Confirmation `json:"confirmation,omitempty" jsonschema:"Set if the result is only the plan of the removal, which has to be confirmed."`
 }
 
-func (sysPkg SysPackage) RemovePackage(ctx context.Context, request *mcp.CallToolRequest, params RemovePackageParams) (*mcp.CallToolResult, any, error) {
-	output, err := sysPkg.SysPackageInterface.RemovePackageSysCall(params)
+func (sysPkg SysPackage) RemovePackage(ctx context.Context, request *mcp.CallToolRequest, params RemovePackageParams) (*mcp.CallToolResult, RemovePackageResult, error) {
+	if err := sysPkg.checkRemove(ctx, request, params); err != nil {
+		return nil, RemovePackageResult{}, err
+	}
+	if sysPkg.Confirm != nil && !params.ShowDetails {
+		if params.ConfirmToken == "" {
+			result, err := sysPkg.planRemove(ctx, request, params)
+			return nil, result, err
+		}
+		if err := sysPkg.confirmRemove(ctx, request, params); err != nil {
+			return nil, RemovePackageResult{}, err
+		}
+	}
+	output, err := sysPkg.SysPackageInterface.RemovePackageSysCall(ctx, request, params)
 	if err != nil {
-		return nil, nil, err
+		return nil, RemovePackageResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: output,
-			},
-		},
-	}, nil, nil
+	removed := ParseRemovedPackages(output)
+	if removed == nil {
+		removed = []PackageInfo{}
+	}
+	return nil, RemovePackageResult{Removed: removed, RawOutput: output}, nil
 }
 
 type UpdatePackageParams struct {
-	Name    string   `json:"name,omitempty" jsonschema:"Name of the package to update. If omitted, all packages are updated."`
-	Repos   []string `json:"repos,omitempty" jsonschema:"A list of repositories to update from."`
-	Upgrade bool     `json:"upgrade,omitempty" jsonschema:"On 'zypper', this will perform a 'dup' instead of an 'up'. This has no effect on 'dnf' as it performs an 'upgrade' by default."`
+	Name         string   `json:"name,omitempty" jsonschema:"Name of the package to update. If omitted, all packages are updated."`
+	Repos        []string `json:"repos,omitempty" jsonschema:"A list of repositories to update from."`
+	Upgrade      bool     `json:"upgrade,omitempty" jsonschema:"On 'zypper', this will perform a 'dup' instead of an 'up' and on 'apt' a 'dist-upgrade' instead of an 'upgrade'. This has no effect on 'dnf' as it performs an 'upgrade' by default."`
+	ShowDetails  bool     `json:"show_details,omitempty" jsonschema:"Show which packages would be upgraded, downgraded, installed or removed. Doesn't update any package."`
+	Background   bool     `json:"background,omitempty" jsonschema:"Run the update as background job and return the job right away. Use job_status and job_output to follow it."`
+	ConfirmToken string   `json:"confirm_token,omitempty" jsonschema:"The token returned with the plan of the transaction, if the server requires a confirmation."`
 }
 
-func (sysPkg SysPackage) UpdatePackage(ctx context.Context, request *mcp.CallToolRequest, params UpdatePackageParams) (*mcp.CallToolResult, any, error) {
-	output, err := sysPkg.SysPackageInterface.UpdatePackageSysCall(params)
+func (sysPkg SysPackage) UpdatePackage(ctx context.Context, request *mcp.CallToolRequest, params UpdatePackageParams) (*mcp.CallToolResult, UpdateResult, error) {
+	if err := sysPkg.checkUpdate(ctx, request, params); err != nil {
+		return nil, UpdateResult{}, err
+	}
+	if sysPkg.Confirm != nil && !params.ShowDetails {
+		if params.ConfirmToken == "" {
+			result, err := sysPkg.planUpdate(ctx, request, params)
+			return nil, result, err
+		}
+		if err := sysPkg.confirmUpdate(ctx, request, params); err != nil {
+			return nil, UpdateResult{}, err
+		}
+	}
+	if params.Background {
+		job, err := sysPkg.startJob(request, "update_package", params, func(ctx context.Context) (any, error) {
+			return sysPkg.SysPackageInterface.UpdatePackageSysCall(ctx, nil, params)
+		})
+		result := newUpdateResult("")
+		result.Job = job
+		return nil, result, err
+	}
+	result, err := sysPkg.SysPackageInterface.UpdatePackageSysCall(ctx, request, params)
 	if err != nil {
-		return nil, nil, err
+		return nil, UpdateResult{}, err
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: output,
-			},
-		},
-	}, nil, nil
+	return nil, result, nil
 }
 
 type PackageInfo struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	OldVersion string `json:"old_version,omitempty"`
+	Arch       string `json:"arch,omitempty"`
 }
 
 type InstallResult struct {
-	Installed    []PackageInfo `json:"installed"`
-	Dependencies []PackageInfo `json:"dependencies"`
-	Recommended  []PackageInfo `json:"recommended"`
-	RawOutput    string        `json:"raw_output"`
+	Installed    []PackageInfo         `json:"installed"`
+	Dependencies []PackageInfo         `json:"dependencies"`
+	Recommended  []PackageInfo         `json:"recommended"`
+	RawOutput    string                `json:"raw_output"`
+	Job          *jobs.Job             `json:"job,omitempty" jsonschema:"The job running the installation in the background."`
+	Confirmation *confirm.Confirmation `json:"confirmation,omitempty" jsonschema:"Set if the result is only the plan of the installation, which has to be confirmed."`
+	Problems     []SolverProblem       `json:"problems,omitempty" jsonschema:"The dependency problems the installation failed on, choose one solution of every problem and pass their ids in solutions."`
+}
+
+// UpdateResult describes the package changes of an update transaction.
+type UpdateResult struct {
+	Upgraded     []PackageInfo         `json:"upgraded"`
+	Downgraded   []PackageInfo         `json:"downgraded"`
+	New          []PackageInfo         `json:"new"`
+	Removed      []PackageInfo         `json:"removed"`
+	RawOutput    string                `json:"raw_output"`
+	Job          *jobs.Job             `json:"job,omitempty" jsonschema:"The job running the update in the background."`
+	Confirmation *confirm.Confirmation `json:"confirmation,omitempty" jsonschema:"Set if the result is only the plan of the update, which has to be confirmed."`
+}
+
+func newUpdateResult(output string) UpdateResult {
+	return UpdateResult{
+		Upgraded:   []PackageInfo{},
+		Downgraded: []PackageInfo{},
+		New:        []PackageInfo{},
+		Removed:    []PackageInfo{},
+		RawOutput:  output,
+	}
+}
+
+func (res *UpdateResult) add(section string, pkg PackageInfo) {
+	switch section {
+	case "upgrade":
+		res.Upgraded = append(res.Upgraded, pkg)
+	case "downgrade":
+		res.Downgraded = append(res.Downgraded, pkg)
+	case "new":
+		res.New = append(res.New, pkg)
+	case "remove":
+		res.Removed = append(res.Removed, pkg)
+	}
+}
+
+func (res *UpdateResult) last(section string) *PackageInfo {
+	var lst []PackageInfo
+	switch section {
+	case "upgrade":
+		lst = res.Upgraded
+	case "downgrade":
+		lst = res.Downgraded
+	case "new":
+		lst = res.New
+	case "remove":
+		lst = res.Removed
+	}
+	if len(lst) == 0 {
+		return nil
+	}
+	return &lst[len(lst)-1]
+}
+
+// ParseZypperUpdateOutput parses the summary of 'zypper update --details' or
+// 'zypper dup --details'. Upgrades and downgrades are printed as
+// 'name old -> new arch repo vendor', all other packages as
+// 'name version arch repo vendor'. Lines without a version, as printed without
+// --details, contain several package names.
+func ParseZypperUpdateOutput(output string) UpdateResult {
+	res := newUpdateResult(output)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	currentSection := ""
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.Contains(line, "going to be upgraded:"):
+			currentSection = "upgrade"
+			continue
+		case strings.Contains(line, "going to be downgraded:"):
+			currentSection = "downgrade"
+			continue
+		case strings.Contains(line, "NEW package") && strings.Contains(line, "going to be installed:"):
+			currentSection = "new"
+			continue
+		case strings.Contains(line, "going to be REMOVED:"):
+			currentSection = "remove"
+			continue
+		case !strings.HasPrefix(line, " "):
+			currentSection = ""
+			continue
+		}
+		if currentSection == "" || trimmed == "" {
+			continue
+		}
+
+		fields := strings.Fields(strings.ReplaceAll(trimmed, "|", " "))
+		switch {
+		case len(fields) >= 4 && fields[2] == "->":
+			pkg := PackageInfo{Name: fields[0], OldVersion: fields[1], Version: fields[3]}
+			if len(fields) >= 5 {
+				pkg.Arch = fields[4]
+			}
+			res.add(currentSection, pkg)
+		case len(fields) >= 2 && isVersion(fields[1]):
+			pkg := PackageInfo{Name: fields[0], Version: fields[1]}
+			if len(fields) >= 3 {
+				pkg.Arch = fields[2]
+			}
+			res.add(currentSection, pkg)
+		default:
+			for _, name := range fields {
+				res.add(currentSection, PackageInfo{Name: name})
+			}
+		}
+	}
+	return res
+}
+
+// ParseDnfUpdateOutput parses the transaction table of 'dnf upgrade'. The
+// 'replacing' lines of dnf5 are used to fill in the old version of the
+// preceding package.
+func ParseDnfUpdateOutput(output string) UpdateResult {
+	res := newUpdateResult(output)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	currentSection := ""
+	var last *PackageInfo
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		trimmedLower := strings.ToLower(trimmed)
+
+		switch {
+		case trimmedLower == "upgrading:":
+			currentSection = "upgrade"
+			continue
+		case trimmedLower == "downgrading:":
+			currentSection = "downgrade"
+			continue
+		case strings.HasPrefix(trimmedLower, "installing") && strings.HasSuffix(trimmedLower, ":"):
+			currentSection = "new"
+			continue
+		case strings.HasPrefix(trimmedLower, "removing") && strings.HasSuffix(trimmedLower, ":"):
+			currentSection = "remove"
+			continue
+		case strings.HasPrefix(trimmedLower, "transaction summary") || strings.HasPrefix(trimmedLower, "===="):
+			currentSection = ""
+			continue
+		case strings.HasSuffix(trimmedLower, ":") && !strings.HasPrefix(line, " "):
+			// sections we don't report, like "Reinstalling:"
+			currentSection = ""
+			continue
+		}
+		if currentSection == "" || !strings.HasPrefix(line, " ") || trimmed == "" {
+			continue
+		}
+
+		fields := strings.Fields(trimmed)
+		if fields[0] == "replacing" {
+			if last != nil && len(fields) >= 4 {
+				last.OldVersion = fields[3]
+			}
+			continue
+		}
+		if len(fields) < 3 {
+			continue
+		}
+		res.add(currentSection, PackageInfo{Name: fields[0], Arch: fields[1], Version: fields[2]})
+		last = res.last(currentSection)
+	}
+	return res
+}
+
+// isVersion reports whether s looks like a package version, which always
+// starts with a digit, optionally prefixed by an epoch.
+func isVersion(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
 }
 
 func ParseZypperInstallOutput(output string, requestedPkg string) InstallResult {
@@ -567,3 +936,95 @@ func ParseDnfInstallOutput(output string, requestedPkg string) InstallResult {
 	}
 	return res
 }
+
+// ParseAptUpdateOutput parses the package lists apt-get prints before a
+// transaction. With -V every package is printed on its own line as
+// 'name (version)' or 'name (old => new)', without it several names are
+// printed per line.
+func ParseAptUpdateOutput(output string) UpdateResult {
+	res := newUpdateResult(output)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	currentSection := ""
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "The following NEW packages will be installed"):
+			currentSection = "new"
+			continue
+		case strings.HasPrefix(line, "The following packages will be upgraded"):
+			currentSection = "upgrade"
+			continue
+		case strings.HasPrefix(line, "The following packages will be DOWNGRADED"):
+			currentSection = "downgrade"
+			continue
+		case strings.HasPrefix(line, "The following packages will be REMOVED"):
+			currentSection = "remove"
+			continue
+		case !strings.HasPrefix(line, " "):
+			currentSection = ""
+			continue
+		}
+		if currentSection == "" || trimmed == "" {
+			continue
+		}
+
+		name, versions, found := strings.Cut(trimmed, " (")
+		if !found {
+			for _, name := range strings.Fields(trimmed) {
+				res.add(currentSection, aptPackageInfo(name))
+			}
+			continue
+		}
+		pkg := aptPackageInfo(name)
+		versions = strings.TrimSuffix(versions, ")")
+		if oldVersion, version, ok := strings.Cut(versions, " => "); ok {
+			pkg.OldVersion = oldVersion
+			pkg.Version = version
+		} else {
+			pkg.Version = versions
+		}
+		res.add(currentSection, pkg)
+	}
+	return res
+}
+
+// aptPackageInfo returns the package for a name as printed by apt, which
+// carries the architecture for foreign packages and a '*' for purged ones.
+func aptPackageInfo(name string) PackageInfo {
+	name = strings.TrimSuffix(name, "*")
+	if pkgName, arch, ok := strings.Cut(name, ":"); ok {
+		return PackageInfo{Name: pkgName, Arch: arch}
+	}
+	return PackageInfo{Name: name}
+}
+
+// ParseAptInstallOutput parses the output of 'apt-get install -V'. apt only
+// lists recommended packages which are not installed, so all packages
+// besides the requested one are reported as dependencies.
+func ParseAptInstallOutput(output string, requestedPkg string) InstallResult {
+	res := InstallResult{
+		Installed:    []PackageInfo{},
+		Dependencies: []PackageInfo{},
+		Recommended:  []PackageInfo{},
+		RawOutput:    output,
+	}
+
+	cleanRequestedPkg := requestedPkg
+	if idx := strings.Index(cleanRequestedPkg, "="); idx != -1 {
+		cleanRequestedPkg = cleanRequestedPkg[:idx]
+	}
+
+	update := ParseAptUpdateOutput(output)
+	for _, pkg := range append(update.New, update.Upgraded...) {
+		if strings.EqualFold(pkg.Name, cleanRequestedPkg) {
+			res.Installed = append(res.Installed, pkg)
+		} else {
+			res.Dependencies = append(res.Dependencies, pkg)
+		}
+	}
+	return res
+}
@@ -1,9 +1,16 @@
 package syspackage_test
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
+	"github.com/suse/managesw-mcp/internal/pkg/jobs"
 	"github.com/suse/managesw-mcp/internal/pkg/nopkgs"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 	"github.com/suse/managesw-mcp/internal/pkg/testenv"
@@ -24,11 +31,11 @@ type mockSysPackage struct {
 	nopkgs.NoPkg
 }
 
-func (m mockSysPackage) ListReposSysCall(name string) ([]map[string]any, error) {
-	return []map[string]any{
-		{"alias": "repo1", "name": "Repo 1"},
-		{"Repo-id": "repo2", "name": "Repo 2"},
-		{"id": "repo3", "name": "Repo 3"},
+func (m mockSysPackage) ListReposSysCall(ctx context.Context, request *mcp.CallToolRequest, name string) ([]syspackage.Repository, error) {
+	return []syspackage.Repository{
+		{ID: "repo1", Name: "Repo 1"},
+		{ID: "repo2", Name: "Repo 2"},
+		{ID: "repo3", Name: "Repo 3"},
 	}, nil
 }
 
@@ -78,3 +85,438 @@ func TestCreateInstallPackageSchema(t *testing.T) {
 	assert.Contains(t, schemaMock.Properties, "repo")
 	assert.Equal(t, []any{"repo1", "repo2", "repo3"}, schemaMock.Properties["repo"].Enum)
 }
+
+func TestCreateUpdateAndRefreshSchema(t *testing.T) {
+	sysPkgMock := syspackage.SysPackage{
+		SysPackageInterface: &mockSysPackage{},
+	}
+	updateSchema, err := sysPkgMock.CreateUpdatePackageSchema()
+	assert.NoError(t, err)
+	assert.Contains(t, updateSchema.Properties, "repos")
+	assert.NotNil(t, updateSchema.Properties["repos"].Items)
+	assert.Equal(t, []any{"repo1", "repo2", "repo3"}, updateSchema.Properties["repos"].Items.Enum)
+
+	refreshSchema, err := sysPkgMock.CreateRefreshReposSchema()
+	assert.NoError(t, err)
+	assert.Contains(t, refreshSchema.Properties, "name")
+	assert.Equal(t, []any{"repo1", "repo2", "repo3"}, refreshSchema.Properties["name"].Enum)
+
+	// NoPkg has no repos, so the schema is left untouched
+	sysPkgNoPkg := syspackage.SysPackage{
+		SysPackageInterface: &nopkgs.NoPkg{},
+	}
+	refreshSchema, err = sysPkgNoPkg.CreateRefreshReposSchema()
+	assert.NoError(t, err)
+	assert.Empty(t, refreshSchema.Properties["name"].Enum)
+}
+
+func TestParseZypperUpdateOutput(t *testing.T) {
+	output := `Loading repository data...
+Reading installed packages...
+
+The following 2 packages are going to be upgraded:
+  libzypp  17.31.0-1.1 -> 17.31.1-1.1  x86_64  repo-oss  openSUSE
+  zypper   1.14.58-1.1 -> 1.14.59-1.1  x86_64  repo-oss  openSUSE
+
+The following package is going to be downgraded:
+  foo  2.0-1 -> 1.9-1  noarch  repo-oss  openSUSE
+
+The following NEW package is going to be installed:
+  libnew1  1.0-1.1  x86_64  repo-oss  openSUSE
+
+The following package is going to be REMOVED:
+  oldpkg  0.9-1  noarch  @System  openSUSE
+
+4 packages to upgrade, 1 to downgrade, 1 new, 1 to remove.
+`
+	res := syspackage.ParseZypperUpdateOutput(output)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "libzypp", OldVersion: "17.31.0-1.1", Version: "17.31.1-1.1", Arch: "x86_64"},
+		{Name: "zypper", OldVersion: "1.14.58-1.1", Version: "1.14.59-1.1", Arch: "x86_64"},
+	}, res.Upgraded)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "foo", OldVersion: "2.0-1", Version: "1.9-1", Arch: "noarch"},
+	}, res.Downgraded)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "libnew1", Version: "1.0-1.1", Arch: "x86_64"},
+	}, res.New)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "oldpkg", Version: "0.9-1", Arch: "noarch"},
+	}, res.Removed)
+	assert.Equal(t, output, res.RawOutput)
+
+	// without --details only the names are printed
+	res = syspackage.ParseZypperUpdateOutput(`The following 3 packages are going to be upgraded:
+  bash glibc
+  zypper
+`)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "bash"}, {Name: "glibc"}, {Name: "zypper"}}, res.Upgraded)
+	assert.Empty(t, res.New)
+}
+
+func TestParseDnfUpdateOutput(t *testing.T) {
+	output := `Dependencies resolved.
+================================================================================
+ Package          Architecture   Version            Repository        Size
+================================================================================
+Upgrading:
+ bash             x86_64         5.2.26-3.fc40      updates          1.8 M
+   replacing      bash           x86_64             5.2.26-1.fc40    fedora  1.8 M
+Installing dependencies:
+ libfoo           x86_64         1.0-1.fc40         updates           50 k
+Removing:
+ old-pkg          noarch         1.0-1              @System           10 k
+Downgrading:
+ bar              noarch         0.9-1.fc40         fedora            10 k
+
+Transaction Summary
+================================================================================
+Upgrade  1 Package
+`
+	res := syspackage.ParseDnfUpdateOutput(output)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "bash", Arch: "x86_64", Version: "5.2.26-3.fc40", OldVersion: "5.2.26-1.fc40"},
+	}, res.Upgraded)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "libfoo", Arch: "x86_64", Version: "1.0-1.fc40"}}, res.New)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "old-pkg", Arch: "noarch", Version: "1.0-1"}}, res.Removed)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "bar", Arch: "noarch", Version: "0.9-1.fc40"}}, res.Downgraded)
+}
+
+func TestParseAptOutput(t *testing.T) {
+	output := `Reading package lists...
+Building dependency tree...
+The following additional packages will be installed:
+   libfoo1 (1.2-3)
+Suggested packages:
+   foo-doc
+The following packages will be REMOVED:
+   old-foo* (0.9-1)
+The following NEW packages will be installed:
+   foo (1.0-1)
+   libfoo1 (1.2-3)
+The following packages will be upgraded:
+   libc6 (2.36-9+deb12u3 => 2.36-9+deb12u4)
+   libc6:i386 (2.36-9+deb12u3 => 2.36-9+deb12u4)
+The following packages will be DOWNGRADED:
+   bar (2.0-1 => 1.0-1)
+2 upgraded, 2 newly installed, 1 downgraded, 1 to remove and 0 not upgraded.
+Setting up foo (1.0-1) ...
+`
+	res := syspackage.ParseAptUpdateOutput(output)
+	assert.Equal(t, []syspackage.PackageInfo{
+		{Name: "libc6", Version: "2.36-9+deb12u4", OldVersion: "2.36-9+deb12u3"},
+		{Name: "libc6", Arch: "i386", Version: "2.36-9+deb12u4", OldVersion: "2.36-9+deb12u3"},
+	}, res.Upgraded)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "foo", Version: "1.0-1"}, {Name: "libfoo1", Version: "1.2-3"}}, res.New)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "old-foo", Version: "0.9-1"}}, res.Removed)
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "bar", Version: "1.0-1", OldVersion: "2.0-1"}}, res.Downgraded)
+
+	install := syspackage.ParseAptInstallOutput(output, "foo=1.0-1")
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "foo", Version: "1.0-1"}}, install.Installed)
+	assert.Len(t, install.Dependencies, 3)
+	assert.Empty(t, install.Recommended)
+
+	// without -V several packages are printed per line
+	res = syspackage.ParseAptUpdateOutput("The following packages will be upgraded:\n  bash coreutils\n2 upgraded\n")
+	assert.Equal(t, []syspackage.PackageInfo{{Name: "bash"}, {Name: "coreutils"}}, res.Upgraded)
+}
+
+func TestStructuredOutput(t *testing.T) {
+	ctx := context.Background()
+	sysPkgMock := syspackage.SysPackage{
+		SysPackageInterface: &mockSysPackage{},
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "list_repos"}, sysPkgMock.ListRepo)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err := server.Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, tools.Tools, 1)
+	assert.NotNil(t, tools.Tools[0].OutputSchema, "Expected tool to declare an output schema")
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "list_repos"})
+	require.NoError(t, err)
+	assert.False(t, res.IsError)
+
+	// the structured content carries the typed result
+	var out syspackage.ListReposResult
+	raw, err := json.Marshal(res.StructuredContent)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &out))
+	require.Len(t, out.Repos, 3)
+	assert.Equal(t, "repo1", out.Repos[0].ID)
+
+	// older clients still get a text rendering of the result
+	require.Len(t, res.Content, 1)
+	text, ok := res.Content[0].(*mcp.TextContent)
+	require.True(t, ok)
+	assert.JSONEq(t, string(raw), text.Text)
+}
+
+func (m mockSysPackage) UpdatePackageSysCall(ctx context.Context, request *mcp.CallToolRequest, params syspackage.UpdatePackageParams) (syspackage.UpdateResult, error) {
+	return syspackage.UpdateResult{
+		Upgraded:  []syspackage.PackageInfo{{Name: params.Name, OldVersion: "9.0", Version: "9.1"}},
+		RawOutput: "updated " + params.Name,
+	}, nil
+}
+
+func TestBackgroundJob(t *testing.T) {
+	ctx := context.Background()
+	jobManager, err := jobs.NewManager(t.TempDir())
+	require.NoError(t, err)
+	sysPkgMock := syspackage.SysPackage{
+		SysPackageInterface: &mockSysPackage{},
+		Jobs:                jobManager,
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "update_package"}, sysPkgMock.UpdatePackage)
+	mcp.AddTool(server, &mcp.Tool{Name: "job_status"}, jobManager.Status)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "update_package",
+		Arguments: map[string]any{"name": "vim", "background": true},
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError, res.Content)
+	var started syspackage.UpdateResult
+	raw, err := json.Marshal(res.StructuredContent)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &started))
+	require.NotNil(t, started.Job)
+	assert.Equal(t, "update_package", started.Job.Tool)
+	assert.Empty(t, started.Upgraded)
+
+	jobManager.Wait()
+	res, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "job_status",
+		Arguments: map[string]any{"id": started.Job.ID},
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError, res.Content)
+	var job struct {
+		State  jobs.State              `json:"state"`
+		Result syspackage.UpdateResult `json:"result"`
+	}
+	raw, err = json.Marshal(res.StructuredContent)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &job))
+	assert.Equal(t, jobs.Succeeded, job.State)
+	assert.Equal(t, "updated vim", job.Result.RawOutput)
+
+	// without a job manager background jobs are refused
+	sysPkgMock.Jobs = nil
+	_, _, err = sysPkgMock.UpdatePackage(ctx, nil, syspackage.UpdatePackageParams{Name: "vim", Background: true})
+	assert.Error(t, err)
+}
+
+func TestCommandInterrupt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// the script only exits on SIGINT, a kill would lose the output
+	cmd := cmdrunner.New("/bin/sh", "-c", "trap 'echo interrupted; exit 130' INT; echo started; while :; do sleep 0.01; done")
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	out, err := syspackage.RunWithProgress(ctx, nil, cmdrunner.Exec{}, cmd)
+	assert.Error(t, err)
+	assert.Contains(t, out, "started")
+	assert.Contains(t, out, "interrupted")
+}
+
+func TestSortPackages(t *testing.T) {
+	now := time.Now()
+	list := []syspackage.SysPackageInfo{
+		{Name: "b", Arch: "x86_64", Size: 10, InstallTime: now.Add(-time.Hour)},
+		{Name: "a", Arch: "x86_64", Size: 30, InstallTime: now},
+		{Name: "b", Arch: "i686", Size: 20, InstallTime: now.Add(-2 * time.Hour)},
+	}
+	names := func() []string {
+		var ret []string
+		for _, pkg := range list {
+			ret = append(ret, pkg.NEVRA())
+		}
+		return ret
+	}
+	for i := range list {
+		list[i].Version = "1.0"
+		list[i].Release = "1"
+	}
+
+	syspackage.SortPackages(list, "name")
+	assert.Equal(t, []string{"a-1.0-1.x86_64", "b-1.0-1.i686", "b-1.0-1.x86_64"}, names())
+
+	syspackage.SortPackages(list, "install_time")
+	assert.Equal(t, []string{"a-1.0-1.x86_64", "b-1.0-1.x86_64", "b-1.0-1.i686"}, names())
+
+	syspackage.SortPackages(list, "size")
+	assert.Equal(t, []string{"a-1.0-1.x86_64", "b-1.0-1.i686", "b-1.0-1.x86_64"}, names())
+
+	list[0].Epoch = 2
+	assert.Equal(t, "a-2:1.0-1.x86_64", list[0].NEVRA())
+}
+
+func TestReadOSRelease(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	assert.Empty(t, syspackage.ReadOSRelease(env.GetPath("/")))
+
+	env.WriteFile("usr/lib/os-release", `# fallback
+NAME="openSUSE Leap"
+VERSION_ID='15.6'
+ID=opensuse-leap
+`)
+	assert.Equal(t, map[string]string{"NAME": "openSUSE Leap", "VERSION_ID": "15.6", "ID": "opensuse-leap"}, syspackage.ReadOSRelease(env.GetPath("/")))
+
+	env.WriteFile("etc/os-release", `PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+`)
+	assert.Equal(t, map[string]string{"PRETTY_NAME": "Debian GNU/Linux 12 (bookworm)"}, syspackage.ReadOSRelease(env.GetPath("/")))
+}
+
+func TestToolVersion(t *testing.T) {
+	ctx := context.Background()
+	replayer := cmdrunner.NewReplayer([]cmdrunner.Record{
+		{Name: "rpm", Args: []string{"--version"}, Output: "RPM version 4.20.0\n"},
+		{Name: "zypper", Args: []string{"--version"}, Output: "zypper 1.14.77\n"},
+		{Name: "dnf", Args: []string{"--version"}, Output: "", ExitCode: 1},
+	}, nil)
+	assert.Equal(t, "4.20.0", syspackage.ToolVersion(ctx, replayer, "/usr/bin/rpm"))
+	assert.Equal(t, "1.14.77", syspackage.ToolVersion(ctx, replayer, "zypper"))
+	assert.Equal(t, "", syspackage.ToolVersion(ctx, replayer, "dnf"))
+	assert.Equal(t, "", syspackage.ToolVersion(ctx, replayer, ""))
+}
+
+type limitedSysPackage struct {
+	nopkgs.NoPkg
+}
+
+func (m limitedSysPackage) Capabilities() syspackage.Capabilities {
+	caps := syspackage.AllCapabilities()
+	caps.Unsupported["list_patches"] = "no patches"
+	caps.QueryModes = []string{"info", "requires"}
+	caps.Relations = []string{"requires", "provides"}
+	caps.Solutions = false
+	return caps
+}
+
+func TestCapabilities(t *testing.T) {
+	ctx := context.Background()
+	sysPkg := syspackage.SysPackage{SysPackageInterface: limitedSysPackage{}}
+
+	caps := sysPkg.Capabilities()
+	ok, reason := caps.Supports("list_patches")
+	assert.False(t, ok)
+	assert.Equal(t, "no patches", reason)
+	ok, _ = caps.Supports("list_jobs")
+	assert.True(t, ok)
+	assert.NotContains(t, caps.Operations(), "list_patches")
+	assert.Contains(t, caps.Operations(), "install_patches")
+
+	querySchema, err := sysPkg.CreateQueryPackageSchema()
+	require.NoError(t, err)
+	assert.Equal(t, []any{"info", "requires"}, querySchema.Properties["mode"].Enum)
+	listSchema, err := sysPkg.CreateListPackageSchema()
+	require.NoError(t, err)
+	assert.Equal(t, []any{"requires", "provides"}, listSchema.Properties["relations"].Items.Enum)
+
+	_, _, err = sysPkg.Query(ctx, nil, syspackage.QueryPackageParams{Name: "bash", Mode: "obsoletes"})
+	assert.ErrorContains(t, err, "invalid mode: obsoletes")
+	_, _, err = sysPkg.List(ctx, nil, syspackage.ListPackageParams{Relations: []string{"conflicts"}})
+	assert.ErrorContains(t, err, "unsupported relation: conflicts")
+
+	installSchema, err := sysPkg.CreateInstallPackageSchema()
+	require.NoError(t, err)
+	assert.NotContains(t, installSchema.Properties, "solutions")
+	_, _, err = sysPkg.InstallPackage(ctx, nil, syspackage.InstallPackageParams{Name: "bash", Solutions: []int{1}})
+	assert.ErrorContains(t, err, "solutions aren't supported by nopkg")
+
+	_, info, err := sysPkg.SystemInfo(ctx, nil, syspackage.SystemInfoParams{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"list_patches": "no patches"}, info.Unsupported)
+	assert.NotContains(t, info.Operations, "list_patches")
+
+	_, info, err = syspackage.SysPackage{SysPackageInterface: nopkgs.NoPkg{}}.SystemInfo(ctx, nil, syspackage.SystemInfoParams{})
+	require.NoError(t, err)
+	assert.Equal(t, "none", info.Backend)
+	assert.Empty(t, info.Operations)
+	assert.Len(t, info.Unsupported, len(syspackage.Operations()))
+}
+
+func TestParseZypperPrompts(t *testing.T) {
+	output := `Resolving package dependencies...
+
+2 Problems:
+Problem: 1: nothing provides 'libfoo.so.1' needed by the to be installed foo-1.0-1.1.x86_64
+Problem: 2: the to be installed bar-2.0-1.1.x86_64 conflicts with 'baz' provided by the installed baz-1.0-1.1.x86_64
+
+Problem: 1: nothing provides 'libfoo.so.1' needed by the to be installed foo-1.0-1.1.x86_64
+ Solution 1: do not install foo-1.0-1.1.x86_64
+ Solution 2: break foo-1.0-1.1.x86_64 by ignoring some of its dependencies
+
+Choose from above solutions by number or cancel [1/2/c/d/?] (c): 1
+Resolving dependencies...
+
+Problem: 2: the to be installed bar-2.0-1.1.x86_64 conflicts with 'baz' provided by the installed baz-1.0-1.1.x86_64
+ Solution 1: Following actions will be done:
+  deinstallation of baz-1.0-1.1.x86_64
+  deinstallation of baz-data-1.0-1.1.noarch
+ Solution 2: do not install bar-2.0-1.1.x86_64
+
+Choose from above solutions by number or cancel [1/2/c/d/?] (c): c
+`
+	assert.Equal(t, []syspackage.SolverProblem{
+		{
+			ID:          1,
+			Description: "nothing provides 'libfoo.so.1' needed by the to be installed foo-1.0-1.1.x86_64",
+			Solutions: []syspackage.SolverSolution{
+				{ID: 1, Description: "do not install foo-1.0-1.1.x86_64"},
+				{ID: 2, Description: "break foo-1.0-1.1.x86_64 by ignoring some of its dependencies"},
+			},
+		},
+		{
+			ID:          2,
+			Description: "the to be installed bar-2.0-1.1.x86_64 conflicts with 'baz' provided by the installed baz-1.0-1.1.x86_64",
+			Solutions: []syspackage.SolverSolution{
+				{ID: 1, Description: "Following actions will be done:; deinstallation of baz-1.0-1.1.x86_64; deinstallation of baz-data-1.0-1.1.noarch"},
+				{ID: 2, Description: "do not install bar-2.0-1.1.x86_64"},
+			},
+		},
+	}, syspackage.ParseZypperProblems(output))
+	assert.Empty(t, syspackage.ParseZypperProblems("Nothing to do.\n"))
+
+	output = `The following 2 packages are going to be upgraded:
+  nginx vim
+
+The following 2 packages are going to change vendor:
+  nginx  openSUSE -> obs://build.opensuse.org/server:http
+  vim    openSUSE -> obs://build.opensuse.org/editors
+
+2 packages to upgrade.
+`
+	assert.Equal(t, []string{"nginx", "vim"}, syspackage.ParseZypperVendorChanges(output))
+	assert.Equal(t, []string{"nginx", "vim"}, syspackage.ParseZypperVendorChanges("The following 2 packages are going to change vendor:\n  nginx vim\n"))
+
+	output = `In order to install 'unrar-7.0.9-1.1.x86_64' (from repository 'repo-non-oss'), you must agree to terms of the following license agreement:
+
+UnRAR freeware license
+
+Do you agree with the terms of the license? [yes/no] (no): no
+Aborting installation due to the need for license confirmation.
+`
+	assert.Equal(t, []syspackage.License{{Package: "unrar-7.0.9-1.1.x86_64", Text: "UnRAR freeware license"}}, syspackage.ParseZypperLicenses(output))
+}
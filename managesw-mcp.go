@@ -4,18 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"text/tabwriter"
 
 	_ "embed"
 
 	"github.com/cheynewallace/tabby"
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/suse/managesw-mcp/internal/pkg/audit"
+	"github.com/suse/managesw-mcp/internal/pkg/cmdrunner"
+	"github.com/suse/managesw-mcp/internal/pkg/confirm"
+	"github.com/suse/managesw-mcp/internal/pkg/jobs"
 	"github.com/suse/managesw-mcp/internal/pkg/oscheck"
+	"github.com/suse/managesw-mcp/internal/pkg/policy"
+	"github.com/suse/managesw-mcp/internal/pkg/repowatch"
+	"github.com/suse/managesw-mcp/internal/pkg/risk"
 	"github.com/suse/managesw-mcp/internal/pkg/syspackage"
 )
 
@@ -27,12 +38,22 @@ func NewRootCmd() *cobra.Command {
 		Use:     "managesw-mcp",
 		Short:   "OS software management MCP server",
 		Version: strings.TrimSpace(version),
-		RunE: func(cmd *cobra.Command, args []string) error {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			viper.SetEnvPrefix("MANAGESW_MCP")
 			viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 			viper.AutomaticEnv()
-			viper.BindPFlags(cmd.Flags())
-
+			if err := viper.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			if config := viper.GetString("config"); config != "" {
+				viper.SetConfigFile(config)
+				if err := viper.ReadInConfig(); err != nil {
+					return fmt.Errorf("failed to read config: %w", err)
+				}
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
 			logLevel := slog.LevelInfo
 			if viper.GetBool("debug") {
 				logLevel = slog.LevelDebug
@@ -65,28 +86,52 @@ func NewRootCmd() *cobra.Command {
 				Version: strings.TrimSpace(version),
 			}, nil)
 
-			root := viper.GetString("root")
-			packageMgr := oscheck.NewPkg(root)
-			listSchema, err := packageMgr.CreateListPackageSchema()
+			packageMgr, err := newPackageManager()
 			if err != nil {
 				return err
 			}
-			querySchema, err := syspackage.GetQueryPackageParamsSchema()
+			listSchema, err := packageMgr.CreateListPackageSchema()
 			if err != nil {
 				return err
 			}
-			searchSchema, err := packageMgr.CreateSearchPackageSchema()
+			querySchema, err := packageMgr.CreateQueryPackageSchema()
 			if err != nil {
 				return err
 			}
-			installSchema, err := packageMgr.CreateInstallPackageSchema()
+			jobManager, err := jobs.NewManager(filepath.Join(stateDir(), "jobs"))
 			if err != nil {
 				return err
 			}
+			packageMgr.Jobs = jobManager
+			auditPath := viper.GetString("audit-log")
+			if auditPath == "" {
+				auditPath = filepath.Join(stateDir(), "audit.jsonl")
+			}
+			auditLog := audit.New(auditPath, viper.GetInt64("audit-max-size")*1024*1024, viper.GetInt("audit-keep"))
+			jobManager.OnFinish = auditLog.JobFinished
+			if viper.GetBool("confirm") {
+				packageMgr.Confirm = confirm.NewStore(viper.GetDuration("confirm-ttl"))
+			}
+			maxRisk := risk.SystemUpgrade
+			if viper.GetBool("read-only") {
+				maxRisk = risk.ReadOnly
+			} else if maxRisk, err = risk.Parse(viper.GetString("max-risk")); err != nil {
+				return err
+			}
+			destructive := true
+			var rebuildRepoSchemas func()
+			reposWatcher := repowatch.New(repowatch.DefaultDelay, func() { rebuildRepoSchemas() })
+			packageMgr.ReposChanged = reposWatcher.Changed
 
 			tools := []struct {
 				Tool     *mcp.Tool
 				Register func(server *mcp.Server, tool *mcp.Tool)
+				// Risk is the tier of the changes the tool can make, which
+				// also gives its annotations
+				Risk risk.Tier
+				// RepoSchema builds the input schema offering the
+				// repositories, again whenever they change
+				RepoSchema func() (*jsonschema.Schema, error)
 			}{
 				{
 					Tool: &mcp.Tool{
@@ -94,6 +139,7 @@ func NewRootCmd() *cobra.Command {
 						Description: "List the installed packages on the system.",
 						InputSchema: listSchema,
 					},
+					Risk: risk.ReadOnly,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.List)
 					},
@@ -104,6 +150,7 @@ func NewRootCmd() *cobra.Command {
 						Description: "Query information about a package which is installed on the system or available in the repository.",
 						InputSchema: querySchema,
 					},
+					Risk: risk.ReadOnly,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.Query)
 					},
@@ -113,6 +160,7 @@ func NewRootCmd() *cobra.Command {
 						Name:        "list_repos",
 						Description: "List the configured package repositories on the system, including details such as their names, URLs, and enabled status. This tool provides an overview of where packages are sourced from.",
 					},
+					Risk: risk.ReadOnly,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.ListRepo)
 					},
@@ -121,16 +169,31 @@ func NewRootCmd() *cobra.Command {
 					Tool: &mcp.Tool{
 						Name:        "modify_repo",
 						Description: "Modify a package repository on the system. This can be used to enable, disable, or change the properties of a repository. If the repository does not exist, it will be added. The function can also be used to remove a repository.",
+						// removing a repository is destructive
+						Annotations: &mcp.ToolAnnotations{DestructiveHint: &destructive, IdempotentHint: true},
 					},
+					Risk: risk.RepoMutating,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.ModifyRepo)
 					},
 				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "refresh_repos",
+						Description: "Refresh the metadata of the package repositories, so that the latest package versions become visible. When no name is given, all enabled repositories are refreshed.",
+					},
+					Risk: risk.RepoMutating,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, packageMgr.RefreshRepos)
+					},
+					RepoSchema: packageMgr.CreateRefreshReposSchema,
+				},
 				{
 					Tool: &mcp.Tool{
 						Name:        "list_patches",
 						Description: "List the available patches on the system, including details such as their names, categories, and severities. This tool provides an overview of the available patches that can be installed.",
 					},
+					Risk: risk.ReadOnly,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.ListPatches)
 					},
@@ -140,6 +203,7 @@ func NewRootCmd() *cobra.Command {
 						Name:        "install_patches",
 						Description: "Install patches on the system. This can be used to install all available patches or a subset of patches based on their category or severity.",
 					},
+					Risk: risk.SystemUpgrade,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.InstallPatches)
 					},
@@ -148,47 +212,158 @@ func NewRootCmd() *cobra.Command {
 					Tool: &mcp.Tool{
 						Name:        "search_package",
 						Description: "Search for a package in the enabled repositories. Wildcards are supported.",
-						InputSchema: searchSchema,
 					},
+					Risk: risk.ReadOnly,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.SearchPackage)
 					},
+					RepoSchema: packageMgr.CreateSearchPackageSchema,
 				},
 				{
 					Tool: &mcp.Tool{
 						Name:        "install_package",
 						Description: "Install a package and its dependencies on the system from the online repositories.",
-						InputSchema: installSchema,
 					},
+					Risk: risk.PackageMutating,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.InstallPackage)
 					},
+					RepoSchema: packageMgr.CreateInstallPackageSchema,
 				},
 				{
 					Tool: &mcp.Tool{
 						Name:        "remove_package",
 						Description: "Remove a package and its dependencies on the system.",
 					},
+					Risk: risk.PackageMutating,
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, packageMgr.RemovePackage)
 					},
 				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "update_package",
+						Description: "Update a package, or all installed packages when no name is given, to the latest version available in the repositories. Returns the upgraded, downgraded, new and removed packages.",
+					},
+					Risk: risk.SystemUpgrade,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, packageMgr.UpdatePackage)
+					},
+					RepoSchema: packageMgr.CreateUpdatePackageSchema,
+				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "system_info",
+						Description: "Report the package manager backend, the versions of its tools, the OS release and root of the managed system and the supported package operations.",
+					},
+					Risk: risk.ReadOnly,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, packageMgr.SystemInfo)
+					},
+				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "list_jobs",
+						Description: "List the background jobs started with the 'background' parameter of install_package, install_patches and update_package, the most recent first.",
+					},
+					Risk: risk.ReadOnly,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, jobManager.ListJobs)
+					},
+				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "job_status",
+						Description: "Get the state of a background job and its result once it has finished.",
+					},
+					Risk: risk.ReadOnly,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, jobManager.Status)
+					},
+				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "job_output",
+						Description: "Get the output of a background job. Pass the returned offset to the next call to only get the new output.",
+					},
+					Risk: risk.ReadOnly,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, jobManager.JobOutput)
+					},
+				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "job_cancel",
+						Description: "Cancel a running background job.",
+					},
+					// cancelling aborts a transaction halfway, so unlike
+					// the other job tools it isn't read-only and is
+					// audited. Only tools of this tier or above start
+					// jobs, so it is offered whenever a job can run.
+					Risk: risk.PackageMutating,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, jobManager.CancelJob)
+					},
+				},
+				{
+					Tool: &mcp.Tool{
+						Name:        "audit_log",
+						Description: "Get the recent calls of the tools changing the system, with the MCP client which made them, their parameters, the resulting package changes and whether they succeeded, the most recent first.",
+					},
+					Risk: risk.ReadOnly,
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, auditLog.AuditLog)
+					},
+				},
 			}
 
+			for _, tool := range tools {
+				if tool.Tool.Annotations == nil {
+					tool.Tool.Annotations = tool.Risk.Annotations()
+				}
+				if tool.RepoSchema == nil {
+					continue
+				}
+				if tool.Tool.InputSchema, err = tool.RepoSchema(); err != nil {
+					return err
+				}
+			}
+
+			// only the tools of operations the backend supports are offered
+			caps := packageMgr.Capabilities()
 			var allTools []string
+			suppressed := map[string]string{}
 			for _, tool := range tools {
+				if ok, reason := caps.Supports(tool.Tool.Name); !ok {
+					suppressed[tool.Tool.Name] = reason
+					continue
+				}
+				// the tier is enforced regardless of --enabled-tools
+				if tool.Risk > maxRisk {
+					suppressed[tool.Tool.Name] = fmt.Sprintf("risk tier %s exceeds the maximum %s", tool.Risk, maxRisk)
+					continue
+				}
 				allTools = append(allTools, tool.Tool.Name)
 			}
 			if viper.GetBool("list-tools") {
 				if viper.GetBool("verbose") {
-					tb := tabby.New()
-					tb.AddHeader("TOOL", "DESCRIPTION")
+					tb := tabby.NewCustom(tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0))
+					tb.AddHeader("TOOL", "RISK", "DESCRIPTION")
 					for _, tool := range tools {
-						tb.AddLine(tool.Tool.Name, tool.Tool.Description)
+						if reason, ok := suppressed[tool.Tool.Name]; ok {
+							tb.AddLine(tool.Tool.Name, tool.Risk, "suppressed: "+reason)
+						} else {
+							tb.AddLine(tool.Tool.Name, tool.Risk, tool.Tool.Description)
+						}
 					}
 					tb.Print()
 				} else {
-					fmt.Println(strings.Join(allTools, ","))
+					fmt.Fprintln(cmd.OutOrStdout(), strings.Join(allTools, ","))
+					for _, tool := range tools {
+						if reason, ok := suppressed[tool.Tool.Name]; ok {
+							fmt.Fprintf(cmd.ErrOrStderr(), "%s suppressed: %s\n", tool.Tool.Name, reason)
+						}
+					}
 				}
 				return nil
 			}
@@ -199,13 +374,59 @@ func NewRootCmd() *cobra.Command {
 			} else {
 				enabledTools = viper.GetStringSlice("enabled-tools")
 			}
+			// every call of a tool which can change the system is recorded
+			audited := map[string]bool{}
+			for _, tool := range tools {
+				audited[tool.Tool.Name] = tool.Risk > risk.ReadOnly
+			}
+			server.AddReceivingMiddleware(auditLog.Middleware(func(tool string) bool { return audited[tool] }))
 			// register the enabled tools
 			for _, tool := range tools {
+				if _, ok := suppressed[tool.Tool.Name]; ok {
+					if slices.Contains(enabledTools, tool.Tool.Name) {
+						slog.Warn("tool is suppressed", "tool", tool.Tool.Name, "reason", suppressed[tool.Tool.Name])
+					}
+					continue
+				}
 				if slices.Contains(enabledTools, tool.Tool.Name) {
 					tool.Register(server, tool.Tool)
 				}
 			}
 
+			// the repositories are offered as enums, so the schemas are
+			// rebuilt when they change, which notifies the clients with
+			// notifications/tools/list_changed
+			repoIDs := packageMgr.RepoIDs()
+			rebuildRepoSchemas = func() {
+				changed := packageMgr.RepoIDs()
+				if slices.Equal(changed, repoIDs) {
+					return
+				}
+				repoIDs = changed
+				for _, tool := range tools {
+					if tool.RepoSchema == nil || !slices.Contains(enabledTools, tool.Tool.Name) {
+						continue
+					}
+					if _, ok := suppressed[tool.Tool.Name]; ok {
+						continue
+					}
+					schema, err := tool.RepoSchema()
+					if err != nil {
+						slog.Warn("failed to rebuild the schema", "tool", tool.Tool.Name, "error", err)
+						continue
+					}
+					rebuilt := *tool.Tool
+					rebuilt.InputSchema = schema
+					tool.Register(server, &rebuilt)
+				}
+				slog.Info("repositories changed, rebuilt the tool schemas", "repos", changed)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := reposWatcher.Watch(ctx, packageMgr.RepoConfigPaths()); err != nil {
+				slog.Warn("repository changes on disk are not noticed", "error", err)
+			}
+
 			if httpAddr := viper.GetString("http"); httpAddr != "" {
 				handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
 					return server
@@ -231,7 +452,10 @@ func NewRootCmd() *cobra.Command {
 					Transport: &mcp.StdioTransport{},
 					Writer:    os.Stdout,
 				}
-				if err := server.Run(context.Background(), t); err != nil {
+				err := server.Run(ctx, t)
+				// the results of running jobs are kept for the next client
+				jobManager.Wait()
+				if err != nil {
 					slog.Error("Server failed", slog.Any("error", err))
 					return err
 				}
@@ -246,17 +470,132 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
 	rootCmd.Flags().BoolP("debug", "d", false, "Enable debug logging")
 	rootCmd.Flags().Bool("log-json", false, "Output logs in JSON format (machine-readable)")
-	rootCmd.Flags().Bool("list-tools", false, "List all available tools and exit")
+	rootCmd.Flags().Bool("list-tools", false, "List all tools supported by the backend and the suppressed ones with the reason, and exit")
 	rootCmd.Flags().StringSlice("enabled-tools", nil, "A list of tools to enable. Defaults to all tools.")
+	rootCmd.Flags().Bool("read-only", false, "Only offer the tools which don't change the system, same as --max-risk=read-only")
+	rootCmd.Flags().String("max-risk", risk.SystemUpgrade.String(), "Only offer the tools up to this risk tier, one of "+strings.Join(risk.Names(), ", "))
+	rootCmd.Flags().Bool("confirm", false, "Only return the plan and a confirmation token on the first call of install_package, remove_package, update_package and install_patches, and execute the plan on a second call with the token")
+	rootCmd.Flags().Duration("confirm-ttl", confirm.DefaultTTL, "How long the confirmation tokens are valid")
 	rootCmd.Flags().String("cert-file", "", "Path to server certificate file (PEM format) for TLS. Requires --key-file")
 	rootCmd.Flags().String("key-file", "", "Path to server private key file (PEM format) for TLS. Requires --cert-file")
-	rootCmd.Flags().String("root", "", "if set, use this directory as the root for package operations")
+	rootCmd.PersistentFlags().String("config", "", "Configuration file in YAML, JSON or TOML format with the options and the 'policy' section restricting the package transactions")
+	rootCmd.PersistentFlags().String("root", "", "if set, use this directory as the root for package operations")
+	rootCmd.PersistentFlags().String("backend", "auto", "The package manager backend, one of "+strings.Join(oscheck.Backends, ", ")+": auto detects the package manager of the system, simulated keeps the packages in memory for demos and client development")
+	rootCmd.PersistentFlags().String("simulated-fixture", "", "YAML or JSON file with the packages, repositories and patches of the simulated backend. Defaults to a built-in demo system.")
+	rootCmd.Flags().String("record-commands", "", "if set, record all package manager invocations with their output to this fixture file for tests")
+	rootCmd.Flags().String("audit-log", "", "File recording the calls of the tools changing the system as JSON lines. Defaults to audit.jsonl in the state directory.")
+	rootCmd.Flags().Int64("audit-max-size", 10, "Rotate the audit log once it is larger than this size in MiB, 0 disables the rotation")
+	rootCmd.Flags().Int("audit-keep", 5, "The number of rotated audit logs to keep")
+	rootCmd.Flags().String("state-dir", "", "Directory for the state of background jobs and the audit log. Defaults to managesw-mcp in the user cache directory.")
 
 	rootCmd.MarkFlagsRequiredTogether("cert-file", "key-file")
 
+	rootCmd.AddCommand(newDoctorCmd())
+
 	return rootCmd
 }
 
+// newPackageManager returns the backend selected with --backend.
+func newPackageManager() (syspackage.SysPackage, error) {
+	opts := oscheck.Options{
+		Backend: viper.GetString("backend"),
+		Root:    viper.GetString("root"),
+		Fixture: viper.GetString("simulated-fixture"),
+	}
+	if fixture := viper.GetString("record-commands"); fixture != "" {
+		// the root is replaced, so that the fixture can be replayed
+		// against the root of a test environment
+		recorder, err := cmdrunner.NewRecorder(cmdrunner.Exec{}, fixture, cmdrunner.Vars{"ROOT": opts.Root})
+		if err != nil {
+			return syspackage.SysPackage{}, fmt.Errorf("failed to record commands: %w", err)
+		}
+		opts.Runner = recorder
+		slog.Info("recording package manager commands", "fixture", fixture)
+	}
+	packageMgr, err := oscheck.New(opts)
+	if err != nil {
+		return syspackage.SysPackage{}, err
+	}
+	if viper.IsSet("policy") {
+		var pol policy.Policy
+		if err := viper.UnmarshalKey("policy", &pol); err != nil {
+			return syspackage.SysPackage{}, fmt.Errorf("invalid policy: %w", err)
+		}
+		if err := pol.Validate(); err != nil {
+			return syspackage.SysPackage{}, err
+		}
+		packageMgr.Policy = &pol
+	}
+	if opts.Backend == "simulated" {
+		slog.Info("using the simulated backend, no changes are made to the system")
+	}
+	return packageMgr, nil
+}
+
+// newDoctorCmd returns the command printing the system_info of the backend
+// for operators, along with how auto detection chose it.
+func newDoctorCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Print the package manager backend and the system it manages",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			packageMgr, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			_, info, err := packageMgr.SystemInfo(context.Background(), nil, syspackage.SystemInfoParams{})
+			if err != nil {
+				return err
+			}
+
+			tb := tabby.NewCustom(tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0))
+			tb.AddLine("Backend:", info.Backend)
+			root := info.Root
+			if root == "" {
+				root = "/"
+			}
+			tb.AddLine("Root:", root)
+			if name, ok := info.OSRelease["PRETTY_NAME"]; ok {
+				tb.AddLine("OS:", name)
+			} else {
+				tb.AddLine("OS:", "unknown")
+			}
+			for _, tool := range slices.Sorted(maps.Keys(info.Versions)) {
+				tb.AddLine(tool+":", info.Versions[tool])
+			}
+			tb.AddLine("Operations:", strings.Join(info.Operations, ", "))
+			for _, op := range slices.Sorted(maps.Keys(info.Unsupported)) {
+				tb.AddLine("Unsupported:", op+": "+info.Unsupported[op])
+			}
+			if backend := viper.GetString("backend"); backend == "" || backend == "auto" {
+				_, notes := oscheck.Detect(viper.GetString("root"))
+				for _, note := range notes {
+					tb.AddLine("Detection:", note)
+				}
+			}
+			tb.Print()
+
+			if info.Backend == "none" {
+				return fmt.Errorf("no supported package manager found, select one with --backend")
+			}
+			return nil
+		},
+	}
+}
+
+// stateDir returns the directory for the state kept between server processes.
+func stateDir() string {
+	if dir := viper.GetString("state-dir"); dir != "" {
+		return dir
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "managesw-mcp")
+}
+
 func main() {
 	rootCmd := NewRootCmd()
 	if err := rootCmd.Execute(); err != nil {
@@ -2,8 +2,13 @@ package main
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/spf13/viper"
 )
 
 func TestCLIInvalidOptions(t *testing.T) {
@@ -22,29 +27,130 @@ func TestCLIInvalidOptions(t *testing.T) {
 			args:     []string{"--key-file=key.pem"},
 			expected: "if any flags in the group [cert-file key-file] are set they must all be set",
 		},
+		{
+			name:     "unknown backend",
+			args:     []string{"--backend=portage"},
+			expected: "unknown backend \"portage\"",
+		},
+		{
+			name:     "unknown risk tier",
+			args:     []string{"--backend=simulated", "--max-risk=dangerous"},
+			expected: "unknown risk tier \"dangerous\"",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cmd := NewRootCmd()
-			
+
 			// Capture output so we don't spam stdout during tests
 			var outBuf bytes.Buffer
 			cmd.SetOut(&outBuf)
 			cmd.SetErr(&outBuf)
-			
+
 			// We provide specific arguments
 			cmd.SetArgs(tt.args)
-			
+
 			// Run the command and expect an error
 			err := cmd.Execute()
 			if err == nil {
 				t.Fatalf("expected command to fail, but it succeeded")
 			}
-			
+
 			if !strings.Contains(err.Error(), tt.expected) {
 				t.Errorf("expected error to contain %q, got: %q", tt.expected, err.Error())
 			}
 		})
 	}
 }
+
+func TestDoctor(t *testing.T) {
+	cmd := NewRootCmd()
+	var outBuf bytes.Buffer
+	cmd.SetOut(&outBuf)
+	cmd.SetErr(&outBuf)
+	cmd.SetArgs([]string{"doctor", "--backend=simulated"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("doctor failed: %v", err)
+	}
+	for _, expected := range []string{"Backend:", "simulated", "openSUSE Tumbleweed", "install_package"} {
+		if !strings.Contains(outBuf.String(), expected) {
+			t.Errorf("expected output to contain %q, got: %q", expected, outBuf.String())
+		}
+	}
+}
+
+func TestListToolsRisk(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		offered    []string
+		suppressed []string
+	}{
+		{
+			name:       "read-only",
+			args:       []string{"--read-only"},
+			offered:    []string{"list_packages", "search_package", "system_info", "job_status"},
+			suppressed: []string{"modify_repo", "install_package", "update_package", "job_cancel"},
+		},
+		{
+			name:       "package-mutating",
+			args:       []string{"--max-risk=package-mutating"},
+			offered:    []string{"list_packages", "modify_repo", "install_package", "job_cancel"},
+			suppressed: []string{"install_patches", "update_package"},
+		},
+		{
+			name:       "read-only overrides max-risk",
+			args:       []string{"--read-only", "--max-risk=system-upgrade", "--enabled-tools=list_packages,install_package"},
+			offered:    []string{"list_packages"},
+			suppressed: []string{"install_package"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := NewRootCmd()
+			var outBuf, errBuf bytes.Buffer
+			cmd.SetOut(&outBuf)
+			cmd.SetErr(&errBuf)
+			cmd.SetArgs(append([]string{"--backend=simulated", "--list-tools", "--state-dir", t.TempDir()}, tt.args...))
+
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("list-tools failed: %v", err)
+			}
+			offered := strings.Split(strings.TrimSpace(outBuf.String()), ",")
+			for _, tool := range tt.offered {
+				if !slices.Contains(offered, tool) {
+					t.Errorf("expected %s to be offered, got: %v", tool, offered)
+				}
+			}
+			for _, tool := range tt.suppressed {
+				if slices.Contains(offered, tool) {
+					t.Errorf("expected %s to be suppressed, got: %v", tool, offered)
+				}
+				if !strings.Contains(errBuf.String(), tool+" suppressed: risk tier") {
+					t.Errorf("expected the reason for suppressing %s, got: %q", tool, errBuf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestConfigPolicy(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("backend: simulated\npolicy:\n  protected_packages: [\"glibc[\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := NewRootCmd()
+	var outBuf bytes.Buffer
+	cmd.SetOut(&outBuf)
+	cmd.SetErr(&outBuf)
+	cmd.SetArgs([]string{"--config", config, "--list-tools", "--state-dir", t.TempDir()})
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), `invalid package glob "glibc["`) {
+		t.Errorf("expected the invalid policy to be rejected, got: %v", err)
+	}
+}